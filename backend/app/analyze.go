@@ -4,16 +4,19 @@ package app
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
 	"example/my-go-api/app/models"
+	"example/my-go-api/app/tracing"
 
 	"github.com/notnil/chess"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -21,12 +24,18 @@ const (
 	MistakeThreshold           = 100 // 1.00 pawns
 	BlunderThreshold           = 200 // 2.00 pawns
 	OpeningInaccuracyThreshold = 30
+
+	// A forced mate is worth this much when looking for missed wins, from either side.
+	mateEvalCP = 1000
+
+	MissedWinSwingThreshold = 200 // the opponent's error must hand over at least 2 pawns
+	MissedWinGiveBackShare  = 0.5 // and the reply must throw at least half of it away again
 )
 
-func AnalyzePGN(meta models.GameLite, eng *UCIEngine, cfg *config.Config, username string, settings models.EngineSettings) ([]models.Move, error) {
+func AnalyzePGN(ctx context.Context, meta models.GameLite, eng *UCIEngine, cfg *config.Config, username string, settings models.EngineSettings) ([]models.Move, error) {
 	// Parse PGN into new game
-	g := chess.NewGame()
-	if err := g.UnmarshalText([]byte(meta.PGN)); err != nil {
+	g, err := gameFromPGN(meta)
+	if err != nil {
 		return []models.Move{}, err
 	}
 	positions := g.Positions()
@@ -46,23 +55,41 @@ func AnalyzePGN(meta models.GameLite, eng *UCIEngine, cfg *config.Config, userna
 	// New game (lets the engine clear its internal state)
 	eng.NewGame()
 
-	// Evaluate each picked FEN with ~500ms each (tweakable)
-	ctx := context.Background()
+	// Evaluate each picked FEN. A position that times out is left unscored and
+	// counted; an engine that has died, or ctx ending, fails the game.
+	unscored := 0
 	for i := range fens {
-		c2, cancel := context.WithTimeout(ctx, 2*time.Second)
-		score, _ := eng.EvalFEN(c2, fens[i].FEN, settings)
+		evalCtx, cancel := withEvalTimeout(ctx, settings)
+		score, err := eng.EvalFEN(evalCtx, fens[i].FEN, settings)
 		cancel()
+		if err != nil && (ctx.Err() != nil || !eng.Alive()) {
+			return []models.Move{}, fmt.Errorf("evaluate ply %d: %w", i, err)
+		}
+		if score.CP == nil && score.Mate == nil {
+			unscored++
+		}
 		fens[i].Score = score
 	}
+	if unscored > 0 {
+		logging.FromContext(ctx).Warn("positions left unscored", "url", meta.URL, "unscored", unscored, "positions", len(fens))
+	}
+
+	// Ply and move numbers count from the starting position, which may be a
+	// custom FEN with Black to move, so the first move is always move 1.
+	plyOffset := 0
+	if positions[0].Turn() == chess.Black {
+		plyOffset = 1
+	}
 
 	var moves []models.Move
-	for i, m := range g.Moves() {
+	gameMoves := g.Moves()
+	for i, m := range gameMoves {
 		if i >= cfg.Engine.NumMoves {
 			break
 		}
 
 		color := "w"
-		if !IsEven(i) {
+		if positions[i].Turn() == chess.Black {
 			color = "b"
 		}
 
@@ -71,7 +98,7 @@ func AnalyzePGN(meta models.GameLite, eng *UCIEngine, cfg *config.Config, userna
 			playedBy = meta.Opponent
 		}
 
-		moveNumber := (i / 2) + 1
+		moveNumber := ((i + plyOffset) / 2) + 1
 
 		//make sure fenAfter exists for any given position before using it
 		var fenAfter models.FENEval
@@ -88,6 +115,19 @@ func AnalyzePGN(meta models.GameLite, eng *UCIEngine, cfg *config.Config, userna
 		}
 
 		moveAnalysis := GetMoveAnalysis(color, fens[i], fenAfter)
+		var prevMove *chess.Move
+		if i > 0 {
+			prevMove = gameMoves[i-1]
+			moveAnalysis = ClassifyMissedWin(fens[i-1], fens[i], fenAfter, moveAnalysis)
+		}
+		moveAnalysis.Motifs = detectMotifs(motifInput{
+			Before:      positions[i],
+			Move:        m,
+			PrevMove:    prevMove,
+			BeforeScore: fens[i].Score,
+			AfterScore:  fenAfter.Score,
+			IsError:     moveAnalysis.Is_Innacuracy || moveAnalysis.Is_Mistake || moveAnalysis.Is_Blunder,
+		})
 		moves = append(moves, models.Move{
 			MoveUCI:    uciStr,
 			MoveSAN:    sanStr,
@@ -104,6 +144,20 @@ func AnalyzePGN(meta models.GameLite, eng *UCIEngine, cfg *config.Config, userna
 	return moves, nil
 }
 
+// gameFromPGN replays the movetext from meta.StartFEN when set, otherwise from the initial position.
+func gameFromPGN(meta models.GameLite) (*chess.Game, error) {
+	text := meta.PGN
+	if meta.StartFEN != "" {
+		// notnil/chess picks the starting position up from the FEN tag pair.
+		text = fmt.Sprintf("[SetUp \"1\"]\n[FEN \"%s\"]\n\n%s", meta.StartFEN, text)
+	}
+	g := chess.NewGame()
+	if err := g.UnmarshalText([]byte(text)); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
 func fenInfoFromPosition(pos *chess.Position) models.FENEval {
 	fen := pos.String()
 
@@ -127,13 +181,54 @@ func fenInfoFromPosition(pos *chess.Position) models.FENEval {
 	}
 }
 
+// withEvalTimeout bounds one movetime search by the movetime plus slack for a
+// busy machine. Depth searches take as long as they take, so they are bounded
+// only by ctx.
+func withEvalTimeout(ctx context.Context, settings models.EngineSettings) (context.Context, context.CancelFunc) {
+	if settings.UseDepth {
+		return context.WithCancel(ctx)
+	}
+	moveTime := time.Duration(settings.MoveTimeMS) * time.Millisecond
+	return context.WithTimeout(ctx, max(2*time.Second, 4*moveTime))
+}
+
+// unscoredPositions counts the moves played from a position the engine gave
+// no score for.
+func unscoredPositions(moves []models.Move) int {
+	n := 0
+	for _, m := range moves {
+		if m.FenBefore.Score.CP == nil && m.FenBefore.Score.Mate == nil {
+			n++
+		}
+	}
+	return n
+}
+
 // What we let our workers call to process games
-func AnalyzeOneGame(cfg *config.Config, eng *UCIEngine, g models.GameLite, username string, settings models.EngineSettings) (models.GameLite, error) {
-	log.Printf("Analyzing game: %s vs %s (%s)", username, g.Opponent, g.URL)
+func AnalyzeOneGame(ctx context.Context, cfg *config.Config, eng *UCIEngine, g models.GameLite, username string, settings models.EngineSettings) (_ models.GameLite, err error) {
+	ctx, span := tracing.Start(ctx, "AnalyzeOneGame", trace.WithAttributes(attribute.String("game_url", g.URL)))
+	defer func() { tracing.End(span, err) }()
+	logging.FromContext(ctx).Info("analyzing game", "user", username, "opponent", g.Opponent, "url", g.URL)
+
+	// Games stored before their variant was skipped on import still reach here.
+	if g.Variant != "" && !canAnalyse(g) {
+		return models.GameLite{}, fmt.Errorf("%s game %s cannot be analysed", g.Variant, g.URL)
+	}
+	// Games set up from a position (Chess960, odds, thematics) carry it in the
+	// SetUp/FEN tags, which NormalizeChessDotComPGN strips, so pull it out first.
+	if g.StartFEN == "" {
+		g.StartFEN = StartFENFromPGN(g.PGN)
+	}
+	if g.Variant == VariantChess960 && g.StartFEN == "" {
+		return models.GameLite{}, fmt.Errorf("chess960 game %s has no FEN tag", g.URL)
+	}
+	if err := eng.SetChess960(g.Variant == VariantChess960); err != nil {
+		return models.GameLite{}, err
+	}
 
 	g.PGN = NormalizeChessDotComPGN(g.PGN)
 
-	moves, err := AnalyzePGN(g, eng, cfg, username, settings)
+	moves, err := AnalyzePGN(ctx, g, eng, cfg, username, settings)
 	if err != nil {
 		return models.GameLite{}, err
 	}
@@ -200,9 +295,82 @@ func GetMoveAnalysis(color string, before, after models.FENEval) models.MoveAnal
 	return res
 }
 
-// processBatch contains your old main logic for a single batch.
-func ProcessBatch(ctx context.Context, cfg *config.Config, job models.JobMessage) error {
+// evalCP is an evaluation from the side to move, mates capped at mateEvalCP;
+// false when the engine gave no score.
+func evalCP(e models.FENEval) (int, bool) {
+	if e.Score.CP == nil && e.Score.Mate == nil {
+		return 0, false
+	}
+	return max(-mateEvalCP, min(mateEvalCP, comparableCP(e.Score))), true
+}
+
+// ClassifyMissedWin flags cur, the move from before to after, as a missed win
+// when the opponent's move into before (from prevBefore) handed over at least
+// MissedWinSwingThreshold and cur gave back at least MissedWinGiveBackShare of
+// it. Mates count as mateEvalCP here, so letting a forced mate go is caught
+// even though GetMoveAnalysis skips mate lines. Missed wins are reported apart
+// from regular errors, so their error flags are cleared.
+func ClassifyMissedWin(prevBefore, before, after models.FENEval, cur models.MoveAnalysis) models.MoveAnalysis {
+	opp, ok1 := evalCP(prevBefore) // the opponent's view before their move
+	mine, ok2 := evalCP(before)    // the mover's view before cur
+	next, ok3 := evalCP(after)     // the opponent's view after cur
+	if !ok1 || !ok2 || !ok3 {
+		return cur
+	}
+	swing := mine + opp
+	if swing < MissedWinSwingThreshold {
+		return cur
+	}
+	if float64(mine+next) < float64(swing)*MissedWinGiveBackShare {
+		return cur
+	}
+	cur.Is_Missed_Win = true
+	cur.MissedWinCP = swing
+	cur.Is_Blunder, cur.Is_Mistake, cur.Is_Innacuracy, cur.Is_Suboptimal = false, false, false, false
+	return cur
+}
+
+// WithJobLogger tags the logger in ctx with the job's IDs, so lines from the
+// worker and its engines can be matched to the API request that queued it.
+func WithJobLogger(ctx context.Context, job models.JobMessage) context.Context {
+	args := []any{"job_id", job.JobID, "batch_index", job.BatchIndex, "user", job.User}
+	if job.RequestID != "" {
+		args = append(args, "request_id", job.RequestID)
+	}
+	return logging.With(ctx, args...)
+}
+
+// BatchResult is what ProcessBatch did with a batch's games.
+type BatchResult struct {
+	Games    int           // games loaded for the batch
+	Analyzed int           // games whose moves were saved
+	Unscored int           // positions in those games the engine gave no score for
+	Failures []GameFailure // games the engine could not analyse
+}
+
+// GameFailure is one game ProcessBatch could not analyse.
+type GameFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// ProcessBatch analyses one queued batch of a user's games and saves the moves.
+// Callers tag ctx with WithJobLogger. Games that fail are logged and left out
+// of the saved moves; they count in res but do not fail the batch.
+func (a *App) ProcessBatch(ctx context.Context, job models.JobMessage) (res BatchResult, err error) {
+	cfg := a.Config
 	start := time.Now()
+	ctx, span := tracing.Start(tracing.Extract(ctx, job.TraceContext), "ProcessBatch",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("job_id", job.JobID), attribute.Int("batch_index", job.BatchIndex)))
+	defer func() {
+		metrics.JobDuration.WithLabelValues(metrics.Outcome(err)).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}()
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = logging.With(ctx, "trace_id", sc.TraceID().String())
+	}
+	logger := logging.FromContext(ctx)
 	settings := models.EngineSettings{
 		Depth:      job.EngineDepth,
 		MoveTimeMS: job.EngineMoveTime,
@@ -217,47 +385,83 @@ func ProcessBatch(ctx context.Context, cfg *config.Config, job models.JobMessage
 
 	offset := job.BatchIndex * job.NumGames
 
-	log.Printf(
-		"Processing batch: user=%s job_id= %s batch_index=%d num_games=%d offset=%d workers=%s, use_depth=%t, engine_depth=%d, engine_move_time=%d",
-		job.User, job.JobID, job.BatchIndex, job.NumGames, offset, os.Getenv("WORKERS"), settings.UseDepth, settings.Depth, settings.MoveTimeMS,
+	logger.Info("processing batch",
+		"num_games", job.NumGames, "offset", offset,
+		"use_depth", settings.UseDepth, "engine_depth", settings.Depth, "engine_move_time", settings.MoveTimeMS,
 	)
 
-	games, err := LoadGames(ctx, job.User, job.NumGames, offset)
+	loadCtx, loadSpan := tracing.Start(ctx, "LoadGames")
+	var games []models.GameLite
+	if len(job.GameIDs) > 0 {
+		games, err = a.Stores.Games.LoadGamesByID(loadCtx, job.User, job.GameIDs)
+	} else {
+		games, err = a.Stores.Games.LoadGames(loadCtx, job.User, job.NumGames, offset)
+	}
+	loadSpan.SetAttributes(attribute.Int("games", len(games)))
+	tracing.End(loadSpan, err)
 	if err != nil {
-		return err
+		return res, err
 	}
+	res.Games = len(games)
 	if len(games) == 0 {
-		log.Printf("no games found for %s (batch_index=%d)", job.User, job.BatchIndex)
-		return nil
+		logger.Info("no games found")
+		return res, nil
 	}
 
-	numWorkers := GetWorkerCount()
-	log.Printf("Analyzing %d games with %d workers", len(games), numWorkers)
+	numWorkers := a.Workers
+	if numWorkers <= 0 {
+		numWorkers = GetWorkerCount()
+	}
+	logger.Info("analyzing games", "games", len(games), "workers", numWorkers)
 
 	jobs := make(chan models.GameLite, len(games))
 	results := make(chan models.GameLite, len(games))
 	var wg sync.WaitGroup
+	var failMu sync.Mutex
 
 	// Start workers
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
+			workerCtx := logging.With(ctx, "worker", id)
 
-			eng, err := NewUCIEngine(cfg.Engine.Path)
+			eng, err := NewUCIEngine(workerCtx, cfg.Engine.Path)
 			if err != nil {
-				log.Printf("worker %d: failed to create engine: %v", id, err)
+				logging.FromContext(workerCtx).Error("failed to create engine", "err", err)
 				return
 			}
-			defer eng.Close()
+			defer func() {
+				if eng != nil {
+					eng.Close()
+				}
+			}()
 			_ = eng.NewGame()
 
 			for g := range jobs {
-				if report, err := AnalyzeOneGame(cfg, eng, g, job.User, settings); err != nil {
-					log.Printf("worker %d: error analyzing game %s: %v", id, g.URL, err)
-				} else {
+				report, err := AnalyzeOneGame(workerCtx, cfg, eng, g, job.User, settings)
+				if err == nil {
+					metrics.GamesAnalyzed.Inc()
+					metrics.PositionsAnalyzed.Add(float64(len(report.Moves)))
 					results <- report
+					continue
 				}
+				logging.FromContext(workerCtx).Error("error analyzing game", "url", g.URL, "err", err)
+				failMu.Lock()
+				res.Failures = append(res.Failures, GameFailure{URL: g.URL, Error: err.Error()})
+				failMu.Unlock()
+				if eng.Alive() {
+					continue
+				}
+				// The engine died (crash, OOM kill); start a fresh one for the rest.
+				eng.Close()
+				metrics.EngineRestarts.Inc()
+				if eng, err = NewUCIEngine(workerCtx, cfg.Engine.Path); err != nil {
+					logging.FromContext(workerCtx).Error("failed to restart engine", "err", err)
+					return
+				}
+				logging.FromContext(workerCtx).Warn("engine restarted")
+				_ = eng.NewGame()
 			}
 		}(i)
 	}
@@ -277,23 +481,35 @@ func ProcessBatch(ctx context.Context, cfg *config.Config, job models.JobMessage
 	}()
 
 	var allResults []models.GameLite
-	for res := range results {
-		allResults = append(allResults, res)
+	for r := range results {
+		allResults = append(allResults, r)
 	}
 
 	// Separate timeout for DB write
 	ctx2, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
+	ctx2, saveSpan := tracing.Start(ctx2, "SaveMoves", trace.WithAttributes(attribute.Int("games", len(allResults))))
+	err = a.Stores.Moves.SaveMoves(ctx2, allResults, settings)
+	tracing.End(saveSpan, err)
 
-	if err := SaveMoves(ctx2, allResults, settings); err != nil {
-		log.Printf("SaveMoves failed for user=%s batch_index=%d: %v", job.User, job.BatchIndex, err)
-		return err
+	if err != nil {
+		logger.Error("SaveMoves failed", "err", err)
+		return res, err
+	}
+	res.Analyzed = len(allResults)
+	for _, g := range allResults {
+		res.Unscored += unscoredPositions(g.Moves)
 	}
 
-	log.Printf(
-		"Batch complete: user=%s job_id=%s batch_index=%d num_results=%d took=%s",
-		job.User, job.JobID, job.BatchIndex, len(allResults), time.Since(start),
-	)
+	// The moves are stored, so a failure here must not send the batch back to
+	// the queue; the next batch or a drill sync catches up.
+	if n, err := ReactivateDrillCards(ctx2, a.Stores.Drills, job.User, time.Now()); err != nil {
+		logger.Warn("drill reactivation failed", "err", err)
+	} else if n > 0 {
+		logger.Info("reactivated drill cards", "cards", n)
+	}
+
+	logger.Info("batch complete", "num_results", len(allResults), "failed", res.Games-res.Analyzed, "took", time.Since(start))
 
-	return nil
+	return res, nil
 }
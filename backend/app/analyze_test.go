@@ -1,9 +1,11 @@
 package app
 
 import (
+	"context"
 	"strings"
 	"testing"
 
+	"example/my-go-api/app/config"
 	"example/my-go-api/app/models"
 	"github.com/notnil/chess"
 )
@@ -70,3 +72,146 @@ func TestGetMoveAnalysisSkipsMateLines(t *testing.T) {
 		t.Fatalf("expected empty analysis when mate present, got %+v", res)
 	}
 }
+
+func TestClassifyMissedWin(t *testing.T) {
+	cp := func(side string, v int) models.FENEval {
+		return models.FENEval{SideToMove: side, Score: models.UCIScore{CP: intPtr(v)}}
+	}
+	// Black blunders from +0.00 to +4.00 for White.
+	prevBefore, before := cp("b", 0), cp("w", 400)
+
+	after := cp("b", -150) // White gives back 250 of the 400
+	res := ClassifyMissedWin(prevBefore, before, after, GetMoveAnalysis("w", before, after))
+	if !res.Is_Missed_Win || res.MissedWinCP != 400 {
+		t.Fatalf("expected missed win over a 400cp swing, got %+v", res)
+	}
+	if res.Is_Blunder || res.Is_Mistake || res.Is_Innacuracy || res.Is_Suboptimal || res.CPChange != 250 {
+		t.Fatalf("a missed win should keep its loss but not its error flag, got %+v", res)
+	}
+
+	after = cp("b", -250) // only 150 given back
+	res = ClassifyMissedWin(prevBefore, before, after, GetMoveAnalysis("w", before, after))
+	if res.Is_Missed_Win || !res.Is_Mistake {
+		t.Fatalf("giving back less than half is not a missed win, got %+v", res)
+	}
+
+	after = cp("b", 0)
+	res = ClassifyMissedWin(cp("b", 0), cp("w", 120), after, GetMoveAnalysis("w", cp("w", 120), after))
+	if res.Is_Missed_Win {
+		t.Fatalf("a small swing is not a missed win, got %+v", res)
+	}
+}
+
+func TestMissedForcedMate(t *testing.T) {
+	mate := func(side string, n int) models.FENEval {
+		return models.FENEval{SideToMove: side, Score: models.UCIScore{Mate: &n}}
+	}
+	// Black blunders from -0.50 into a mate in 2 for White; White's reply lets it go (+1.00).
+	prevBefore := models.FENEval{SideToMove: "b", Score: models.UCIScore{CP: intPtr(50)}}
+	before := mate("w", 2)
+	after := models.FENEval{SideToMove: "b", Score: models.UCIScore{CP: intPtr(-100)}}
+
+	reply := ClassifyMissedWin(prevBefore, before, after, GetMoveAnalysis("w", before, after))
+	if !reply.Is_Missed_Win || reply.MissedWinCP != mateEvalCP+50 {
+		t.Fatalf("letting a forced mate go should be a missed win, got %+v", reply)
+	}
+
+	// Finding a slower mate keeps the win.
+	after = mate("b", -4)
+	if reply := ClassifyMissedWin(prevBefore, before, after, GetMoveAnalysis("w", before, after)); reply.Is_Missed_Win {
+		t.Fatalf("keeping the mate is not a missed win, got %+v", reply)
+	}
+}
+
+func TestAnalyzeOneGameChess960UsesFENTag(t *testing.T) {
+	// readyok for UCI_Chess960 and NewGame, then a bestmove for each of the five positions.
+	eng, sb := newTestEngine([]string{"readyok", "readyok", "bestmove e2e4", "bestmove e7e5", "bestmove d2d3", "bestmove d7d6", "bestmove f1e1"})
+	cfg := &config.Config{Engine: config.EngineConfig{NumMoves: 10}}
+	game := models.GameLite{
+		URL:     "https://lichess.org/abc",
+		Color:   "white",
+		Variant: VariantChess960,
+		PGN:     "[Variant \"Chess960\"]\n[SetUp \"1\"]\n[FEN \"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1\"]\n\n1. e4 e5 2. Nd3 Nd6 *",
+	}
+
+	got, err := AnalyzeOneGame(context.Background(), cfg, eng, game, "alice", models.EngineSettings{MoveTimeMS: 10})
+	if err != nil {
+		t.Fatalf("AnalyzeOneGame error: %v", err)
+	}
+	if len(got.Moves) != 4 {
+		t.Fatalf("expected 4 moves, got %d", len(got.Moves))
+	}
+	if !strings.HasPrefix(got.Moves[0].FenBefore.FEN, "bbqnnrkr/") {
+		t.Fatalf("first position should be the Chess960 setup, got %s", got.Moves[0].FenBefore.FEN)
+	}
+	if !strings.Contains(sb.String(), "setoption name UCI_Chess960 value true") {
+		t.Fatalf("engine was not switched to Chess960: %q", sb.String())
+	}
+}
+
+func TestAnalyzeOneGameChess960WithoutFEN(t *testing.T) {
+	eng, _ := newTestEngine(nil)
+	cfg := &config.Config{Engine: config.EngineConfig{NumMoves: 10}}
+	game := models.GameLite{Color: "white", Variant: VariantChess960, PGN: "1. e4 e5 *"}
+
+	if _, err := AnalyzeOneGame(context.Background(), cfg, eng, game, "alice", models.EngineSettings{MoveTimeMS: 10}); err == nil {
+		t.Fatalf("expected error for chess960 game without FEN tag")
+	}
+}
+
+func TestAnalyzeOneGameSkipsChess960Castling(t *testing.T) {
+	eng, sb := newTestEngine(nil)
+	cfg := &config.Config{Engine: config.EngineConfig{NumMoves: 10}}
+	// White castles queenside with the king on b1 and the rook on a1, which
+	// notnil/chess cannot replay.
+	game := models.GameLite{
+		URL:     "https://lichess.org/abc",
+		Color:   "white",
+		Variant: VariantChess960,
+		PGN:     "[Variant \"Chess960\"]\n[SetUp \"1\"]\n[FEN \"rkbnnqbr/pppppppp/8/8/8/8/PPPPPPPP/RKBNNQBR w KQkq - 0 1\"]\n\n1. d4 d5 2. Nd3 Nd6 3. Bf4 Bf5 4. Ne3 Ne6 5. O-O-O O-O-O *",
+	}
+
+	if _, err := AnalyzeOneGame(context.Background(), cfg, eng, game, "alice", models.EngineSettings{MoveTimeMS: 10}); err == nil {
+		t.Fatalf("expected a castling chess960 game to be refused")
+	}
+	if sb.Len() != 0 {
+		t.Fatalf("engine should not be queried for a castling chess960 game: %q", sb.String())
+	}
+}
+
+func TestAnalyzePGNFromCustomFENBlackToMove(t *testing.T) {
+	// One readyok for NewGame, then a bestmove for each of the four positions.
+	eng, _ := newTestEngine([]string{"readyok", "bestmove e8d7", "bestmove e2e4", "bestmove d7c6", "bestmove e1e2"})
+	cfg := &config.Config{Engine: config.EngineConfig{NumMoves: 10}}
+	meta := models.GameLite{
+		Color:    "black",
+		Opponent: "bob",
+		StartFEN: "4k3/8/8/8/8/8/4P3/4K3 b - - 0 30",
+		PGN:      "30... Kd7 31. e4 Kc6 *",
+	}
+
+	moves, err := AnalyzePGN(context.Background(), meta, eng, cfg, "alice", models.EngineSettings{MoveTimeMS: 10})
+	if err != nil {
+		t.Fatalf("AnalyzePGN error: %v", err)
+	}
+	if len(moves) != 3 {
+		t.Fatalf("expected 3 moves, got %d", len(moves))
+	}
+
+	want := []struct {
+		color      string
+		moveNumber int
+		ply        int
+		playedBy   string
+	}{
+		{"b", 1, 1, "alice"},
+		{"w", 2, 2, "bob"},
+		{"b", 2, 3, "alice"},
+	}
+	for i, w := range want {
+		m := moves[i]
+		if m.Color != w.color || m.MoveNumber != w.moveNumber || m.Ply != w.ply || m.PlayedBy != w.playedBy {
+			t.Fatalf("move %d = %s n=%d ply=%d by=%s, want %+v", i, m.Color, m.MoveNumber, m.Ply, m.PlayedBy, w)
+		}
+	}
+}
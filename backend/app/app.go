@@ -0,0 +1,89 @@
+// Package app holds the application container shared by the API and workers.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/models"
+
+	aws "github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// App holds the dependencies of the handlers and the batch worker. Each cmd
+// builds one with NewApp; tests fill the fields with fakes directly.
+type App struct {
+	Config    *config.Config
+	Stores    Stores
+	Queue     JobQueue                // nil without a queue URL
+	Providers map[string]GameProvider // keyed by ProviderChessCom, ProviderLichess
+	Billing   BillingClient
+	Workers   int // engines ProcessBatch runs in parallel; 0 uses GetWorkerCount
+}
+
+// JobQueue hands analysis batches to the workers.
+type JobQueue interface {
+	Enqueue(ctx context.Context, msg models.JobMessage) error
+	// Ping checks the queue exists and we may use it.
+	Ping(ctx context.Context) error
+}
+
+// NewApp wires the production clients around cfg and stores.
+func NewApp(ctx context.Context, cfg *config.Config, stores Stores) (*App, error) {
+	a := &App{
+		Config:    cfg,
+		Stores:    stores,
+		Providers: DefaultProviders(&http.Client{Timeout: 15 * time.Second}),
+		Billing:   NewStripeClient(cfg.Stripe.SecretKey),
+	}
+	if cfg.Queue.URL != "" {
+		q, err := NewSQSQueue(ctx, cfg.Queue.URL)
+		if err != nil {
+			return nil, err
+		}
+		a.Queue = q
+	}
+	return a, nil
+}
+
+// SQSQueue sends each job message to an SQS queue as JSON.
+type SQSQueue struct {
+	Client *sqs.Client
+	URL    string
+}
+
+// NewSQSQueue creates an SQS client from the default AWS config.
+func NewSQSQueue(ctx context.Context, queueURL string) (*SQSQueue, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config for SQS: %w", err)
+	}
+	return &SQSQueue{Client: sqs.NewFromConfig(awsCfg), URL: queueURL}, nil
+}
+
+func (q *SQSQueue) Enqueue(ctx context.Context, msg models.JobMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = q.Client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.URL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+func (q *SQSQueue) Ping(ctx context.Context) error {
+	_, err := q.Client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(q.URL),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	return err
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/metrics"
+	"example/my-go-api/app/models"
+	"example/my-go-api/app/tracing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stripe/stripe-go/v79"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeProvider struct {
+	games []models.GameLite
+	err   error
+}
+
+func (p fakeProvider) FetchGames(ctx context.Context, username string, months, limit int) ([]models.GameLite, error) {
+	return append([]models.GameLite(nil), p.games...), p.err
+}
+
+type fakeQueue struct {
+	sent    []models.JobMessage
+	pingErr error
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, msg models.JobMessage) error {
+	q.sent = append(q.sent, msg)
+	return nil
+}
+
+func (q *fakeQueue) Ping(ctx context.Context) error {
+	return q.pingErr
+}
+
+type fakeBilling struct {
+	customers int
+}
+
+func (b *fakeBilling) NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error) {
+	b.customers++
+	return &stripe.Customer{ID: fmt.Sprintf("cus_%d", b.customers)}, nil
+}
+
+func (b *fakeBilling) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return &stripe.CheckoutSession{URL: "https://checkout.test/" + *params.Customer}, nil
+}
+
+func (b *fakeBilling) NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	return &stripe.BillingPortalSession{URL: "https://portal.test/" + *params.Customer}, nil
+}
+
+// newTestApp builds an App on an in-memory store with fake clients and no
+// environment beyond AUTH_DISABLED, which signs every request in as local-dev.
+func newTestApp(t *testing.T, games ...models.GameLite) (*App, *fakeQueue, *fakeBilling) {
+	t.Helper()
+	t.Setenv("AUTH_DISABLED", "true")
+	queue := &fakeQueue{}
+	billing := &fakeBilling{}
+	a := &App{
+		Config: &config.Config{
+			Queue:  config.QueueConfig{BatchSize: 2},
+			Stripe: config.StripeConfig{PriceIDProMonthly: "price_pro", FrontendURL: "https://app.test/"},
+		},
+		Stores: StoresFrom(newTestSQLiteStore(t)),
+		Queue:  queue,
+		Providers: map[string]GameProvider{
+			ProviderChessCom: fakeProvider{games: games},
+			ProviderLichess:  fakeProvider{err: errUserNotFound},
+		},
+		Billing: billing,
+	}
+	return a, queue, billing
+}
+
+func serve(t *testing.T, a *App, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	router, err := NewRouter(a)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func testGames(n int) []models.GameLite {
+	games := make([]models.GameLite, n)
+	for i := range games {
+		games[i] = models.GameLite{
+			URL:     fmt.Sprintf("https://example.test/game/%d", i),
+			When:    int64(1000 + i),
+			Color:   "white",
+			Variant: "standard",
+			PGN:     "1. e4 e5 2. Nf3 Nc6 *",
+		}
+	}
+	return games
+}
+
+func TestGetChessGamesSavesGamesAndQueuesBatches(t *testing.T) {
+	a, queue, _ := newTestApp(t, testGames(3)...)
+
+	w := serve(t, a, http.MethodGet, "/chessgames/Alice?engine_depth=14&engine_depth_or_time=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Count   int    `json:"count"`
+		JobID   string `json:"job_id"`
+		Batches int    `json:"batches"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Count != 3 || body.Batches != 2 || body.JobID == "" {
+		t.Fatalf("unexpected response %+v", body)
+	}
+
+	if len(queue.sent) != 2 {
+		t.Fatalf("want 2 queued batches, got %d", len(queue.sent))
+	}
+	for i, msg := range queue.sent {
+		if msg.JobID != body.JobID || msg.User != "alice" || msg.BatchIndex != i || msg.NumGames != 2 || msg.EngineDepth != 14 || !msg.EngineUseDepth {
+			t.Fatalf("unexpected message %d: %+v", i, msg)
+		}
+		if id := w.Header().Get("X-Request-Id"); id == "" || msg.RequestID != id {
+			t.Fatalf("message %d request_id = %q, response header %q", i, msg.RequestID, id)
+		}
+	}
+
+	ctx := context.Background()
+	if n, _ := a.Stores.Games.CountGames(ctx, "alice"); n != 3 {
+		t.Fatalf("want 3 saved games, got %d", n)
+	}
+	if status, err := a.Stores.Jobs.FindJobStatus(ctx, body.JobID); err != nil || status.TotalBatches != 2 {
+		t.Fatalf("job row = %+v, %v", status, err)
+	}
+	if user, _ := a.Stores.Users.GetUser(ctx, "local-dev"); user.AnalysesUsed != 3 {
+		t.Fatalf("quota should be charged 3 analyses, got %d", user.AnalysesUsed)
+	}
+}
+
+func TestGetChessGamesTracesJobIntoMessages(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	a, queue, _ := newTestApp(t, testGames(3)...)
+	if w := serve(t, a, http.MethodGet, "/chessgames/alice"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["GET /chessgames/:username"]
+	if !ok {
+		t.Fatalf("no request span among %v", spans)
+	}
+	for _, name := range []string{"provider.fetch", "saveGames", "job.create", "queue.enqueue"} {
+		s, ok := spans[name]
+		if !ok || s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Fatalf("span %s missing or not in the request's trace", name)
+		}
+	}
+	for i, msg := range queue.sent {
+		carried := trace.SpanContextFromContext(tracing.Extract(context.Background(), msg.TraceContext))
+		if carried.TraceID() != root.SpanContext().TraceID() {
+			t.Fatalf("message %d carries trace %s, want %s", i, carried.TraceID(), root.SpanContext().TraceID())
+		}
+	}
+}
+
+func TestGetChessGamesRejectsOverQuota(t *testing.T) {
+	a, queue, _ := newTestApp(t, testGames(3)...)
+	if _, err := a.Stores.Users.UpdateUsage(context.Background(), "local-dev", func(u *models.User) error {
+		u.AnalysesUsed = FreeWeeklyLimit - 1
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUsage: %v", err)
+	}
+
+	before := testutil.ToFloat64(metrics.QuotaRejections)
+	w := serve(t, a, http.MethodGet, "/chessgames/alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	if got := testutil.ToFloat64(metrics.QuotaRejections) - before; got != 1 {
+		t.Fatalf("quota rejections grew by %v, want 1", got)
+	}
+	if len(queue.sent) != 0 {
+		t.Fatalf("nothing should be queued over quota, got %d", len(queue.sent))
+	}
+}
+
+func TestGetChessGamesUnknownPlayer(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	if w := serve(t, a, http.MethodGet, "/chessgames/ghost?provider=lichess"); w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestCreateCheckoutSessionReusesCustomer(t *testing.T) {
+	a, _, billing := newTestApp(t)
+	if err := a.Stores.Users.UpsertUser(context.Background(), "local-dev", "", ""); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		w := serve(t, a, http.MethodPost, "/api/billing/create-checkout-session")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			URL string `json:"url"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if body.URL != "https://checkout.test/cus_1" {
+			t.Fatalf("unexpected checkout url %q", body.URL)
+		}
+	}
+	if billing.customers != 1 {
+		t.Fatalf("the Stripe customer should be created once, got %d", billing.customers)
+	}
+}
+
+func TestRouterDoesNotServeMetrics(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	if w := serve(t, a, http.MethodGet, "/metrics"); w.Code != http.StatusNotFound {
+		t.Fatalf("/metrics on the public router: status = %d", w.Code)
+	}
+}
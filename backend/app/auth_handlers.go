@@ -2,7 +2,6 @@
 package app
 
 import (
-	"database/sql"
 	"net/http"
 	"time"
 
@@ -13,57 +12,29 @@ import (
 )
 
 // Health is a public health check endpoint.
-func Health(c *gin.Context) {
+func (a *App) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
 	})
 }
 
 // Me returns weekly usage info for the authenticated user.
-func Me(c *gin.Context) {
+func (a *App) Me(c *gin.Context) {
 	claims, ok := auth.ClaimsFromContext(c.Request.Context())
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
 		return
 	}
 
-	if db == nil {
-		c.JSON(http.StatusOK, gin.H{
-			"plan":         models.PlanFree,
-			"analysesUsed": 0,
-			"weeklyLimit":  FreeWeeklyLimit,
-			"remaining":    FreeWeeklyLimit,
-		})
-		return
-	}
-
-	user, err := getUserByAuth0Sub(c.Request.Context(), claims.Subject)
+	// Reading through UpdateUsage creates a missing user and stores the
+	// rollover when a new week has started.
+	user, err := a.Stores.Users.UpdateUsage(c.Request.Context(), claims.Subject, func(u *models.User) error {
+		resetWeekIfStale(u, time.Now())
+		return nil
+	})
 	if err != nil {
-		if err == sql.ErrNoRows {
-			_ = UpsertUserFromClaims(c.Request.Context(), claims)
-			user, err = getUserByAuth0Sub(c.Request.Context(), claims.Subject)
-		}
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
-			return
-		}
-	}
-
-	currentWeekStart := weekStartUTC(time.Now())
-	if user.UsagePeriodStart.Before(currentWeekStart) {
-		user.AnalysesUsed = 0
-		user.UsagePeriodStart = currentWeekStart
-		_, _ = db.ExecContext(
-			c.Request.Context(),
-			`
-				UPDATE users
-				SET analyses_used = $1, usage_period_start = $2
-				WHERE auth0_sub = $3;
-			`,
-			user.AnalysesUsed,
-			user.UsagePeriodStart,
-			claims.Subject,
-		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		return
 	}
 
 	var weeklyLimit any = nil
@@ -1,37 +1,104 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	// this will automatically load your .env file:
 	_ "github.com/joho/godotenv/autoload"
 )
 
+// Config is the whole configuration; Load fills the sections asked for.
 type Config struct {
-	Logs     LogConfig
-	DB       PostgresConfig
-	Engine   EngineConfig
-	QueueURL string
-	Stripe   StripeConfig
+	Logs    LogConfig
+	Store   StoreConfig
+	DB      PostgresConfig
+	Engine  EngineConfig
+	Queue   QueueConfig
+	Stripe  StripeConfig
+	Metrics MetricsConfig
+	Tracing TracingConfig
 }
 
 type LogConfig struct {
 	Style string
 	Level string
 }
+
+// StoreConfig picks the storage backend.
+type StoreConfig struct {
+	Driver     string // postgres or sqlite
+	SQLitePath string // database file for the sqlite driver
+}
+
+// PostgresConfig is either a full DSN or the discrete fields ConnString
+// assembles. The pool and retry settings apply to both.
 type PostgresConfig struct {
-	Username string
-	Password string
-	URL      string
-	Port     string
+	DSN string // postgres:// URL or key=value string; overrides the fields below
+
+	Username         string
+	Password         string
+	URL              string // host
+	Port             string
+	Database         string
+	SSLMode          string        // disable, require, verify-ca, verify-full; lib/pq defaults to require
+	SSLRootCert      string        // CA file for verify-ca/verify-full
+	StatementTimeout time.Duration // 0 leaves the server default
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectTimeout  time.Duration // how long startup keeps retrying the first connection
+}
+
+// ConnString returns DSN when set, otherwise a postgres:// URL built from the
+// discrete fields with the credentials escaped.
+func (c PostgresConfig) ConnString() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+
+	host := c.URL
+	if c.Port != "" {
+		host = net.JoinHostPort(c.URL, c.Port)
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.Username, c.Password),
+		Host:   host,
+		Path:   "/" + c.Database,
+	}
+
+	q := url.Values{}
+	if c.SSLMode != "" {
+		q.Set("sslmode", c.SSLMode)
+	}
+	if c.SSLRootCert != "" {
+		q.Set("sslrootcert", c.SSLRootCert)
+	}
+	if c.StatementTimeout > 0 {
+		// lib/pq passes unknown parameters to the server as session settings.
+		q.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
 }
 
 type EngineConfig struct {
 	Path     string
 	NumMoves int //how many moves should the engine process
-	NumGames int
+}
+
+type QueueConfig struct {
+	URL       string
+	BatchSize int // games per queued batch
 }
 
 type StripeConfig struct {
@@ -41,41 +108,325 @@ type StripeConfig struct {
 	FrontendURL       string
 }
 
-func LoadConfig() (*Config, error) {
-	numMoves, err := strconv.Atoi(os.Getenv("ENGINE_NUMBER_OF_MOVES"))
+// MetricsConfig is for the optional metrics listener. The API and the workers
+// serve /metrics only there, never on a public router.
+type MetricsConfig struct {
+	Addr      string // host:port, "" disables
+	ReadyAddr string // host:port the worker always serves /ready on
+}
+
+// TracingConfig points the OpenTelemetry exporter at an OTLP/HTTP collector.
+type TracingConfig struct {
+	Endpoint    string  // e.g. http://localhost:4318; "" disables tracing
+	ServiceName string  // overrides the binary's default service.name
+	SampleRatio float64 // share of new traces kept, 0 to 1
+}
+
+// Section names a group of settings one component needs.
+type Section string
+
+const (
+	SectionLogs    Section = "logs"
+	SectionStore   Section = "store"
+	SectionDB      Section = "postgres"
+	SectionEngine  Section = "engine"
+	SectionQueue   Section = "queue"
+	SectionStripe  Section = "stripe"
+	SectionMetrics Section = "metrics"
+	SectionTracing Section = "tracing"
+)
+
+// Sections lists every section in file order.
+var Sections = []Section{SectionLogs, SectionStore, SectionDB, SectionEngine, SectionQueue, SectionStripe, SectionMetrics, SectionTracing}
+
+// Load reads and validates the given sections (all when none) from the
+// environment, falling back to the YAML or TOML file named by CONFIG_FILE.
+// Sections not asked for stay zero. Problems come back together as a
+// *ValidationError.
+func Load(sections ...Section) (*Config, error) {
+	return LoadFrom(os.Getenv("CONFIG_FILE"), sections...)
+}
+
+// LoadFrom is Load with an explicit config file path; "" means environment only.
+func LoadFrom(path string, sections ...Section) (*Config, error) {
+	src, err := readFile(path)
 	if err != nil {
-		log.Fatalf("Error converting string to int: ENGINE_NUMBER_OF_MOVES: %v", err)
+		return nil, err
 	}
+	return load(src, sections)
+}
 
-	numGames, err := strconv.Atoi(os.Getenv("ENGINE_NUMBER_OF_GAMES"))
+// LoadWith is Load for commands with their own flags, keyed by environment
+// variable name: flags win over every other source, and defaults fill in
+// settings nothing else sets.
+func LoadWith(flags, defaults map[string]string, sections ...Section) (*Config, error) {
+	src, err := readFile(os.Getenv("CONFIG_FILE"))
 	if err != nil {
-		log.Fatalf("Error converting string to int: ENGINE_NUMBER_OF_GAMES: %v", err)
-	}
-
-	cfg := &Config{
-		QueueURL: os.Getenv("QUEUE_URL"),
-		Logs: LogConfig{
-			Style: os.Getenv("LOG_STYLE"),
-			Level: os.Getenv("LOG_LEVEL"),
-		},
-		DB: PostgresConfig{
-			Username: os.Getenv("POSTGRES_USER"),
-			Password: os.Getenv("POSTGRES_PWD"),
-			URL:      os.Getenv("POSTGRES_URL"),
-			Port:     os.Getenv("POSTGRES_PORT"),
-		},
-		Engine: EngineConfig{
-			Path:     os.Getenv("ENGINE_PATH"),
-			NumMoves: numMoves,
-			NumGames: numGames,
-		},
-		Stripe: StripeConfig{
-			SecretKey:         os.Getenv("STRIPE_SECRET_KEY"),
-			PriceIDProMonthly: os.Getenv("STRIPE_PRICE_ID_PRO_MONTHLY"),
-			WebhookSecret:     os.Getenv("STRIPE_WEBHOOK_SECRET"),
-			FrontendURL:       os.Getenv("FRONTEND_URL"),
-		},
+		return nil, err
 	}
+	src.flags, src.defaults = flags, defaults
+	return load(src, sections)
+}
 
+func load(src source, sections []Section) (*Config, error) {
+	l := &loader{src: src}
+	cfg := &Config{}
+	want := sectionSet(sections)
+	if want[SectionLogs] {
+		cfg.Logs = l.logs()
+	}
+	if want[SectionStore] {
+		cfg.Store = l.store()
+	}
+	if want[SectionDB] {
+		cfg.DB = l.postgres()
+	}
+	if want[SectionEngine] {
+		cfg.Engine = l.engine()
+	}
+	if want[SectionQueue] {
+		cfg.Queue = l.queue()
+	}
+	if want[SectionStripe] {
+		cfg.Stripe = l.stripe()
+	}
+	if want[SectionMetrics] {
+		cfg.Metrics = l.metrics()
+	}
+	if want[SectionTracing] {
+		cfg.Tracing = l.tracing()
+	}
+	if len(l.errs) > 0 {
+		return nil, &ValidationError{Fields: l.errs}
+	}
 	return cfg, nil
 }
+
+func sectionSet(sections []Section) map[Section]bool {
+	if len(sections) == 0 {
+		sections = Sections
+	}
+	set := map[Section]bool{}
+	for _, s := range sections {
+		set[s] = true
+	}
+	return set
+}
+
+// loader reads typed values from a source, collecting problems as it goes.
+type loader struct {
+	src  source
+	errs []FieldError
+}
+
+func (l *loader) fail(env, format string, args ...any) {
+	section := Section("")
+	for _, st := range settings {
+		if st.Env == env {
+			section = st.Section
+		}
+	}
+	l.errs = append(l.errs, FieldError{Section: section, Env: env, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (l *loader) str(env string) string {
+	return l.src.get(env)
+}
+
+func (l *loader) required(env string) string {
+	v := l.src.get(env)
+	if v == "" {
+		l.fail(env, "required")
+	}
+	return v
+}
+
+// int reads a non-negative integer, 0 when unset.
+func (l *loader) int(env string) int {
+	v := l.src.get(env)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		l.fail(env, "want a non-negative integer, got %q", v)
+		return 0
+	}
+	return n
+}
+
+// positiveInt reads a required integer greater than zero.
+func (l *loader) positiveInt(env string) int {
+	v := l.src.get(env)
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.fail(env, "want a positive integer, got %q", v)
+		return 0
+	}
+	return n
+}
+
+// duration reads a Go duration ("30s", "5m"), 0 when unset.
+func (l *loader) duration(env string) time.Duration {
+	v := l.src.get(env)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		l.fail(env, "want a duration such as 30s or 5m, got %q", v)
+		return 0
+	}
+	return d
+}
+
+// ratio reads a number between 0 and 1.
+func (l *loader) ratio(env string) float64 {
+	v := l.src.get(env)
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		l.fail(env, "want a number from 0 to 1, got %q", v)
+		return 0
+	}
+	return f
+}
+
+func (l *loader) oneOf(env string, allowed ...string) string {
+	v := l.src.get(env)
+	if v == "" {
+		return ""
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(v, a) {
+			return a
+		}
+	}
+	l.fail(env, "want one of %s, got %q", strings.Join(allowed, ", "), v)
+	return v
+}
+
+func (l *loader) httpURL(env string, v string) {
+	if u, err := url.Parse(v); v != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		l.fail(env, "want an http(s) URL, got %q", v)
+	}
+}
+
+func (l *loader) logs() LogConfig {
+	return LogConfig{
+		Style: l.oneOf("LOG_STYLE", "text", "json"),
+		Level: l.oneOf("LOG_LEVEL", "debug", "info", "warn", "error"),
+	}
+}
+
+func (l *loader) store() StoreConfig {
+	cfg := StoreConfig{
+		Driver:     l.oneOf("STORE_DRIVER", "postgres", "sqlite"),
+		SQLitePath: l.str("SQLITE_PATH"),
+	}
+	if cfg.Driver == "sqlite" && cfg.SQLitePath == "" {
+		l.fail("SQLITE_PATH", "required when STORE_DRIVER is sqlite")
+	}
+	return cfg
+}
+
+func (l *loader) postgres() PostgresConfig {
+	cfg := PostgresConfig{
+		DSN:              l.str("POSTGRES_DSN"),
+		Username:         l.str("POSTGRES_USER"),
+		Password:         l.str("POSTGRES_PWD"),
+		URL:              l.str("POSTGRES_URL"),
+		Port:             l.str("POSTGRES_PORT"),
+		Database:         l.str("POSTGRES_DB"),
+		SSLMode:          l.oneOf("POSTGRES_SSLMODE", "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+		SSLRootCert:      l.str("POSTGRES_SSLROOTCERT"),
+		StatementTimeout: l.duration("POSTGRES_STATEMENT_TIMEOUT"),
+		MaxOpenConns:     l.int("POSTGRES_MAX_OPEN_CONNS"),
+		MaxIdleConns:     l.int("POSTGRES_MAX_IDLE_CONNS"),
+		ConnMaxLifetime:  l.duration("POSTGRES_CONN_MAX_LIFETIME"),
+		ConnMaxIdleTime:  l.duration("POSTGRES_CONN_MAX_IDLE_TIME"),
+		ConnectTimeout:   l.duration("POSTGRES_CONNECT_TIMEOUT"),
+	}
+	if cfg.DSN == "" {
+		if cfg.URL == "" {
+			l.fail("POSTGRES_URL", "required unless POSTGRES_DSN is set")
+		}
+		if cfg.Username == "" {
+			l.fail("POSTGRES_USER", "required unless POSTGRES_DSN is set")
+		}
+		if cfg.Port != "" {
+			if n, err := strconv.Atoi(cfg.Port); err != nil || n <= 0 || n > 65535 {
+				l.fail("POSTGRES_PORT", "want a port number, got %q", cfg.Port)
+			}
+		}
+	}
+	if cfg.SSLRootCert != "" {
+		if _, err := os.Stat(cfg.SSLRootCert); err != nil {
+			l.fail("POSTGRES_SSLROOTCERT", "%v", err)
+		}
+	}
+	if cfg.ConnectTimeout == 0 {
+		l.fail("POSTGRES_CONNECT_TIMEOUT", "must be positive")
+	}
+	return cfg
+}
+
+func (l *loader) engine() EngineConfig {
+	cfg := EngineConfig{
+		Path:     l.required("ENGINE_PATH"),
+		NumMoves: l.positiveInt("ENGINE_NUMBER_OF_MOVES"),
+	}
+	if cfg.Path != "" {
+		// A bare name is looked up on PATH, like exec.Command does.
+		if _, err := exec.LookPath(cfg.Path); err != nil {
+			l.fail("ENGINE_PATH", "%v", err)
+		}
+	}
+	return cfg
+}
+
+func (l *loader) queue() QueueConfig {
+	cfg := QueueConfig{
+		URL:       l.required("QUEUE_URL"),
+		BatchSize: l.positiveInt("ENGINE_NUMBER_OF_GAMES"),
+	}
+	l.httpURL("QUEUE_URL", cfg.URL)
+	return cfg
+}
+
+func (l *loader) stripe() StripeConfig {
+	cfg := StripeConfig{
+		SecretKey:         l.required("STRIPE_SECRET_KEY"),
+		PriceIDProMonthly: l.required("STRIPE_PRICE_ID_PRO_MONTHLY"),
+		WebhookSecret:     l.required("STRIPE_WEBHOOK_SECRET"),
+		FrontendURL:       l.required("FRONTEND_URL"),
+	}
+	l.httpURL("FRONTEND_URL", cfg.FrontendURL)
+	return cfg
+}
+
+func (l *loader) metrics() MetricsConfig {
+	cfg := MetricsConfig{Addr: l.str("METRICS_ADDR"), ReadyAddr: l.str("READY_ADDR")}
+	l.hostPort("METRICS_ADDR", cfg.Addr)
+	l.hostPort("READY_ADDR", cfg.ReadyAddr)
+	return cfg
+}
+
+// hostPort checks a listen address such as ":9090"; "" passes.
+func (l *loader) hostPort(env, addr string) {
+	if addr == "" {
+		return
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+		l.fail(env, "want host:port such as :9090, got %q", addr)
+	}
+}
+
+func (l *loader) tracing() TracingConfig {
+	cfg := TracingConfig{
+		Endpoint:    l.str("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName: l.str("OTEL_SERVICE_NAME"),
+		SampleRatio: l.ratio("OTEL_TRACES_SAMPLE_RATIO"),
+	}
+	l.httpURL("OTEL_EXPORTER_OTLP_ENDPOINT", cfg.Endpoint)
+	return cfg
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnStringEscapesAndAddsOptions(t *testing.T) {
+	c := PostgresConfig{
+		Username:         "app",
+		Password:         "p@ss:w/rd?",
+		URL:              "db.internal",
+		Port:             "5432",
+		Database:         "chessgaps",
+		SSLMode:          "verify-full",
+		SSLRootCert:      "/etc/ssl/rds.pem",
+		StatementTimeout: 15 * time.Second,
+	}
+	u, err := url.Parse(c.ConnString())
+	if err != nil {
+		t.Fatalf("ConnString is not a URL: %v", err)
+	}
+	if pwd, _ := u.User.Password(); pwd != c.Password || u.User.Username() != "app" {
+		t.Fatalf("credentials did not round-trip: %v", u.User)
+	}
+	if u.Host != "db.internal:5432" || u.Path != "/chessgaps" {
+		t.Fatalf("unexpected host/path %q %q", u.Host, u.Path)
+	}
+	q := u.Query()
+	if q.Get("sslmode") != "verify-full" || q.Get("sslrootcert") != "/etc/ssl/rds.pem" || q.Get("statement_timeout") != "15000" {
+		t.Fatalf("unexpected options %v", q)
+	}
+}
+
+func TestConnStringPrefersDSN(t *testing.T) {
+	c := PostgresConfig{DSN: "host=localhost dbname=x", Username: "ignored"}
+	if got := c.ConnString(); got != c.DSN {
+		t.Fatalf("ConnString = %q, want the DSN", got)
+	}
+}
+
+func TestLoadPostgresDefaultsAndOverrides(t *testing.T) {
+	t.Setenv("POSTGRES_URL", "localhost")
+	t.Setenv("POSTGRES_USER", "app")
+	t.Setenv("POSTGRES_MAX_OPEN_CONNS", "3")
+	t.Setenv("POSTGRES_CONN_MAX_LIFETIME", "2m")
+	t.Setenv("POSTGRES_STATEMENT_TIMEOUT", "")
+	cfg, err := LoadFrom("", SectionDB)
+	if err != nil {
+		t.Fatalf("LoadFrom: %v", err)
+	}
+	db := cfg.DB
+	if db.MaxOpenConns != 3 || db.ConnMaxLifetime != 2*time.Minute || db.MaxIdleConns != 5 || db.StatementTimeout != 0 || db.ConnectTimeout != 30*time.Second {
+		t.Fatalf("unexpected config %+v", db)
+	}
+	if cfg.Engine.Path != "" {
+		t.Fatalf("sections not asked for should stay zero, got %+v", cfg.Engine)
+	}
+}
+
+func TestLoadStore(t *testing.T) {
+	t.Setenv("STORE_DRIVER", "")
+	t.Setenv("SQLITE_PATH", "")
+	cfg, err := LoadFrom("", SectionStore)
+	if err != nil || cfg.Store.Driver != "postgres" || cfg.Store.SQLitePath != "chessgaps.db" {
+		t.Fatalf("defaults = %+v, %v", cfg.Store, err)
+	}
+
+	t.Setenv("STORE_DRIVER", "SQLite")
+	t.Setenv("SQLITE_PATH", "/tmp/games.db")
+	if cfg, err := LoadFrom("", SectionStore); err != nil || cfg.Store.Driver != "sqlite" || cfg.Store.SQLitePath != "/tmp/games.db" {
+		t.Fatalf("sqlite = %+v, %v", cfg.Store, err)
+	}
+
+	t.Setenv("STORE_DRIVER", "mysql")
+	var verr *ValidationError
+	if _, err := LoadFrom("", SectionStore); !errors.As(err, &verr) {
+		t.Fatalf("unknown driver = %v, want *ValidationError", err)
+	}
+}
+
+func TestLoadAggregatesProblems(t *testing.T) {
+	t.Setenv("ENGINE_PATH", filepath.Join(t.TempDir(), "no-such-engine"))
+	t.Setenv("ENGINE_NUMBER_OF_MOVES", "lots")
+	t.Setenv("ENGINE_NUMBER_OF_GAMES", "-1")
+	t.Setenv("QUEUE_URL", "")
+	t.Setenv("METRICS_ADDR", "9090")
+	t.Setenv("READY_ADDR", "localhost")
+
+	_, err := LoadFrom("", SectionEngine, SectionQueue, SectionMetrics)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("want *ValidationError, got %v", err)
+	}
+	got := map[string]bool{}
+	for _, f := range verr.Fields {
+		got[f.Env] = true
+	}
+	for _, env := range []string{"ENGINE_PATH", "ENGINE_NUMBER_OF_MOVES", "ENGINE_NUMBER_OF_GAMES", "QUEUE_URL", "METRICS_ADDR", "READY_ADDR"} {
+		if !got[env] {
+			t.Fatalf("missing problem for %s in %v", env, err)
+		}
+	}
+	var field FieldError
+	if !errors.As(err, &field) {
+		t.Fatalf("individual problems should unwrap to FieldError")
+	}
+}
+
+func TestLoadFromFiles(t *testing.T) {
+	engine, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable: %v", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.yaml": "engine:\n  path: " + engine + "\n  number_of_moves: 40\nqueue:\n  url: https://sqs.test/q\n  batch_size: 100\n",
+		"app.toml": "[engine]\npath = '" + engine + "'\nnumber_of_moves = 40\n[queue]\nurl = 'https://sqs.test/q'\nbatch_size = 100\n",
+	}
+	t.Setenv("ENGINE_NUMBER_OF_MOVES", "")
+	t.Setenv("ENGINE_NUMBER_OF_GAMES", "25") // the environment wins over the file
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFrom(path, SectionEngine, SectionQueue)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.Engine.NumMoves != 40 || cfg.Queue.BatchSize != 25 || cfg.Queue.URL != "https://sqs.test/q" {
+			t.Fatalf("%s: unexpected config %+v %+v", name, cfg.Engine, cfg.Queue)
+		}
+	}
+
+	typo := filepath.Join(dir, "typo.yaml")
+	_ = os.WriteFile(typo, []byte("engine:\n  pth: x\n"), 0o600)
+	if _, err := LoadFrom(typo); err == nil || !strings.Contains(err.Error(), "engine.pth") {
+		t.Fatalf("unknown keys should be rejected, got %v", err)
+	}
+}
+
+func TestLoadWithFlagsAndDefaults(t *testing.T) {
+	engine, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("ENGINE_PATH", filepath.Join(t.TempDir(), "no-such-engine"))
+	t.Setenv("ENGINE_NUMBER_OF_MOVES", "")
+
+	// The flag beats the environment's bad path; the default fills the gap.
+	cfg, err := LoadWith(map[string]string{"ENGINE_PATH": engine}, map[string]string{"ENGINE_PATH": "stockfish", "ENGINE_NUMBER_OF_MOVES": "40"}, SectionEngine)
+	if err != nil {
+		t.Fatalf("LoadWith: %v", err)
+	}
+	if cfg.Engine.Path != engine || cfg.Engine.NumMoves != 40 {
+		t.Fatalf("engine = %+v", cfg.Engine)
+	}
+
+	t.Setenv("ENGINE_NUMBER_OF_MOVES", "12")
+	cfg, err = LoadWith(map[string]string{"ENGINE_PATH": engine}, map[string]string{"ENGINE_NUMBER_OF_MOVES": "40"}, SectionEngine)
+	if err != nil || cfg.Engine.NumMoves != 12 {
+		t.Fatalf("the environment should beat a default: %+v, %v", cfg, err)
+	}
+}
+
+func TestEffectiveRedactsSecrets(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", "postgres://app:hunter2@db:5432/chess?sslmode=require")
+	t.Setenv("STRIPE_SECRET_KEY", "sk_live_123")
+	t.Setenv("FRONTEND_URL", "https://app.test")
+
+	settings, err := Effective("", SectionDB, SectionStripe)
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	byEnv := map[string]Setting{}
+	for _, s := range settings {
+		byEnv[s.Env] = s
+	}
+	if v := byEnv["POSTGRES_DSN"].Value; strings.Contains(v, "hunter2") || !strings.Contains(v, "db:5432/chess") {
+		t.Fatalf("DSN not redacted properly: %q", v)
+	}
+	if byEnv["STRIPE_SECRET_KEY"].Value != redacted || byEnv["FRONTEND_URL"].Value != "https://app.test" {
+		t.Fatalf("unexpected values %+v", byEnv)
+	}
+	if s := byEnv["POSTGRES_MAX_OPEN_CONNS"]; s.Value != "10" || s.Source != "default" {
+		t.Fatalf("default not reported: %+v", s)
+	}
+	if got := redact("POSTGRES_DSN", "host=db password='s3 cret' dbname=x"); strings.Contains(got, "s3") {
+		t.Fatalf("key=value DSN not redacted: %q", got)
+	}
+}
+
+func TestLoadMetricsReadyAddrDefault(t *testing.T) {
+	t.Setenv("METRICS_ADDR", "")
+	t.Setenv("READY_ADDR", "")
+	cfg, err := LoadFrom("", SectionMetrics)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Metrics.Addr != "" || cfg.Metrics.ReadyAddr != ":8081" {
+		t.Fatalf("metrics = %+v, want no metrics listener and /ready on :8081", cfg.Metrics)
+	}
+}
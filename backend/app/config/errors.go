@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is one missing or invalid setting, named by its environment variable.
+type FieldError struct {
+	Section Section
+	Env     string
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Env, e.Section, e.Problem)
+}
+
+// ValidationError collects every FieldError found while loading, so one run
+// reports all of them.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		lines[i] = "  " + f.Error()
+	}
+	return fmt.Sprintf("invalid config (%d problems):\n%s", len(e.Fields), strings.Join(lines, "\n"))
+}
+
+// Unwrap exposes the individual problems to errors.As and errors.Is.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, f := range e.Fields {
+		errs[i] = f
+	}
+	return errs
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one configuration value: its key in a config file section, the
+// environment variable that overrides it, and its default.
+type setting struct {
+	Section Section
+	Key     string
+	Env     string
+	Default string
+	Secret  bool
+}
+
+var settings = []setting{
+	{Section: SectionLogs, Key: "style", Env: "LOG_STYLE"},
+	{Section: SectionLogs, Key: "level", Env: "LOG_LEVEL"},
+
+	{Section: SectionStore, Key: "driver", Env: "STORE_DRIVER", Default: "postgres"},
+	{Section: SectionStore, Key: "sqlite_path", Env: "SQLITE_PATH", Default: "chessgaps.db"},
+
+	{Section: SectionDB, Key: "dsn", Env: "POSTGRES_DSN", Secret: true},
+	{Section: SectionDB, Key: "user", Env: "POSTGRES_USER"},
+	{Section: SectionDB, Key: "password", Env: "POSTGRES_PWD", Secret: true},
+	{Section: SectionDB, Key: "host", Env: "POSTGRES_URL"},
+	{Section: SectionDB, Key: "port", Env: "POSTGRES_PORT"},
+	{Section: SectionDB, Key: "database", Env: "POSTGRES_DB"},
+	{Section: SectionDB, Key: "sslmode", Env: "POSTGRES_SSLMODE"},
+	{Section: SectionDB, Key: "sslrootcert", Env: "POSTGRES_SSLROOTCERT"},
+	{Section: SectionDB, Key: "statement_timeout", Env: "POSTGRES_STATEMENT_TIMEOUT"},
+	// Small pools by default: every Lambda container holds its own.
+	{Section: SectionDB, Key: "max_open_conns", Env: "POSTGRES_MAX_OPEN_CONNS", Default: "10"},
+	{Section: SectionDB, Key: "max_idle_conns", Env: "POSTGRES_MAX_IDLE_CONNS", Default: "5"},
+	{Section: SectionDB, Key: "conn_max_lifetime", Env: "POSTGRES_CONN_MAX_LIFETIME", Default: "30m"},
+	{Section: SectionDB, Key: "conn_max_idle_time", Env: "POSTGRES_CONN_MAX_IDLE_TIME", Default: "5m"},
+	{Section: SectionDB, Key: "connect_timeout", Env: "POSTGRES_CONNECT_TIMEOUT", Default: "30s"},
+
+	{Section: SectionEngine, Key: "path", Env: "ENGINE_PATH"},
+	{Section: SectionEngine, Key: "number_of_moves", Env: "ENGINE_NUMBER_OF_MOVES"},
+
+	{Section: SectionQueue, Key: "url", Env: "QUEUE_URL"},
+	// Kept under its original name; it has always sized the queued batches.
+	{Section: SectionQueue, Key: "batch_size", Env: "ENGINE_NUMBER_OF_GAMES", Default: "100"},
+
+	{Section: SectionStripe, Key: "secret_key", Env: "STRIPE_SECRET_KEY", Secret: true},
+	{Section: SectionStripe, Key: "price_id_pro_monthly", Env: "STRIPE_PRICE_ID_PRO_MONTHLY"},
+	{Section: SectionStripe, Key: "webhook_secret", Env: "STRIPE_WEBHOOK_SECRET", Secret: true},
+	{Section: SectionStripe, Key: "frontend_url", Env: "FRONTEND_URL"},
+
+	{Section: SectionMetrics, Key: "addr", Env: "METRICS_ADDR"},
+	{Section: SectionMetrics, Key: "ready_addr", Env: "READY_ADDR", Default: ":8081"},
+
+	// The standard OpenTelemetry variable names, so collector docs apply as-is.
+	{Section: SectionTracing, Key: "endpoint", Env: "OTEL_EXPORTER_OTLP_ENDPOINT"},
+	{Section: SectionTracing, Key: "service_name", Env: "OTEL_SERVICE_NAME"},
+	{Section: SectionTracing, Key: "sample_ratio", Env: "OTEL_TRACES_SAMPLE_RATIO", Default: "1"},
+}
+
+// source resolves a setting from a command's flags, the environment, the
+// config file, the command's own defaults, then the setting's default. An
+// empty environment variable counts as unset.
+type source struct {
+	file     map[string]string // by env name
+	flags    map[string]string // by env name
+	defaults map[string]string // by env name
+}
+
+func (s source) lookup(env string) (value, from string) {
+	if v, ok := s.flags[env]; ok {
+		return v, "flag"
+	}
+	if v := os.Getenv(env); v != "" {
+		return v, "env"
+	}
+	if v, ok := s.file[env]; ok {
+		return v, "file"
+	}
+	if v, ok := s.defaults[env]; ok {
+		return v, "default"
+	}
+	for _, st := range settings {
+		if st.Env == env && st.Default != "" {
+			return st.Default, "default"
+		}
+	}
+	return "", ""
+}
+
+func (s source) get(env string) string {
+	v, _ := s.lookup(env)
+	return v
+}
+
+// readFile parses a YAML (.yaml, .yml) or TOML (.toml) file of sections, e.g.
+//
+//	engine:
+//	  path: /usr/local/bin/stockfish
+//	  number_of_moves: 40
+//
+// Unknown sections and keys are errors so typos do not go unnoticed.
+func readFile(path string) (source, error) {
+	if path == "" {
+		return source{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return source{}, err
+	}
+
+	var raw map[string]map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return source{}, fmt.Errorf("config file %s: want a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return source{}, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	file := map[string]string{}
+	var unknown []string
+	for section, values := range raw {
+		for key, v := range values {
+			env := ""
+			for _, st := range settings {
+				if string(st.Section) == section && st.Key == key {
+					env = st.Env
+					break
+				}
+			}
+			if env == "" {
+				unknown = append(unknown, section+"."+key)
+				continue
+			}
+			file[env] = fmt.Sprint(v)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return source{}, fmt.Errorf("config file %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+	return source{file: file}, nil
+}
+
+// Setting is one effective value as reported by Effective.
+type Setting struct {
+	Section Section
+	Key     string
+	Env     string
+	Value   string // secrets are redacted
+	Source  string // "env", "file", "default" or "" when unset
+}
+
+// Effective lists the settings of the given sections (all when none) as Load
+// would resolve them from the file at path and the environment, with secrets
+// redacted.
+func Effective(path string, sections ...Section) ([]Setting, error) {
+	src, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	want := sectionSet(sections)
+	var out []Setting
+	for _, st := range settings {
+		if !want[st.Section] {
+			continue
+		}
+		v, from := src.lookup(st.Env)
+		if st.Secret {
+			v = redact(st.Env, v)
+		}
+		out = append(out, Setting{Section: st.Section, Key: st.Key, Env: st.Env, Value: v, Source: from})
+	}
+	return out, nil
+}
+
+const redacted = "REDACTED"
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// redact hides a secret value. DSNs keep everything but the password so the
+// host and options can still be checked.
+func redact(env, v string) string {
+	if v == "" {
+		return ""
+	}
+	if env != "POSTGRES_DSN" {
+		return redacted
+	}
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(v, "${1}"+redacted)
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPingWithRetry(t *testing.T) {
+	calls := 0
+	err := pingWithRetry(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, time.Millisecond)
+	if err != nil || calls != 3 {
+		t.Fatalf("pingWithRetry = %v after %d calls, want success on the third", err, calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	down := errors.New("connection refused")
+	if err := pingWithRetry(ctx, func(context.Context) error { return down }, time.Millisecond); !errors.Is(err, down) {
+		t.Fatalf("pingWithRetry should give up with the last error, got %v", err)
+	}
+}
@@ -0,0 +1,615 @@
+// Package app turns repeatedly misplayed positions into spaced-repetition drills.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Drill card states.
+const (
+	DrillActive  = "active"
+	DrillRetired = "retired"
+)
+
+const (
+	drillInitialEase = 2.5
+	drillMinEase     = 1.3
+	// A card whose next review would be this far out counts as mastered.
+	drillRetireIntervalDays = 21
+	drillDefaultQuality     = 4
+	drillFailQuality        = 1
+	drillDefaultDueLimit    = 20
+	drillMaxDueLimit        = 100
+	// Mate scores rank above any centipawn score when comparing lines.
+	mateScoreCP = 100000
+)
+
+// ErrDrillNotFound is returned when a drill card id doesn't exist.
+var ErrDrillNotFound = errors.New("drill card not found")
+
+// drillCandidate is a misplayed position from the user's games.
+type drillCandidate struct {
+	NormalizedFen string
+	SideToMove    string
+	BestMoveUCI   string
+	TimesSeen     int
+	ErrorCount    int
+	LastErrorAt   int64
+}
+
+// DrillSyncResult counts what a sync did to the user's cards.
+type DrillSyncResult struct {
+	Created     int `json:"created"`
+	Updated     int `json:"updated"`
+	Reactivated int `json:"reactivated"`
+	Total       int `json:"total"`
+}
+
+// SyncDrills creates cards for positions the user keeps misplaying and brings
+// back retired cards the user has misplayed again since. It accepts the error
+// report's filters.
+func (a *App) SyncDrills(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	filters, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	res, err := SyncDrillCards(ctx, a.Stores.Drills, username, filters, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetDueDrills lists the user's active cards due for review, most overdue first.
+func (a *App) GetDueDrills(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	limit := drillDefaultDueLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 && n <= drillMaxDueLimit {
+			limit = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cards, err := a.Stores.Drills.ListDueDrillCards(ctx, username, time.Now(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"username": username,
+		"cards":    cards,
+	})
+}
+
+type drillAnswerRequest struct {
+	MoveUCI string `json:"move_uci"`
+	// Optional self-rating for a correct answer, 3 (hard) to 5 (easy).
+	Quality int `json:"quality"`
+}
+
+// AnswerDrill checks a submitted UCI move against one of the user's cards and
+// schedules its next review. Another user's card id is not found.
+func (a *App) AnswerDrill(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drill id"})
+		return
+	}
+	var req drillAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	req.MoveUCI = strings.ToLower(strings.TrimSpace(req.MoveUCI))
+	if req.MoveUCI == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing move_uci"})
+		return
+	}
+	if req.Quality != 0 && (req.Quality < 3 || req.Quality > 5) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quality must be between 3 and 5"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	card, err := a.Stores.Drills.GetDrillCard(ctx, username, id)
+	if errors.Is(err, ErrDrillNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sanFromUCI(card.NormalizedFen, req.MoveUCI) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "illegal move in this position"})
+		return
+	}
+
+	correct := containsString(card.Answers, req.MoveUCI)
+	quality := drillFailQuality
+	if correct {
+		quality = drillDefaultQuality
+		if req.Quality != 0 {
+			quality = req.Quality
+		}
+	}
+	card = scheduleDrill(card, quality, time.Now())
+
+	if err := a.Stores.Drills.UpdateDrillSchedule(ctx, card); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := models.DrillAnswerResult{
+		Correct:   correct,
+		Submitted: req.MoveUCI,
+		Answers:   card.Answers,
+		AnswerSAN: []string{},
+		Card:      card,
+	}
+	for _, a := range card.Answers {
+		res.AnswerSAN = append(res.AnswerSAN, sanFromUCI(card.NormalizedFen, a))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleDrill applies SM-2 for a review graded quality (0-5; 3 and up is a
+// pass). A pass that pushes the interval past the retirement threshold retires
+// the card.
+func scheduleDrill(card models.DrillCard, quality int, now time.Time) models.DrillCard {
+	if card.Ease == 0 {
+		card.Ease = drillInitialEase
+	}
+
+	if quality >= 3 {
+		switch card.Repetitions {
+		case 0:
+			card.IntervalDays = 1
+		case 1:
+			card.IntervalDays = 6
+		default:
+			card.IntervalDays = int(math.Round(float64(card.IntervalDays) * card.Ease))
+		}
+		card.Repetitions++
+	} else {
+		card.Repetitions = 0
+		card.IntervalDays = 1
+		card.Lapses++
+	}
+
+	q := float64(5 - quality)
+	card.Ease += 0.1 - q*(0.08+q*0.02)
+	if card.Ease < drillMinEase {
+		card.Ease = drillMinEase
+	}
+
+	card.Reviews++
+	card.LastReviewAt = now.Unix()
+	card.DueAt = now.Add(time.Duration(card.IntervalDays) * 24 * time.Hour).Unix()
+	if quality >= 3 && card.IntervalDays >= drillRetireIntervalDays {
+		card.Status = DrillRetired
+	}
+	return card
+}
+
+// refreshDrillCard merges a fresh candidate into the user's existing card (nil
+// for a new one). A new error since the card's last known one resets it and
+// makes it due now, reactivating it if it had been retired.
+func refreshDrillCard(existing *models.DrillCard, cand drillCandidate, username string, now time.Time) (card models.DrillCard, reactivated bool) {
+	if existing == nil {
+		return models.DrillCard{
+			Username:      username,
+			NormalizedFen: cand.NormalizedFen,
+			SideToMove:    cand.SideToMove,
+			Answers:       []string{cand.BestMoveUCI},
+			TimesSeen:     cand.TimesSeen,
+			ErrorCount:    cand.ErrorCount,
+			LastErrorAt:   cand.LastErrorAt,
+			Status:        DrillActive,
+			Ease:          drillInitialEase,
+			DueAt:         now.Unix(),
+		}, false
+	}
+
+	card = *existing
+	// Keep alternatives found by a MultiPV pass unless the best move changed.
+	if len(card.Answers) == 0 || card.Answers[0] != cand.BestMoveUCI {
+		card.Answers = []string{cand.BestMoveUCI}
+	}
+	card.TimesSeen = cand.TimesSeen
+	card.ErrorCount = cand.ErrorCount
+
+	if cand.LastErrorAt > existing.LastErrorAt {
+		card.LastErrorAt = cand.LastErrorAt
+		if existing.Reviews > 0 {
+			reactivated = existing.Status == DrillRetired
+			card.Status = DrillActive
+			card.Repetitions = 0
+			card.IntervalDays = 0
+			card.Lapses++
+			card.DueAt = now.Unix()
+		}
+	}
+	return card, reactivated
+}
+
+// SyncDrillCards refreshes the user's cards from their error positions.
+func SyncDrillCards(ctx context.Context, store DrillStore, username string, filters ErrorPositionQuery, now time.Time) (DrillSyncResult, error) {
+	var res DrillSyncResult
+
+	cands, err := store.FindDrillCandidates(ctx, username, filters)
+	if err != nil {
+		return res, err
+	}
+	existing, err := store.LoadDrillCards(ctx, username)
+	if err != nil {
+		return res, err
+	}
+	byFEN := make(map[string]*models.DrillCard, len(existing))
+	for i := range existing {
+		byFEN[existing[i].NormalizedFen] = &existing[i]
+	}
+
+	cards := make([]models.DrillCard, 0, len(cands))
+	for _, cand := range cands {
+		old := byFEN[cand.NormalizedFen]
+		card, reactivated := refreshDrillCard(old, cand, username, now)
+		switch {
+		case old == nil:
+			res.Created++
+		case reactivated:
+			res.Reactivated++
+		default:
+			res.Updated++
+		}
+		cards = append(cards, card)
+	}
+	if err := store.SaveDrillCards(ctx, cards); err != nil {
+		return res, err
+	}
+	res.Total = len(existing) + res.Created
+	return res, nil
+}
+
+// ReactivateDrillCards refreshes the user's existing cards after new games are
+// analysed, so a card whose position was misplayed again comes back due now.
+// Unlike SyncDrillCards it creates no cards, and any error in a card's position
+// counts. It returns how many retired cards came back.
+func ReactivateDrillCards(ctx context.Context, store DrillStore, username string, now time.Time) (int, error) {
+	existing, err := store.LoadDrillCards(ctx, username)
+	if err != nil || len(existing) == 0 {
+		return 0, err
+	}
+	filters := DefaultErrorPositionQuery()
+	filters.MinTimesSeen, filters.MinErrors = 1, 1
+	filters.MoveMin, filters.MoveMax = 0, 0
+	filters.IncludeCustomStart = true
+	cands, err := store.FindDrillCandidates(ctx, username, filters)
+	if err != nil {
+		return 0, err
+	}
+	byFEN := make(map[string]drillCandidate, len(cands))
+	for _, cand := range cands {
+		byFEN[cand.NormalizedFen] = cand
+	}
+
+	var (
+		changed     []models.DrillCard
+		reactivated int
+	)
+	for i := range existing {
+		cand, ok := byFEN[existing[i].NormalizedFen]
+		if !ok || cand.LastErrorAt <= existing[i].LastErrorAt {
+			continue
+		}
+		card, back := refreshDrillCard(&existing[i], cand, username, now)
+		if back {
+			reactivated++
+		}
+		changed = append(changed, card)
+	}
+	return reactivated, store.SaveDrillCards(ctx, changed)
+}
+
+// drillAnswersFromLines picks the moves whose scores are within toleranceCP of
+// the best line. Lines must come from one MultiPV search, best first.
+func drillAnswersFromLines(lines []models.PVLine, toleranceCP int) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	top := comparableCP(lines[0].Score)
+	var out []string
+	for _, l := range lines {
+		if l.Score.Best == "" {
+			continue
+		}
+		if top-comparableCP(l.Score) <= toleranceCP {
+			out = append(out, l.Score.Best)
+		}
+	}
+	return out
+}
+
+// comparableCP maps a score to centipawns from the side to move, ranking faster
+// mates above slower ones and any mate above any centipawn score.
+func comparableCP(s models.UCIScore) int {
+	switch {
+	case s.Mate != nil && *s.Mate > 0:
+		return mateScoreCP - *s.Mate
+	case s.Mate != nil:
+		return -mateScoreCP - *s.Mate
+	case s.CP != nil:
+		return *s.CP
+	}
+	return 0
+}
+
+// ExpandDrillAnswers re-evaluates the user's active cards with MultiPV and
+// accepts every move within toleranceCP of the best one.
+func ExpandDrillAnswers(ctx context.Context, store DrillStore, eng *UCIEngine, username string, settings models.EngineSettings, multiPV, toleranceCP int) (int, error) {
+	cards, err := store.LoadDrillCards(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	var changed []models.DrillCard
+	for _, card := range cards {
+		if card.Status != DrillActive {
+			continue
+		}
+		lines, err := eng.EvalMultiPV(ctx, fullFEN(card.NormalizedFen), settings, multiPV)
+		if err != nil {
+			return 0, err
+		}
+		answers := drillAnswersFromLines(lines, toleranceCP)
+		if len(answers) == 0 {
+			continue
+		}
+		// The stored best move stays first; the engine may pick a different top
+		// move at another depth.
+		merged := []string{card.Answers[0]}
+		for _, a := range answers {
+			if !containsString(merged, a) {
+				merged = append(merged, a)
+			}
+		}
+		card.Answers = merged
+		changed = append(changed, card)
+	}
+	return len(changed), store.SaveDrillCards(ctx, changed)
+}
+
+// FindDrillCandidates returns positions the user misplayed often enough per
+// filters, with the engine's usual best move and when they last erred there.
+func (s *sqlStore) FindDrillCandidates(ctx context.Context, username string, filters ErrorPositionQuery) ([]drillCandidate, error) {
+	args := []any{username}
+	filterClauses, args := filters.filterSQL(args)
+	args = append(args, filters.MinTimesSeen, filters.MinErrors)
+	minSeenArg := "$" + strconv.Itoa(len(args)-1)
+	minErrorsArg := "$" + strconv.Itoa(len(args))
+
+	q := `
+WITH user_moves AS (
+    SELECT
+        m.normalized_fen_before,
+        m.color,
+        m.best_move_uci,
+        g.when_unix,
+        ` + filters.errorSQL() + ` AS is_error
+    FROM moves m
+    JOIN games g ON g.id = m.game_id
+    WHERE g.username  = $1
+      AND m.played_by = g.username` + filterClauses + `
+),
+best AS (` + commonBestMoveSQL("user_moves", "normalized_fen_before") + `
+)
+SELECT
+    u.normalized_fen_before,
+    MAX(u.color),
+    COALESCE(MAX(b.best_move_uci), ''),
+    COUNT(*),
+    SUM(CASE WHEN u.is_error THEN 1 ELSE 0 END),
+    COALESCE(MAX(CASE WHEN u.is_error THEN u.when_unix END), 0)
+FROM user_moves u
+LEFT JOIN best b ON b.normalized_fen_before = u.normalized_fen_before AND b.rn = 1
+GROUP BY u.normalized_fen_before
+HAVING COUNT(*) >= ` + minSeenArg + `
+   AND SUM(CASE WHEN u.is_error THEN 1 ELSE 0 END) >= ` + minErrorsArg + `;
+`
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []drillCandidate
+	for rows.Next() {
+		var d drillCandidate
+		if err := rows.Scan(&d.NormalizedFen, &d.SideToMove, &d.BestMoveUCI, &d.TimesSeen, &d.ErrorCount, &d.LastErrorAt); err != nil {
+			return nil, err
+		}
+		if d.BestMoveUCI == "" {
+			continue // nothing to check an answer against
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+const drillCardColumns = `
+    id, username, normalized_fen, side_to_move, answers, times_seen, error_count,
+    last_error_at, status, ease, interval_days, repetitions, lapses, reviews,
+    due_at, last_review_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDrillCard(row rowScanner) (models.DrillCard, error) {
+	var c models.DrillCard
+	err := row.Scan(
+		&c.ID, &c.Username, &c.NormalizedFen, &c.SideToMove, pq.Array(&c.Answers),
+		&c.TimesSeen, &c.ErrorCount, &c.LastErrorAt, &c.Status, &c.Ease,
+		&c.IntervalDays, &c.Repetitions, &c.Lapses, &c.Reviews, &c.DueAt, &c.LastReviewAt,
+	)
+	return c, err
+}
+
+func (s *sqlStore) queryDrillCards(ctx context.Context, q string, args ...any) ([]models.DrillCard, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.DrillCard{}
+	for rows.Next() {
+		c, err := scanDrillCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LoadDrillCards returns all of the user's cards.
+func (s *sqlStore) LoadDrillCards(ctx context.Context, username string) ([]models.DrillCard, error) {
+	return s.queryDrillCards(ctx, `SELECT`+drillCardColumns+`
+FROM drill_cards
+WHERE username = $1
+ORDER BY id;`, username)
+}
+
+// ListDueDrillCards returns the user's active cards due by now, most overdue first.
+func (s *sqlStore) ListDueDrillCards(ctx context.Context, username string, now time.Time, limit int) ([]models.DrillCard, error) {
+	return s.queryDrillCards(ctx, `SELECT`+drillCardColumns+`
+FROM drill_cards
+WHERE username = $1
+  AND status   = $2
+  AND due_at  <= $3
+ORDER BY due_at, id
+LIMIT $4;`, username, DrillActive, now.Unix(), limit)
+}
+
+// GetDrillCard loads one of username's cards by id.
+func (s *sqlStore) GetDrillCard(ctx context.Context, username string, id int64) (models.DrillCard, error) {
+	card, err := scanDrillCard(s.db.QueryRowContext(ctx, `SELECT`+drillCardColumns+`
+FROM drill_cards
+WHERE username = $1
+  AND id = $2;`, username, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return card, ErrDrillNotFound
+	}
+	return card, err
+}
+
+// SaveDrillCards upserts cards by (username, normalized_fen).
+func (s *sqlStore) SaveDrillCards(ctx context.Context, cards []models.DrillCard) error {
+	if len(cards) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO drill_cards (
+    username, normalized_fen, side_to_move, answers, times_seen, error_count,
+    last_error_at, status, ease, interval_days, repetitions, lapses, reviews,
+    due_at, last_review_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+ON CONFLICT (username, normalized_fen) DO UPDATE
+SET
+    answers        = EXCLUDED.answers,
+    times_seen     = EXCLUDED.times_seen,
+    error_count    = EXCLUDED.error_count,
+    last_error_at  = EXCLUDED.last_error_at,
+    status         = EXCLUDED.status,
+    ease           = EXCLUDED.ease,
+    interval_days  = EXCLUDED.interval_days,
+    repetitions    = EXCLUDED.repetitions,
+    lapses         = EXCLUDED.lapses,
+    reviews        = EXCLUDED.reviews,
+    due_at         = EXCLUDED.due_at,
+    last_review_at = EXCLUDED.last_review_at;
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range cards {
+		if _, err := stmt.ExecContext(ctx,
+			c.Username, c.NormalizedFen, c.SideToMove, pq.Array(c.Answers), c.TimesSeen, c.ErrorCount,
+			c.LastErrorAt, c.Status, c.Ease, c.IntervalDays, c.Repetitions, c.Lapses, c.Reviews,
+			c.DueAt, c.LastReviewAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateDrillSchedule stores a card's review state after an answer.
+func (s *sqlStore) UpdateDrillSchedule(ctx context.Context, c models.DrillCard) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE drill_cards
+SET status = $2, ease = $3, interval_days = $4, repetitions = $5, lapses = $6,
+    reviews = $7, due_at = $8, last_review_at = $9
+WHERE id = $1
+  AND username = $10;`,
+		c.ID, c.Status, c.Ease, c.IntervalDays, c.Repetitions, c.Lapses,
+		c.Reviews, c.DueAt, c.LastReviewAt, c.Username,
+	)
+	return err
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/models"
+)
+
+func TestScheduleDrillSM2(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	card := models.DrillCard{Status: DrillActive, Ease: drillInitialEase}
+
+	wantIntervals := []int{1, 6, 16}
+	for i, want := range wantIntervals {
+		card = scheduleDrill(card, 5, now)
+		if card.IntervalDays != want || card.Status != DrillActive {
+			t.Fatalf("review %d: interval %d status %s, want %d active", i+1, card.IntervalDays, card.Status, want)
+		}
+	}
+	if card.DueAt != now.Add(16*24*time.Hour).Unix() || card.Repetitions != 3 {
+		t.Fatalf("card after three passes = %+v", card)
+	}
+
+	card = scheduleDrill(card, 5, now)
+	if card.Status != DrillRetired {
+		t.Fatalf("card with interval %d should retire", card.IntervalDays)
+	}
+
+	failed := scheduleDrill(models.DrillCard{Ease: 1.4, Repetitions: 4, IntervalDays: 10}, drillFailQuality, now)
+	if failed.Repetitions != 0 || failed.IntervalDays != 1 || failed.Lapses != 1 || failed.Ease != drillMinEase {
+		t.Fatalf("failed card = %+v", failed)
+	}
+}
+
+func TestRefreshDrillCard(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cand := drillCandidate{NormalizedFen: "fen", SideToMove: "w", BestMoveUCI: "e2e4", TimesSeen: 5, ErrorCount: 3, LastErrorAt: 100}
+
+	card, _ := refreshDrillCard(nil, cand, "alice", now)
+	if card.Status != DrillActive || card.DueAt != now.Unix() || len(card.Answers) != 1 || card.Answers[0] != "e2e4" {
+		t.Fatalf("new card = %+v", card)
+	}
+
+	retired := models.DrillCard{
+		NormalizedFen: "fen", Answers: []string{"e2e4", "d2d4"}, Status: DrillRetired,
+		Repetitions: 5, IntervalDays: 40, Reviews: 5, LastErrorAt: 100, DueAt: now.Unix() + 1000,
+	}
+	same, reactivated := refreshDrillCard(&retired, cand, "alice", now)
+	if reactivated || same.Status != DrillRetired || len(same.Answers) != 2 {
+		t.Fatalf("no new error should leave the card alone: %+v", same)
+	}
+
+	cand.LastErrorAt = 200
+	back, reactivated := refreshDrillCard(&retired, cand, "alice", now)
+	if !reactivated || back.Status != DrillActive || back.Repetitions != 0 || back.DueAt != now.Unix() || back.Lapses != 1 {
+		t.Fatalf("new error should reactivate the card: %+v", back)
+	}
+
+	cand.BestMoveUCI = "g1f3"
+	changed, _ := refreshDrillCard(&retired, cand, "alice", now)
+	if len(changed.Answers) != 1 || changed.Answers[0] != "g1f3" {
+		t.Fatalf("answers should follow the new best move: %v", changed.Answers)
+	}
+}
+
+func TestDrillAnswersFromLines(t *testing.T) {
+	lines := []models.PVLine{
+		{MultiPV: 1, Score: models.UCIScore{CP: intPtr(50), Best: "e2e4"}},
+		{MultiPV: 2, Score: models.UCIScore{CP: intPtr(30), Best: "d2d4"}},
+		{MultiPV: 3, Score: models.UCIScore{CP: intPtr(-20), Best: "f2f3"}},
+	}
+	got := drillAnswersFromLines(lines, 25)
+	if len(got) != 2 || got[0] != "e2e4" || got[1] != "d2d4" {
+		t.Fatalf("answers = %v", got)
+	}
+
+	mates := []models.PVLine{
+		{MultiPV: 1, Score: models.UCIScore{Mate: intPtr(2), Best: "d1h5"}},
+		{MultiPV: 2, Score: models.UCIScore{Mate: intPtr(3), Best: "f1c4"}},
+		{MultiPV: 3, Score: models.UCIScore{CP: intPtr(900), Best: "b1c3"}},
+	}
+	got = drillAnswersFromLines(mates, 25)
+	if len(got) != 2 {
+		t.Fatalf("mate answers = %v", got)
+	}
+}
+
+func TestComparableCP(t *testing.T) {
+	if comparableCP(models.UCIScore{Mate: intPtr(1)}) <= comparableCP(models.UCIScore{Mate: intPtr(3)}) {
+		t.Fatalf("faster mate should rank higher")
+	}
+	if comparableCP(models.UCIScore{Mate: intPtr(-1)}) >= comparableCP(models.UCIScore{Mate: intPtr(-3)}) {
+		t.Fatalf("being mated sooner should rank lower")
+	}
+	if comparableCP(models.UCIScore{CP: intPtr(5000)}) >= comparableCP(models.UCIScore{Mate: intPtr(20)}) {
+		t.Fatalf("any mate should outrank centipawns")
+	}
+}
+
+func TestRouterRegistersDrillRoutes(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	if _, err := NewRouter(a); err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+}
+
+// fakeDrillStore serves one card and records schedule updates; the methods it
+// doesn't override panic through the nil embedded interface.
+type fakeDrillStore struct {
+	DrillStore
+	card    models.DrillCard
+	updated []models.DrillCard
+}
+
+func (f *fakeDrillStore) GetDrillCard(ctx context.Context, username string, id int64) (models.DrillCard, error) {
+	if username != f.card.Username || id != f.card.ID {
+		return models.DrillCard{}, ErrDrillNotFound
+	}
+	return f.card, nil
+}
+
+func (f *fakeDrillStore) UpdateDrillSchedule(ctx context.Context, card models.DrillCard) error {
+	f.updated = append(f.updated, card)
+	return nil
+}
+
+func TestAnswerDrillWithFakeStore(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	drills := &fakeDrillStore{card: models.DrillCard{
+		ID:            7,
+		Username:      "alice",
+		NormalizedFen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -",
+		Answers:       []string{"e2e4", "d2d4"},
+		Status:        DrillActive,
+		Ease:          drillInitialEase,
+	}}
+	a.Stores.Drills = drills
+	router, err := NewRouter(a)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	answer := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/drills/answer/"+path, strings.NewReader(body)))
+		return w
+	}
+
+	w := answer("Alice/7", `{"move_uci":"d2d4"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var res models.DrillAnswerResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !res.Correct || len(res.AnswerSAN) != 2 || res.AnswerSAN[1] != "d4" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if len(drills.updated) != 1 || drills.updated[0].Reviews != 1 || drills.updated[0].Repetitions != 1 {
+		t.Fatalf("schedule not stored: %+v", drills.updated)
+	}
+
+	if w := answer("alice/8", `{"move_uci":"e2e4"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown card status = %d", w.Code)
+	}
+	if w := answer("bob/7", `{"move_uci":"e2e4"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("another user's card status = %d", w.Code)
+	}
+	if len(drills.updated) != 1 {
+		t.Fatalf("another user's answer rescheduled the card: %+v", drills.updated)
+	}
+	if w := answer("alice/7", `{"move_uci":"e2e5"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("illegal move status = %d", w.Code)
+	}
+}
+
+func TestProcessBatchReactivatesRetiredDrills(t *testing.T) {
+	a := &App{
+		Config:  &config.Config{Engine: config.EngineConfig{Path: writeEngine(t, lossyEngine), NumMoves: 10}},
+		Workers: 1,
+		Stores:  StoresFrom(newTestSQLiteStore(t)),
+	}
+	ctx := context.Background()
+	settings := models.EngineSettings{MoveTimeMS: 10}
+	game := func(date string) string {
+		return "[White \"Alice\"]\n[Black \"bob\"]\n[Date \"" + date + "\"]\n[Result \"0-1\"]\n\n1. e4 e5 0-1\n\n"
+	}
+	analyse := func(source, pgn string) {
+		t.Helper()
+		if _, err := a.AnalyzePGNFile(ctx, pgn, "Alice", source, settings, DefaultErrorPositionQuery()); err != nil {
+			t.Fatalf("AnalyzePGNFile %s: %v", source, err)
+		}
+	}
+
+	// The lossy engine makes 1. e4 a mistake every time.
+	analyse("old.pgn", game("2024.01.01")+game("2024.01.02"))
+	q := DefaultErrorPositionQuery()
+	q.MinTimesSeen, q.MinErrors = 1, 1
+	if res, err := SyncDrillCards(ctx, a.Stores.Drills, "alice", q, time.Now()); err != nil || res.Created != 1 {
+		t.Fatalf("SyncDrillCards = %+v, %v", res, err)
+	}
+	cards, _ := a.Stores.Drills.LoadDrillCards(ctx, "alice")
+	cards[0].Status, cards[0].Reviews, cards[0].IntervalDays = DrillRetired, 5, 30
+	if err := a.Stores.Drills.SaveDrillCards(ctx, cards); err != nil {
+		t.Fatalf("SaveDrillCards: %v", err)
+	}
+
+	analyse("new.pgn", game("2024.02.01"))
+	cards, err := a.Stores.Drills.LoadDrillCards(ctx, "alice")
+	if err != nil || len(cards) != 1 {
+		t.Fatalf("LoadDrillCards = %+v, %v", cards, err)
+	}
+	if c := cards[0]; c.Status != DrillActive || c.Lapses != 1 || c.IntervalDays != 0 || c.ErrorCount != 3 {
+		t.Fatalf("repeated error should reactivate the card, got %+v", c)
+	}
+}
@@ -0,0 +1,120 @@
+// Package eco classifies games by opening using the Lichess chess-openings book
+// (https://github.com/lichess-org/chess-openings, CC0) compiled into the binary.
+package eco
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/notnil/chess"
+)
+
+//go:embed openings.tsv
+var openingsTSV []byte
+
+// Opening is one named book position.
+type Opening struct {
+	ECO  string `json:"eco"`
+	Name string `json:"name"`
+	Ply  int    `json:"ply"` // plies from the initial position to the book line's final position
+}
+
+// Book looks openings up by position rather than move order, so transpositions
+// land on the same entry.
+type Book struct {
+	byPosition map[string]Opening
+}
+
+var (
+	defaultBook     *Book
+	defaultBookErr  error
+	defaultBookOnce sync.Once
+)
+
+// Default returns the embedded book, parsed on first use.
+func Default() (*Book, error) {
+	defaultBookOnce.Do(func() {
+		defaultBook, defaultBookErr = Parse(openingsTSV)
+	})
+	return defaultBook, defaultBookErr
+}
+
+// Parse reads a chess-openings TSV with eco, name, pgn, uci and epd columns.
+func Parse(tsv []byte) (*Book, error) {
+	r := csv.NewReader(bytes.NewReader(tsv))
+	r.Comma = '\t'
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("eco: empty opening book")
+	}
+
+	b := &Book{byPosition: make(map[string]Opening, len(records))}
+	for i, row := range records {
+		if i == 0 {
+			continue
+		}
+		if len(row) < 5 {
+			return nil, fmt.Errorf("eco: row %d has %d columns, want 5", i+1, len(row))
+		}
+		key := positionKey(row[4])
+		o := Opening{ECO: row[0], Name: row[1], Ply: len(strings.Fields(row[3]))}
+		// Several lines can reach the same position; keep the shortest (most general) one.
+		if prev, ok := b.byPosition[key]; ok && prev.Ply <= o.Ply {
+			continue
+		}
+		b.byPosition[key] = o
+	}
+	return b, nil
+}
+
+// Lookup returns the book opening for a FEN or EPD, if any.
+func (b *Book) Lookup(fen string) (Opening, bool) {
+	o, ok := b.byPosition[positionKey(fen)]
+	return o, ok
+}
+
+// Classify walks the positions of a game and returns the deepest one found in the
+// book. The returned Ply is the ply in the game where that position was reached.
+func (b *Book) Classify(positions []*chess.Position) (Opening, bool) {
+	var (
+		best  Opening
+		found bool
+	)
+	for i, pos := range positions {
+		if o, ok := b.Lookup(pos.String()); ok {
+			best = o
+			best.Ply = i
+			found = true
+		}
+	}
+	return best, found
+}
+
+// ClassifyPGN parses a standard-start PGN and classifies it.
+func (b *Book) ClassifyPGN(pgn string) (Opening, bool, error) {
+	g := chess.NewGame()
+	if err := g.UnmarshalText([]byte(pgn)); err != nil {
+		return Opening{}, false, err
+	}
+	o, ok := b.Classify(g.Positions())
+	return o, ok, nil
+}
+
+// positionKey keeps piece placement, side to move and castling rights. The
+// en-passant field is dropped because the book only records it when a capture
+// is possible while notnil/chess records it after every double push.
+func positionKey(fen string) string {
+	parts := strings.Fields(fen)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, " ")
+}
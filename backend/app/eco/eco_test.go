@@ -0,0 +1,67 @@
+package eco
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestDefaultBookLoads(t *testing.T) {
+	book, err := Default()
+	if err != nil {
+		t.Fatalf("Default error: %v", err)
+	}
+	if len(book.byPosition) < 1000 {
+		t.Fatalf("expected the full opening book, got %d positions", len(book.byPosition))
+	}
+}
+
+func TestClassifyPGNReturnsDeepestMatch(t *testing.T) {
+	book, err := Default()
+	if err != nil {
+		t.Fatalf("Default error: %v", err)
+	}
+	o, ok, err := book.ClassifyPGN("1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. h3 h6 *")
+	if err != nil || !ok {
+		t.Fatalf("ClassifyPGN = ok %v err %v", ok, err)
+	}
+	if o.ECO != "B90" || o.Name != "Sicilian Defense: Najdorf Variation, Adams Attack" || o.Ply != 11 {
+		t.Fatalf("ClassifyPGN = %+v", o)
+	}
+}
+
+func TestClassifyHandlesTranspositions(t *testing.T) {
+	book, err := Default()
+	if err != nil {
+		t.Fatalf("Default error: %v", err)
+	}
+	// 1. Nf3 d5 2. d4 reaches the same position as 1. d4 d5 2. Nf3.
+	g := chess.NewGame()
+	for _, mv := range []string{"d4", "d5", "Nf3"} {
+		if err := g.MoveStr(mv); err != nil {
+			t.Fatalf("move %s: %v", mv, err)
+		}
+	}
+	direct, ok := book.Classify(g.Positions())
+	if !ok {
+		t.Fatalf("direct order not classified")
+	}
+
+	transposed, ok, err := book.ClassifyPGN("1. Nf3 d5 2. d4 *")
+	if err != nil || !ok {
+		t.Fatalf("ClassifyPGN transposed = ok %v err %v", ok, err)
+	}
+	if transposed.ECO != direct.ECO || transposed.Name != direct.Name {
+		t.Fatalf("transposition mismatch: %+v vs %+v", transposed, direct)
+	}
+}
+
+func TestClassifyOffBook(t *testing.T) {
+	book, err := Default()
+	if err != nil {
+		t.Fatalf("Default error: %v", err)
+	}
+	if _, ok := book.Classify(chess.NewGame().Positions()); ok {
+		t.Fatalf("initial position alone should not classify")
+	}
+}
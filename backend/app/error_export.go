@@ -0,0 +1,293 @@
+// Package app exports the error-position report as PGN, EPD or CSV.
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const errorExportURLs = 5
+
+var errorExportContentTypes = map[string]string{
+	"pgn": "application/x-chess-pgn",
+	"epd": "text/plain; charset=utf-8",
+	"csv": "text/csv; charset=utf-8",
+}
+
+// playedMove is one of the moves the user chose in an error position.
+type playedMove struct {
+	UCI   string
+	SAN   string
+	Count int
+}
+
+// errorExport is one report row flattened for the export formats.
+type errorExport struct {
+	Stats   models.SuboptimalFen
+	FEN     string // full FEN of the most recent game, for [FEN] set-up
+	BestUCI string
+	BestSAN string
+	Played  []playedMove // most frequent first
+	URLs    []string
+}
+
+// ExportErrorPositions returns the error report in ?format=pgn|epd|csv. It
+// takes the same filters as GET /errors/:username and exports one page.
+func (a *App) ExportErrorPositions(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "pgn"))
+	contentType, ok := errorExportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of pgn, epd, csv"})
+		return
+	}
+	query, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	reports, nextCursor, err := a.Stores.Moves.FindErrorPositions(ctx, username, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := make([]errorExport, 0, len(reports))
+	for _, r := range reports {
+		rows = append(rows, buildErrorExport(r))
+	}
+
+	var body []byte
+	switch format {
+	case "pgn":
+		body = []byte(errorPositionsPGN(username, rows))
+	case "epd":
+		body = []byte(errorPositionsEPD(username, rows))
+	case "csv":
+		body, err = errorPositionsCSV(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-errors.%s"`, username, format))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// buildErrorExport picks the engine's usual best move, groups the played moves
+// and collects example URLs, newest first.
+func buildErrorExport(r models.SuboptimalFensReport) errorExport {
+	e := errorExport{
+		Stats: r.BadFen,
+		FEN:   fullFEN(r.BadFen.NormalizedFenBefore),
+	}
+
+	bestCounts := map[string]int{}
+	played := map[string]*playedMove{}
+	seenURL := map[string]bool{}
+	for i, m := range r.Moves {
+		if i == 0 && m.FenBefore.FEN != "" {
+			e.FEN = m.FenBefore.FEN
+		}
+		if m.FenBefore.Score.Best != "" {
+			bestCounts[m.FenBefore.Score.Best]++
+		}
+		if p, ok := played[m.MoveUCI]; ok {
+			p.Count++
+		} else {
+			played[m.MoveUCI] = &playedMove{UCI: m.MoveUCI, SAN: m.MoveSAN, Count: 1}
+		}
+		if m.URL != "" && !seenURL[m.URL] && len(e.URLs) < errorExportURLs {
+			seenURL[m.URL] = true
+			e.URLs = append(e.URLs, m.URL)
+		}
+	}
+
+	for uci, n := range bestCounts {
+		if n > bestCounts[e.BestUCI] || (n == bestCounts[e.BestUCI] && uci < e.BestUCI) {
+			e.BestUCI = uci
+		}
+	}
+	e.BestSAN = sanFromUCI(e.Stats.NormalizedFenBefore, e.BestUCI)
+
+	for _, p := range played {
+		if p.UCI == e.BestUCI {
+			continue // flagged by eval noise at shallow depth; not a move to avoid
+		}
+		if p.SAN == "" {
+			p.SAN = sanFromUCI(e.Stats.NormalizedFenBefore, p.UCI)
+		}
+		e.Played = append(e.Played, *p)
+	}
+	sort.Slice(e.Played, func(i, j int) bool {
+		if e.Played[i].Count != e.Played[j].Count {
+			return e.Played[i].Count > e.Played[j].Count
+		}
+		return e.Played[i].UCI < e.Played[j].UCI
+	})
+	return e
+}
+
+// errorPositionsPGN writes one game per position, set up from its FEN, with the
+// best move as the main line and each played move as a variation.
+func errorPositionsPGN(username string, rows []errorExport) string {
+	var sb strings.Builder
+	for i, e := range rows {
+		for _, tag := range [][2]string{
+			{"Event", fmt.Sprintf("%s error position %d", username, i+1)},
+			{"Site", "?"},
+			{"Date", "????.??.??"},
+			{"Round", strconv.Itoa(i + 1)},
+			{"White", "?"},
+			{"Black", "?"},
+			{"Result", "*"},
+			{"SetUp", "1"},
+			{"FEN", e.FEN},
+		} {
+			fmt.Fprintf(&sb, "[%s %q]\n", tag[0], tag[1])
+		}
+		sb.WriteString("\n")
+
+		tokens := []string{"{" + errorExportComment(e) + "}"}
+		number := fenMoveNumber(e.FEN)
+		mainWritten := false
+		if e.BestSAN != "" {
+			tokens = append(tokens, number, e.BestSAN, "{engine best move}")
+			mainWritten = true
+		}
+		for _, p := range e.Played {
+			moveTokens := []string{number, p.SAN, fmt.Sprintf("{played %d times}", p.Count)}
+			if !mainWritten {
+				tokens = append(tokens, moveTokens...)
+				mainWritten = true
+				continue
+			}
+			tokens = append(tokens, "(")
+			tokens = append(tokens, moveTokens...)
+			tokens = append(tokens, ")")
+		}
+		tokens = append(tokens, "*")
+
+		sb.WriteString(wrapPGNTokens(tokens, pgnLineWidth))
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+// fenMoveNumber is the PGN move number prefix for the side to move in fen.
+func fenMoveNumber(fen string) string {
+	fields := strings.Fields(fen)
+	number := "1"
+	if len(fields) >= 6 {
+		number = fields[5]
+	}
+	if len(fields) >= 2 && fields[1] == "b" {
+		return number + "..."
+	}
+	return number + "."
+}
+
+func errorExportComment(e errorExport) string {
+	parts := []string{
+		fmt.Sprintf("TimesSeen %d", e.Stats.TimesSeen),
+		fmt.Sprintf("ErrorCount %d", e.Stats.ErrorCount),
+		fmt.Sprintf("ErrorRate %.0f%%", e.Stats.ErrorRate*100),
+		fmt.Sprintf("TotalCPLost %d", e.Stats.TotalCPLost),
+	}
+	if len(e.URLs) > 0 {
+		parts = append(parts, "Games "+strings.Join(e.URLs, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// errorPositionsEPD writes one EPD record per position with the best move as
+// bm and the user's erroneous moves as am.
+func errorPositionsEPD(username string, rows []errorExport) string {
+	var sb strings.Builder
+	for i, e := range rows {
+		sb.WriteString(e.Stats.NormalizedFenBefore)
+		if e.BestSAN != "" {
+			fmt.Fprintf(&sb, " bm %s;", e.BestSAN)
+		}
+		var avoid []string
+		for _, p := range e.Played {
+			if p.SAN != "" {
+				avoid = append(avoid, p.SAN)
+			}
+		}
+		if len(avoid) > 0 {
+			fmt.Fprintf(&sb, " am %s;", strings.Join(avoid, " "))
+		}
+		fmt.Fprintf(&sb, ` id "%s.%d";`, username, i+1)
+		fmt.Fprintf(&sb, ` c0 "TimesSeen %d ErrorRate %.2f";`, e.Stats.TimesSeen, e.Stats.ErrorRate)
+		if len(e.URLs) > 0 {
+			fmt.Fprintf(&sb, ` c1 "%s";`, e.URLs[0])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// errorPositionsCSV writes one flat row per position; list columns are space separated.
+func errorPositionsCSV(rows []errorExport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{
+		"normalized_fen", "side_to_move", "times_seen", "error_count", "error_rate",
+		"blunders", "mistakes", "inaccuracies", "total_cp_lost", "last_seen",
+		"best_move_uci", "best_move_san", "played_moves_uci", "played_moves_san", "game_urls",
+	}); err != nil {
+		return nil, err
+	}
+	for _, e := range rows {
+		var ucis, sans []string
+		for _, p := range e.Played {
+			ucis = append(ucis, p.UCI)
+			sans = append(sans, p.SAN)
+		}
+		if err := w.Write([]string{
+			e.Stats.NormalizedFenBefore,
+			e.Stats.SideToMove,
+			strconv.Itoa(e.Stats.TimesSeen),
+			strconv.Itoa(e.Stats.ErrorCount),
+			strconv.FormatFloat(e.Stats.ErrorRate, 'f', 4, 64),
+			strconv.Itoa(e.Stats.BlunderCount),
+			strconv.Itoa(e.Stats.MistakeCount),
+			strconv.Itoa(e.Stats.InaccuracyCount),
+			strconv.Itoa(e.Stats.TotalCPLost),
+			strconv.FormatInt(e.Stats.LastSeen, 10),
+			e.BestUCI,
+			e.BestSAN,
+			strings.Join(ucis, " "),
+			strings.Join(sans, " "),
+			strings.Join(e.URLs, " "),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"example/my-go-api/app/models"
+)
+
+func testErrorReport() models.SuboptimalFensReport {
+	fen := "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"
+	move := func(uci, san, url string) models.Move {
+		return models.Move{
+			MoveUCI:   uci,
+			MoveSAN:   san,
+			URL:       url,
+			FenBefore: models.FENEval{FEN: fen, Score: models.UCIScore{Best: "f1b5"}},
+		}
+	}
+	return models.SuboptimalFensReport{
+		BadFen: models.SuboptimalFen{
+			NormalizedFenBefore: NormalizeFEN(fen),
+			SideToMove:          "w",
+			TimesSeen:           5,
+			ErrorCount:          3,
+			ErrorRate:           0.6,
+			TotalCPLost:         150,
+		},
+		Moves: []models.Move{
+			move("h2h3", "h3", "https://lichess.org/a"),
+			move("h2h3", "h3", "https://lichess.org/b"),
+			move("a2a3", "", "https://lichess.org/c"),
+		},
+	}
+}
+
+func TestBuildErrorExport(t *testing.T) {
+	e := buildErrorExport(testErrorReport())
+	if e.BestUCI != "f1b5" || e.BestSAN != "Bb5" {
+		t.Fatalf("best move = %s/%s", e.BestUCI, e.BestSAN)
+	}
+	if len(e.Played) != 2 || e.Played[0].SAN != "h3" || e.Played[0].Count != 2 || e.Played[1].SAN != "a3" {
+		t.Fatalf("played = %+v", e.Played)
+	}
+	if len(e.URLs) != 3 || !strings.HasSuffix(e.FEN, " 2 3") {
+		t.Fatalf("export = %+v", e)
+	}
+}
+
+func TestErrorPositionsPGN(t *testing.T) {
+	pgn := errorPositionsPGN("alice", []errorExport{buildErrorExport(testErrorReport())})
+	flat := strings.ReplaceAll(pgn, "\n", " ")
+	for _, want := range []string{
+		`[SetUp "1"]`,
+		`[FEN "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"]`,
+		"TimesSeen 5; ErrorCount 3; ErrorRate 60%",
+		"3. Bb5 {engine best move} ( 3. h3 {played 2 times} ) ( 3. a3 {played 1 times} ) *",
+	} {
+		if !strings.Contains(flat, want) {
+			t.Fatalf("PGN missing %q:\n%s", want, pgn)
+		}
+	}
+	// Every exported game must parse back from its FEN.
+	if _, err := parsePGNTree(pgn); err != nil {
+		t.Fatalf("exported PGN does not parse: %v\n%s", err, pgn)
+	}
+}
+
+func TestErrorPositionsEPD(t *testing.T) {
+	epd := errorPositionsEPD("alice", []errorExport{buildErrorExport(testErrorReport())})
+	want := `r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5; am h3 a3; id "alice.1"; c0 "TimesSeen 5 ErrorRate 0.60"; c1 "https://lichess.org/a";` + "\n"
+	if epd != want {
+		t.Fatalf("EPD =\n%s\nwant\n%s", epd, want)
+	}
+}
+
+func TestErrorPositionsCSV(t *testing.T) {
+	body, err := errorPositionsCSV([]errorExport{buildErrorExport(testErrorReport())})
+	if err != nil {
+		t.Fatalf("errorPositionsCSV: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV does not parse: %v", err)
+	}
+	if len(records) != 2 || len(records[0]) != len(records[1]) {
+		t.Fatalf("records = %v", records)
+	}
+	row := map[string]string{}
+	for i, h := range records[0] {
+		row[h] = records[1][i]
+	}
+	if row["times_seen"] != "5" || row["best_move_san"] != "Bb5" || row["played_moves_uci"] != "h2h3 a2a3" {
+		t.Fatalf("row = %v", row)
+	}
+}
+
+func TestFenMoveNumber(t *testing.T) {
+	if got := fenMoveNumber("8/8/8/8/8/8/8/8 b - - 0 12"); got != "12..." {
+		t.Fatalf("fenMoveNumber black = %q", got)
+	}
+	if got := fenMoveNumber("8/8/8/8/8/8/8/8 w - -"); got != "1." {
+		t.Fatalf("fenMoveNumber normalized = %q", got)
+	}
+}
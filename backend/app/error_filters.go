@@ -0,0 +1,301 @@
+// Package app parses and compiles the error-position report filters into SQL.
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultErrorPositionLimit = 100
+	maxErrorPositionLimit     = 500
+)
+
+// Error severities, mildest first. Filtering by a severity counts it and everything worse.
+const (
+	SeveritySuboptimal = "suboptimal"
+	SeverityInaccuracy = "inaccuracy"
+	SeverityMistake    = "mistake"
+	SeverityBlunder    = "blunder"
+)
+
+var severityErrorSQL = map[string]string{
+	SeveritySuboptimal: "(m.is_suboptimal OR m.is_inaccuracy OR m.is_mistake OR m.is_blunder)",
+	SeverityInaccuracy: "(m.is_inaccuracy OR m.is_mistake OR m.is_blunder)",
+	SeverityMistake:    "(m.is_mistake OR m.is_blunder)",
+	SeverityBlunder:    "(m.is_blunder)",
+}
+
+// Report orderings; every one sorts descending.
+const (
+	SortErrorRate = "error_rate"
+	SortCPLost    = "cp_lost"
+	SortFrequency = "frequency"
+	SortRecency   = "recency"
+)
+
+var sortKeySQL = map[string]string{
+	SortErrorRate: "error_rate",
+	SortCPLost:    "CAST(total_cp_lost AS DOUBLE PRECISION)",
+	SortFrequency: "CAST(times_seen AS DOUBLE PRECISION)",
+	SortRecency:   "CAST(last_seen AS DOUBLE PRECISION)",
+}
+
+// ErrorPositionQuery narrows and orders the error-position report. The zero value
+// of each filter means "no filter"; DefaultErrorPositionQuery holds the original rules.
+type ErrorPositionQuery struct {
+	TimeClass          string // bullet, blitz, rapid, daily, ...
+	Color              string // "white" or "black"
+	RatedOnly          bool
+	From               int64  // unix seconds, inclusive
+	To                 int64  // unix seconds, exclusive
+	Opening            string // ECO code, or prefix of the opening name or family
+	OppRatingMin       int
+	OppRatingMax       int
+	MinTimesSeen       int
+	MinErrors          int
+	MinSeverity        string
+	MoveMin            int
+	MoveMax            int
+	IncludeCustomStart bool
+	GameIDs            []int // only these games; not settable from the query string
+
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// DefaultErrorPositionQuery reproduces the report's original fixed rules:
+// first ten moves, seen three times, misplayed at least twice.
+func DefaultErrorPositionQuery() ErrorPositionQuery {
+	return ErrorPositionQuery{
+		MinTimesSeen: 3,
+		MinErrors:    2,
+		MinSeverity:  SeveritySuboptimal,
+		MoveMin:      1,
+		MoveMax:      10,
+		Sort:         SortErrorRate,
+		Limit:        defaultErrorPositionLimit,
+	}
+}
+
+// errorPositionCursor is the keyset position of the last row on a page.
+type errorPositionCursor struct {
+	SortKey float64 `json:"k"`
+	FEN     string  `json:"f"`
+}
+
+func encodeErrorPositionCursor(c errorPositionCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeErrorPositionCursor(s string) (errorPositionCursor, error) {
+	var c errorPositionCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// parseErrorPositionQuery reads the report filters from the query string.
+func parseErrorPositionQuery(c *gin.Context) (ErrorPositionQuery, error) {
+	q := DefaultErrorPositionQuery()
+
+	q.TimeClass = strings.ToLower(strings.TrimSpace(c.Query("time_class")))
+	q.Opening = strings.TrimSpace(c.Query("opening"))
+	q.Cursor = c.Query("cursor")
+
+	if v := strings.ToLower(c.Query("color")); v != "" {
+		if v != "white" && v != "black" {
+			return q, fmt.Errorf("color must be white or black")
+		}
+		q.Color = v
+	}
+
+	bools := []struct {
+		name string
+		dst  *bool
+	}{
+		{"rated", &q.RatedOnly},
+		{"include_custom_start", &q.IncludeCustomStart},
+	}
+	for _, b := range bools {
+		if v := c.Query(b.name); v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be a boolean", b.name)
+			}
+			*b.dst = parsed
+		}
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"opp_rating_min", &q.OppRatingMin},
+		{"opp_rating_max", &q.OppRatingMax},
+		{"min_seen", &q.MinTimesSeen},
+		{"min_errors", &q.MinErrors},
+		{"move_min", &q.MoveMin},
+		{"move_max", &q.MoveMax},
+		{"limit", &q.Limit},
+	}
+	for _, i := range ints {
+		if v := c.Query(i.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", i.name)
+			}
+			*i.dst = n
+		}
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultErrorPositionLimit
+	}
+	if q.Limit > maxErrorPositionLimit {
+		q.Limit = maxErrorPositionLimit
+	}
+	if q.MinTimesSeen < 1 {
+		q.MinTimesSeen = 1
+	}
+
+	dates := []struct {
+		name string
+		dst  *int64
+	}{
+		{"from", &q.From},
+		{"to", &q.To},
+	}
+	for _, d := range dates {
+		if v := c.Query(d.name); v != "" {
+			ts, err := parseReportDate(v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be a unix timestamp or YYYY-MM-DD", d.name)
+			}
+			*d.dst = ts
+		}
+	}
+
+	if v := strings.ToLower(c.Query("min_severity")); v != "" {
+		if _, ok := severityErrorSQL[v]; !ok {
+			return q, fmt.Errorf("min_severity must be one of suboptimal, inaccuracy, mistake, blunder")
+		}
+		q.MinSeverity = v
+	}
+	if v := strings.ToLower(c.Query("sort")); v != "" {
+		if _, ok := sortKeySQL[v]; !ok {
+			return q, fmt.Errorf("sort must be one of error_rate, cp_lost, frequency, recency")
+		}
+		q.Sort = v
+	}
+	if q.Cursor != "" {
+		if _, err := decodeErrorPositionCursor(q.Cursor); err != nil {
+			return q, err
+		}
+	}
+
+	return q, nil
+}
+
+// parseReportDate accepts unix seconds or a YYYY-MM-DD date (UTC midnight).
+func parseReportDate(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// errorSQL is the boolean expression for "this move counts as an error".
+// Missed wins are reported on their own, so they never count.
+func (q ErrorPositionQuery) errorSQL() string {
+	expr, ok := severityErrorSQL[q.MinSeverity]
+	if !ok {
+		expr = severityErrorSQL[SeveritySuboptimal]
+	}
+	return "(" + expr + " AND NOT COALESCE(m.is_missed_win, FALSE))"
+}
+
+func (q ErrorPositionQuery) sortSQL() string {
+	if expr, ok := sortKeySQL[q.Sort]; ok {
+		return expr
+	}
+	return sortKeySQL[SortErrorRate]
+}
+
+// filterSQL renders the game and move filters as "AND ..." clauses over the
+// aliases g (games) and m (moves), appending their values to args.
+func (q ErrorPositionQuery) filterSQL(args []any) (string, []any) {
+	var sb strings.Builder
+	add := func(clause string, vals ...any) {
+		placeholders := make([]any, len(vals))
+		for i, v := range vals {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		sb.WriteString("\n  AND ")
+		sb.WriteString(fmt.Sprintf(clause, placeholders...))
+	}
+
+	if !q.IncludeCustomStart {
+		sb.WriteString("\n  AND g.start_fen IS NULL")
+	}
+	if len(q.GameIDs) > 0 {
+		sb.WriteString("\n  AND g.id IN (" + intList(q.GameIDs) + ")")
+	}
+	if q.MoveMin > 0 {
+		add("m.move_number >= %s", q.MoveMin)
+	}
+	if q.MoveMax > 0 {
+		add("m.move_number <= %s", q.MoveMax)
+	}
+	if q.TimeClass != "" {
+		add("g.time_class = %s", q.TimeClass)
+	}
+	if q.Color != "" {
+		add("g.color = %s", q.Color)
+	}
+	if q.RatedOnly {
+		sb.WriteString("\n  AND g.rated")
+	}
+	if q.From > 0 {
+		add("g.when_unix >= %s", q.From)
+	}
+	if q.To > 0 {
+		add("g.when_unix < %s", q.To)
+	}
+	if q.Opening != "" {
+		add(`(g.eco_code = %s OR LOWER(g.opening_name) LIKE LOWER(%s) ESCAPE '\' OR LOWER(g.opening_family) LIKE LOWER(%s) ESCAPE '\')`,
+			q.Opening, likePrefix(q.Opening), likePrefix(q.Opening))
+	}
+	if q.OppRatingMin > 0 {
+		add("g.opponent_rating >= %s", q.OppRatingMin)
+	}
+	if q.OppRatingMax > 0 {
+		add("g.opponent_rating <= %s", q.OppRatingMax)
+	}
+
+	return sb.String(), args
+}
+
+// likePrefix is a LIKE pattern matching values that start with s, with the
+// wildcards in s escaped for ESCAPE '\'.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
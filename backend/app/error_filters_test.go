@@ -0,0 +1,101 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newQueryContext(rawQuery string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/errors/alice?"+rawQuery, nil)
+	return c
+}
+
+func TestParseErrorPositionQueryDefaults(t *testing.T) {
+	q, err := parseErrorPositionQuery(newQueryContext(""))
+	if err != nil {
+		t.Fatalf("parseErrorPositionQuery error: %v", err)
+	}
+	if !reflect.DeepEqual(q, DefaultErrorPositionQuery()) {
+		t.Fatalf("defaults = %+v, want %+v", q, DefaultErrorPositionQuery())
+	}
+}
+
+func TestParseErrorPositionQueryFilters(t *testing.T) {
+	q, err := parseErrorPositionQuery(newQueryContext(
+		"time_class=Blitz&color=black&rated=true&from=2024-01-01&to=1735689600&opening=B90" +
+			"&opp_rating_min=1500&opp_rating_max=1800&min_seen=5&min_severity=mistake&move_min=3&move_max=15&sort=cp_lost&limit=1000",
+	))
+	if err != nil {
+		t.Fatalf("parseErrorPositionQuery error: %v", err)
+	}
+	if q.TimeClass != "blitz" || q.Color != "black" || !q.RatedOnly || q.Opening != "B90" {
+		t.Fatalf("string filters = %+v", q)
+	}
+	if q.From != 1704067200 || q.To != 1735689600 {
+		t.Fatalf("date range = %d..%d", q.From, q.To)
+	}
+	if q.OppRatingMin != 1500 || q.OppRatingMax != 1800 || q.MinTimesSeen != 5 || q.MoveMin != 3 || q.MoveMax != 15 {
+		t.Fatalf("numeric filters = %+v", q)
+	}
+	if q.MinSeverity != SeverityMistake || q.Sort != SortCPLost || q.Limit != maxErrorPositionLimit {
+		t.Fatalf("severity/sort/limit = %+v", q)
+	}
+}
+
+func TestParseErrorPositionQueryRejectsBadInput(t *testing.T) {
+	for _, raw := range []string{"color=green", "rated=maybe", "min_seen=-1", "from=yesterday", "min_severity=awful", "sort=random", "cursor=not-a-cursor!"} {
+		if _, err := parseErrorPositionQuery(newQueryContext(raw)); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestErrorPositionQueryFilterSQL(t *testing.T) {
+	q := DefaultErrorPositionQuery()
+	q.TimeClass = "rapid"
+	q.Opening = "Sicilian"
+
+	sql, args := q.filterSQL([]any{"alice"})
+	for _, want := range []string{
+		"g.start_fen IS NULL",
+		"m.move_number >= $2",
+		"m.move_number <= $3",
+		"g.time_class = $4",
+		`(g.eco_code = $5 OR LOWER(g.opening_name) LIKE LOWER($6) ESCAPE '\' OR LOWER(g.opening_family) LIKE LOWER($7) ESCAPE '\')`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("filterSQL missing %q in %s", want, sql)
+		}
+	}
+	if len(args) != 7 || args[4] != "Sicilian" || args[5] != "Sicilian%" {
+		t.Fatalf("filterSQL args = %v", args)
+	}
+}
+
+func TestLikePrefixEscapesWildcards(t *testing.T) {
+	for in, want := range map[string]string{
+		"Sicilian": `Sicilian%`,
+		"%":        `\%%`,
+		"a_b":      `a\_b%`,
+		`c:\x`:     `c:\\x%`,
+	} {
+		if got := likePrefix(in); got != want {
+			t.Fatalf("likePrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestErrorPositionCursorRoundTrip(t *testing.T) {
+	in := errorPositionCursor{SortKey: 2.0 / 3.0, FEN: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3"}
+	out, err := decodeErrorPositionCursor(encodeErrorPositionCursor(in))
+	if err != nil || out != in {
+		t.Fatalf("cursor round trip = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package app serves the personal opening explorer built from analysed moves.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/notnil/chess"
+)
+
+// GetExplorerPosition returns every move the user has played from ?fen= (the
+// initial position when omitted), merged across transpositions. It accepts the
+// same game filters as the error report (time_class, color, rated, from, to, ...).
+func (a *App) GetExplorerPosition(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+
+	fen := strings.TrimSpace(c.Query("fen"))
+	if fen == "" {
+		fen = chess.StartingPosition().String()
+	}
+	if _, err := chess.FEN(fullFEN(fen)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fen"})
+		return
+	}
+
+	filters, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The explorer looks at every move of every game, not just the opening window.
+	filters.MoveMin, filters.MoveMax = 0, 0
+	filters.IncludeCustomStart = true
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	pos, err := a.Stores.Reports.FindExplorerPosition(ctx, username, fen, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"username": username,
+		"position": pos,
+	})
+}
+
+// FindExplorerPosition aggregates the user's moves from a position by
+// normalized_fen_before, with results, average eval after the move and the
+// engine's most common best move.
+func (s *sqlStore) FindExplorerPosition(ctx context.Context, username, fen string, filters ErrorPositionQuery) (models.ExplorerPosition, error) {
+	normalized := NormalizeFEN(fen)
+	pos := models.ExplorerPosition{
+		FEN:   normalized,
+		Moves: []models.ExplorerMove{},
+	}
+	if parts := strings.Fields(normalized); len(parts) > 1 {
+		pos.SideToMove = parts[1]
+	}
+
+	args := []any{username, normalized}
+	filterClauses, args := filters.filterSQL(args)
+
+	q := `
+WITH pos_moves AS (
+    SELECT
+        m.move_uci,
+        m.move_san,
+        m.eval_after_cp,
+        m.best_move_uci,
+        ` + ErrorPositionQuery{}.errorSQL() + ` AS is_error,
+        CASE WHEN ` + sqlIsWin + `  THEN 1 ELSE 0 END AS win,
+        CASE WHEN ` + sqlIsDraw + ` THEN 1 ELSE 0 END AS draw,
+        CASE WHEN ` + sqlIsLoss + ` THEN 1 ELSE 0 END AS loss
+    FROM moves m
+    JOIN games g ON g.id = m.game_id
+    WHERE g.username              = $1
+      AND m.played_by             = g.username
+      AND m.normalized_fen_before = $2` + filterClauses + `
+),
+best AS (` + commonBestMoveSQL("pos_moves") + `
+)
+SELECT
+    move_uci,
+    MAX(move_san),
+    COUNT(*),
+    SUM(win),
+    SUM(draw),
+    SUM(loss),
+    -- eval_after_cp is from the opponent's side (they are to move), so flip it
+    CAST(AVG(-eval_after_cp) AS DOUBLE PRECISION),
+    SUM(CASE WHEN is_error THEN 1 ELSE 0 END),
+    COALESCE((SELECT best_move_uci FROM best WHERE rn = 1), '')
+FROM pos_moves
+GROUP BY move_uci
+ORDER BY COUNT(*) DESC, move_uci;
+`
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return pos, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			mv      models.ExplorerMove
+			san     sql.NullString
+			avgEval sql.NullFloat64
+		)
+		if err := rows.Scan(
+			&mv.MoveUCI,
+			&san,
+			&mv.Count,
+			&mv.Wins,
+			&mv.Draws,
+			&mv.Losses,
+			&avgEval,
+			&mv.ErrorCount,
+			&pos.BestMoveUCI,
+		); err != nil {
+			return pos, err
+		}
+		mv.MoveSAN = san.String
+		if avgEval.Valid {
+			v := avgEval.Float64
+			mv.AvgEvalAfterCP = &v
+		}
+		pos.Moves = append(pos.Moves, mv)
+	}
+	if err := rows.Err(); err != nil {
+		return pos, err
+	}
+
+	finishExplorerPosition(&pos)
+	return pos, nil
+}
+
+// finishExplorerPosition fills totals, scores, the best-move flag and SAN.
+func finishExplorerPosition(pos *models.ExplorerPosition) {
+	pos.Total = 0
+	for i := range pos.Moves {
+		mv := &pos.Moves[i]
+		pos.Total += mv.Count
+		if mv.Count > 0 {
+			mv.Score = (float64(mv.Wins) + float64(mv.Draws)/2) / float64(mv.Count)
+		}
+		mv.IsBest = mv.MoveUCI == pos.BestMoveUCI
+		if mv.MoveSAN == "" {
+			mv.MoveSAN = sanFromUCI(pos.FEN, mv.MoveUCI)
+		}
+	}
+	pos.BestMoveSAN = sanFromUCI(pos.FEN, pos.BestMoveUCI)
+}
+
+// fullFEN pads a normalized (four-field) FEN with move counters so it parses.
+func fullFEN(fen string) string {
+	if len(strings.Fields(fen)) == 4 {
+		return fen + " 0 1"
+	}
+	return fen
+}
+
+// sanFromUCI converts a UCI move to SAN in the given position, or "" if it doesn't apply.
+func sanFromUCI(fen, uci string) string {
+	if uci == "" {
+		return ""
+	}
+	opt, err := chess.FEN(fullFEN(fen))
+	if err != nil {
+		return ""
+	}
+	pos := chess.NewGame(opt).Position()
+	if m := findMoveByUCI(pos, uci); m != nil {
+		return chess.AlgebraicNotation{}.Encode(pos, m)
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+
+	"example/my-go-api/app/models"
+)
+
+func TestSanFromUCI(t *testing.T) {
+	start := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -"
+	if got := sanFromUCI(start, "g1f3"); got != "Nf3" {
+		t.Fatalf("sanFromUCI g1f3 = %q, want Nf3", got)
+	}
+	if got := sanFromUCI(start, "e2e5"); got != "" {
+		t.Fatalf("sanFromUCI illegal move should be empty, got %q", got)
+	}
+	if got := sanFromUCI("not a fen", "e2e4"); got != "" {
+		t.Fatalf("sanFromUCI bad fen should be empty, got %q", got)
+	}
+}
+
+func TestFinishExplorerPosition(t *testing.T) {
+	pos := models.ExplorerPosition{
+		FEN:         "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3",
+		BestMoveUCI: "c7c5",
+		Moves: []models.ExplorerMove{
+			{MoveUCI: "e7e5", Count: 6, Wins: 3, Draws: 2, Losses: 1},
+			{MoveUCI: "c7c5", MoveSAN: "c5", Count: 2, Wins: 2},
+		},
+	}
+	finishExplorerPosition(&pos)
+
+	if pos.Total != 8 || pos.BestMoveSAN != "c5" {
+		t.Fatalf("position totals = %+v", pos)
+	}
+	if pos.Moves[0].MoveSAN != "e5" || pos.Moves[0].IsBest || pos.Moves[0].Score != 4.0/6.0 {
+		t.Fatalf("e5 row = %+v", pos.Moves[0])
+	}
+	if !pos.Moves[1].IsBest || pos.Moves[1].Score != 1 {
+		t.Fatalf("c5 row = %+v", pos.Moves[1])
+	}
+}
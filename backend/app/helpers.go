@@ -10,6 +10,8 @@ import (
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/notnil/chess"
 )
 
 type TagSummary struct {
@@ -42,6 +44,7 @@ var (
 	reNAG      = regexp.MustCompile(`\$\d+`)           // $1, $2, etc.
 	reSpaces   = regexp.MustCompile(`\s+`)
 	reEcoMoves = regexp.MustCompile(`-\d.*`)
+	reTagPair  = regexp.MustCompile(`(?m)^\[(\w+)\s+"(.*)"\]`)
 )
 
 // layout for unix timestamp conversion
@@ -56,6 +59,26 @@ func NormalizeChessDotComPGN(pgn string) string {
 	return pgn
 }
 
+// PGNTag returns the value of the named tag pair (e.g. "FEN") or "" if absent.
+func PGNTag(pgn, key string) string {
+	for _, m := range reTagPair.FindAllStringSubmatch(pgn, -1) {
+		if m[1] == key {
+			return m[2]
+		}
+	}
+	return ""
+}
+
+// StartFENFromPGN returns the FEN a game was set up from, or "" when it starts
+// from the standard initial position.
+func StartFENFromPGN(pgn string) string {
+	fen := strings.TrimSpace(PGNTag(pgn, "FEN"))
+	if fen == "" || NormalizeFEN(fen) == NormalizeFEN(chess.StartingPosition().String()) {
+		return ""
+	}
+	return fen
+}
+
 func derivePOV(username string, g models.Game) (color, opponent string, oppRating int, result string) {
 	u := strings.ToLower(username)
 	if strings.ToLower(g.White.Username) == u {
@@ -143,3 +143,28 @@ func TestNormalizeECO(t *testing.T) {
 		t.Fatalf("NormalizeECO empty should be empty, got %q", got)
 	}
 }
+
+func TestPGNTag(t *testing.T) {
+	pgn := "[Event \"Live Chess\"]\n[SetUp \"1\"]\n[FEN \"8/8/8/8/8/8/8/K6k w - - 0 1\"]\n\n1. Kb2 *"
+	if got, want := PGNTag(pgn, "FEN"), "8/8/8/8/8/8/8/K6k w - - 0 1"; got != want {
+		t.Fatalf("PGNTag FEN = %q, want %q", got, want)
+	}
+	if got := PGNTag(pgn, "ECO"); got != "" {
+		t.Fatalf("PGNTag missing tag should be empty, got %q", got)
+	}
+}
+
+func TestStartFENFromPGN(t *testing.T) {
+	custom := "[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1\"]\n\n1. e4 *"
+	if got, want := StartFENFromPGN(custom), "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"; got != want {
+		t.Fatalf("StartFENFromPGN custom = %q, want %q", got, want)
+	}
+
+	standard := "[SetUp \"1\"]\n[FEN \"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1\"]\n\n1. e4 *"
+	if got := StartFENFromPGN(standard); got != "" {
+		t.Fatalf("StartFENFromPGN standard start should be empty, got %q", got)
+	}
+	if got := StartFENFromPGN("1. e4 e5 *"); got != "" {
+		t.Fatalf("StartFENFromPGN without tags should be empty, got %q", got)
+	}
+}
@@ -8,24 +8,53 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
 	"example/my-go-api/app/models"
+	"example/my-go-api/app/tracing"
 	"example/my-go-api/auth"
 
-	aws "github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var httpc = &http.Client{Timeout: 15 * time.Second}
+// Names of the game providers, as passed in ?provider=.
+const (
+	ProviderChessCom = "chesscom"
+	ProviderLichess  = "lichess"
+)
+
+// GameProvider fetches a player's recent games from an online service.
+type GameProvider interface {
+	// FetchGames returns the games of the last months months, newest first,
+	// at most limit of them when limit > 0. Unknown players give errUserNotFound.
+	FetchGames(ctx context.Context, username string, months, limit int) ([]models.GameLite, error)
+}
+
+// DefaultProviders returns the Chess.com and Lichess clients sharing client.
+func DefaultProviders(client *http.Client) map[string]GameProvider {
+	return map[string]GameProvider{
+		ProviderChessCom: ChessComClient{HTTP: client},
+		ProviderLichess:  LichessClient{HTTP: client},
+	}
+}
+
+// ChessComClient reads the public Chess.com monthly archives.
+type ChessComClient struct {
+	HTTP *http.Client
+}
+
+// LichessClient reads the Lichess game export API.
+type LichessClient struct {
+	HTTP *http.Client
+}
 
 type archiveIndex struct {
 	Archives []string `json:"archives"`
@@ -35,7 +64,7 @@ type monthlyGames struct {
 	Games []models.Game `json:"games"`
 }
 
-func GetChessGames(c *gin.Context) {
+func (a *App) GetChessGames(c *gin.Context) {
 	username := strings.ToLower(c.Param("username"))
 	if username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
@@ -69,88 +98,51 @@ func GetChessGames(c *gin.Context) {
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 25*time.Second)
 	defer cancel()
+	ctx = logging.With(ctx, "user", username)
+	logger := logging.FromContext(ctx)
 
-	var out []models.GameLite
-	provider := strings.ToLower(strings.TrimSpace(c.Query("provider")))
-	if provider == "lichess" {
-		lichessGames, err := fetchLichessGames(ctx, username, months, limit)
-		if err != nil {
-			status := http.StatusInternalServerError
-			if errors.Is(err, errUserNotFound) {
-				status = http.StatusNotFound
-			}
-			c.JSON(status, gin.H{"error": err.Error()})
-			return
-		}
-		out = lichessGames
-	} else {
-		archives, err := fetchArchives(ctx, username)
-		if err != nil {
-			status := http.StatusInternalServerError
-			if errors.Is(err, errUserNotFound) {
-				status = http.StatusNotFound
-			}
-			c.JSON(status, gin.H{"error": err.Error()})
-			return
-		}
-		if len(archives) == 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"username": username,
-				"count":    0,
-			})
-			return
-		}
-
-		// Take last N months (archives are chronological)
-		start := len(archives) - months
-		if start < 0 {
-			start = 0
-		}
-		target := archives[start:]
-
-		for i := len(target) - 1; i >= 0; i-- { // newest first
-			monthURL := target[i]
-			mg, err := fetchMonthly(ctx, monthURL)
-			if err != nil {
-				// soft-fail a month; you could also collect and return partial errors
-				continue
-			}
-			for _, g := range mg.Games {
-				color, opp, oppRating, result := derivePOV(username, g)
-				eco := NormalizeECO(g.ECO)
-				out = append(out, models.GameLite{
-					URL:         g.URL,
-					When:        g.EndTime,
-					Color:       color,
-					Opponent:    opp,
-					OppRating:   oppRating,
-					Result:      result,
-					Rated:       g.Rated,
-					TimeClass:   g.TimeClass,
-					TimeControl: g.TimeControl,
-					PGN:         g.PGN,
-					ECO:         eco,
-				})
-			}
+	providerName := ProviderChessCom
+	if strings.ToLower(strings.TrimSpace(c.Query("provider"))) == ProviderLichess {
+		providerName = ProviderLichess
+	}
+	provider, ok := a.Providers[providerName]
+	if !ok {
+		logger.Error("game provider not configured", "provider", providerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "provider not configured"})
+		return
+	}
+	fetchStart := time.Now()
+	fetchCtx, span := tracing.Start(ctx, "provider.fetch", trace.WithAttributes(
+		attribute.String("provider", providerName), attribute.Int("months", months)))
+	out, err := provider.FetchGames(fetchCtx, username, months, limit)
+	tracing.End(span, err)
+	metrics.ProviderFetchDuration.WithLabelValues(providerName).Observe(time.Since(fetchStart).Seconds())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errUserNotFound) {
+			status = http.StatusNotFound
+		} else {
+			metrics.ProviderFetchErrors.WithLabelValues(providerName).Inc()
+			logger.Warn("provider fetch failed", "provider", providerName, "err", err)
 		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
 	}
 
+	// Drop variants we can't analyse (bughouse, crazyhouse, ...) and let the client know how many.
+	out, skippedVariants := filterSupportedVariants(out)
+	fillMissingOpenings(ctx, out)
+
 	if len(out) == 0 {
 		c.JSON(http.StatusOK, gin.H{
-			"username": username,
-			"count":    0,
+			"username":         username,
+			"count":            0,
+			"skipped_variants": skippedVariants,
 		})
 		return
 	}
 
-	// ---- load config for limits + queue URL ----
-
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Printf("LoadConfig failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load config"})
-		return
-	}
+	cfg := a.Config
 	engineSettings := models.EngineSettings{}
 	if v := c.Query("engine_depth"); v != "" {
 		if d, err := parsePositiveInt(v); err == nil {
@@ -173,9 +165,11 @@ func GetChessGames(c *gin.Context) {
 	}
 	gamesToSave := out[:limit]
 
-	_, err = enforceWeeklyQuota(c.Request.Context(), claims.Subject, len(gamesToSave))
+	stores := a.Stores
+	user, err := enforceWeeklyQuota(c.Request.Context(), stores.Users, claims.Subject, len(gamesToSave))
 	if err != nil {
 		if qe, ok := err.(quotaError); ok {
+			metrics.QuotaRejections.Inc()
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":        "quota_exceeded",
 				"message":      "Free users can analyze up to 100 games per week.",
@@ -184,20 +178,23 @@ func GetChessGames(c *gin.Context) {
 			})
 			return
 		}
-		log.Printf("failed to enforce quota: %v", err)
+		logger.Error("failed to enforce quota", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify quota"})
 		return
 	}
 
 	// Save games
-	if err := saveGames(ctx, username, gamesToSave); err != nil {
-		log.Printf("saveGames failed for %s: %v", username, err)
+	saveCtx, span := tracing.Start(ctx, "saveGames", trace.WithAttributes(attribute.Int("games", len(gamesToSave))))
+	err = stores.Games.SaveGames(saveCtx, username, gamesToSave)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("saveGames failed", "err", err)
 		// not fatal for the endpoint, we still return a 200 w/ games
 	}
 
 	// ---- compute batches and create a job row ----
 
-	batchSize := cfg.Engine.NumGames // games per worker/batch
+	batchSize := cfg.Queue.BatchSize // games per worker/batch
 	if batchSize <= 0 {
 		batchSize = 100 // sane fallback
 	}
@@ -209,89 +206,61 @@ func GetChessGames(c *gin.Context) {
 		batchSize = limit
 	}
 
-	// Record that a job has begun
-	user, err := getUserByAuth0Sub(ctx, claims.Subject)
+	// Record that a job has begun; the quota check above resolved the user.
+	jobCtx, span := tracing.Start(ctx, "job.create")
+	jobID, err := stores.Jobs.CreateJob(jobCtx, username, user.ID, limit, batchSize, totalBatches)
+	span.SetAttributes(attribute.String("job_id", jobID), attribute.Int("batches", totalBatches))
+	tracing.End(span, err)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			_ = UpsertUserFromClaims(ctx, claims)
-			user, err = getUserByAuth0Sub(ctx, claims.Subject)
-		}
-		if err != nil {
-			log.Printf("failed to resolve user id for sub=%s: %v", claims.Subject, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
-			return
-		}
-	}
-
-	jobID, err := CreateJob(ctx, username, user.ID, limit, batchSize, totalBatches)
-	if err != nil {
-		log.Printf("failed to create job for user=%s: %v", username, err)
+		logger.Error("failed to create job", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
 		return
 	}
 
-	// ---- enqueue SQS jobs with that jobID ----
+	// ---- enqueue one message per batch with that jobID ----
 
-	if cfg.QueueURL == "" {
-		log.Printf("QUEUE_URL missing in config; cannot enqueue for user=%s", username)
+	if a.Queue == nil {
+		logger.Error("no job queue configured (QUEUE_URL); cannot enqueue")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
 		return
 	}
 	if jobID == "" {
-		log.Printf("jobID empty; skipping enqueue for user=%s", username)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
-		return
-	}
-
-	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Printf("failed to load AWS config for SQS: %v", err)
+		logger.Error("jobID empty; skipping enqueue")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
 		return
 	}
 
-	sqsClient := sqs.NewFromConfig(awsCfg)
 	for batchIndex := 0; batchIndex < totalBatches; batchIndex++ {
 		jobMsg := models.JobMessage{
 			User:           username,
 			BatchIndex:     batchIndex,
 			NumGames:       batchSize,
 			JobID:          jobID, // <-- UUID from DB
+			RequestID:      logging.RequestID(ctx),
 			EngineDepth:    engineSettings.Depth,
 			EngineMoveTime: engineSettings.MoveTimeMS,
 			EngineUseDepth: engineSettings.UseDepth,
 		}
 
-		body, err := json.Marshal(jobMsg)
-		if err != nil {
-			log.Printf("failed to marshal JobMessage for user=%s batch=%d: %v",
-				username, batchIndex, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
-			return
-		}
-
-		_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-			QueueUrl:    &cfg.QueueURL,
-			MessageBody: aws.String(string(body)),
-		})
-		if err != nil {
-			log.Printf("failed to send SQS message for user=%s batch=%d: %v",
-				username, batchIndex, err)
+		if err := a.enqueue(ctx, jobMsg); err != nil {
+			logger.Error("failed to enqueue job", "job_id", jobID, "batch_index", batchIndex, "err", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin analysis"})
 			return
 		}
+		metrics.QueueMessages.WithLabelValues("enqueued").Inc()
 	}
 
 	// ---- Response: send back the games we actually saved/are processing ----
 	c.IndentedJSON(http.StatusOK, gin.H{
-		"username": username,
-		"count":    len(gamesToSave),
-		"job_id":   jobID,
-		"batches":  totalBatches,
+		"username":         username,
+		"count":            len(gamesToSave),
+		"job_id":           jobID,
+		"batches":          totalBatches,
+		"skipped_variants": skippedVariants,
 	})
 }
 
-func fetchLichessGames(ctx context.Context, username string, months, maxGames int) ([]models.GameLite, error) {
+func (lc LichessClient) FetchGames(ctx context.Context, username string, months, maxGames int) ([]models.GameLite, error) {
 	base := fmt.Sprintf("https://lichess.org/api/games/user/%s", url.PathEscape(username))
 	params := url.Values{}
 	params.Set("pgnInJson", "true")
@@ -312,7 +281,7 @@ func fetchLichessGames(ctx context.Context, username string, months, maxGames in
 	}
 	req.Header.Set("Accept", "application/x-ndjson")
 
-	res, err := httpc.Do(req)
+	res, err := lc.HTTP.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -404,6 +373,9 @@ func mapLichessGame(username string, g models.LichessGame) (models.GameLite, boo
 		TimeControl: timeControl,
 		PGN:         g.PGN,
 		ECO:         eco,
+		Variant:     lichessVariant(g.Variant),
+		StartFEN:    StartFENFromPGN(g.PGN),
+		OpeningInfo: openingFromLichess(g),
 	}, true
 }
 
@@ -424,33 +396,52 @@ func lichessResultForUser(winner string, color string) string {
 	return "loss"
 }
 
-// GetErrorPositions returns a slice of error positions for the given user.
-// It relies on a db function that will be implemented later.
-func GetErrorPositions(c *gin.Context) {
+// GetErrorPositions returns a page of error positions for the given user, narrowed
+// and sorted by the query-string filters (see parseErrorPositionQuery).
+func (a *App) GetErrorPositions(c *gin.Context) {
 	username := strings.ToLower(c.Param("username"))
 	if username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
 		return
 	}
 
+	// Games set up from a custom FEN are left out unless include_custom_start is set.
+	query, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	positions, err := FindErrorPositions(ctx, username)
+	positions, nextCursor, err := a.Stores.Moves.FindErrorPositions(ctx, username, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"username":  username,
-		"count":     len(positions),
-		"positions": positions,
+		"username":    username,
+		"count":       len(positions),
+		"positions":   positions,
+		"next_cursor": nextCursor,
 	})
 }
 
+// enqueue sends one batch under its own producer span, whose context rides
+// along in the message so the worker's spans join the request's trace.
+func (a *App) enqueue(ctx context.Context, msg models.JobMessage) error {
+	ctx, span := tracing.Start(ctx, "queue.enqueue", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("job_id", msg.JobID), attribute.Int("batch_index", msg.BatchIndex)))
+	msg.TraceContext = tracing.Inject(ctx)
+	err := a.Queue.Enqueue(ctx, msg)
+	tracing.End(span, err)
+	return err
+}
+
 // GetGamesCount returns a count of stored games for a user.
-func GetGamesCount(c *gin.Context) {
+func (a *App) GetGamesCount(c *gin.Context) {
 	username := strings.ToLower(c.Param("username"))
 	if username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
@@ -460,9 +451,9 @@ func GetGamesCount(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	count, err := CountGames(ctx, username)
+	count, err := a.Stores.Games.CountGames(ctx, username)
 	if err != nil {
-		log.Printf("count games failed for %s: %v", username, err)
+		logging.FromContext(ctx).Error("count games failed", "user", username, "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count games"})
 		return
 	}
@@ -474,7 +465,7 @@ func GetGamesCount(c *gin.Context) {
 }
 
 // GetJobStatus returns status and batch progress for a job.
-func GetJobStatus(c *gin.Context) {
+func (a *App) GetJobStatus(c *gin.Context) {
 	jobID := c.Param("jobid")
 	if jobID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing job id"})
@@ -484,7 +475,7 @@ func GetJobStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	status, err := FindJobStatus(ctx, jobID)
+	status, err := a.Stores.Jobs.FindJobStatus(ctx, jobID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
@@ -501,10 +492,55 @@ func GetJobStatus(c *gin.Context) {
 
 var errUserNotFound = errors.New("user not found")
 
-func fetchArchives(ctx context.Context, username string) ([]string, error) {
+func (cc ChessComClient) FetchGames(ctx context.Context, username string, months, limit int) ([]models.GameLite, error) {
+	archives, err := cc.fetchArchives(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take last N months (archives are chronological)
+	start := len(archives) - months
+	if start < 0 {
+		start = 0
+	}
+	target := archives[start:]
+
+	var out []models.GameLite
+	for i := len(target) - 1; i >= 0; i-- { // newest first
+		monthURL := target[i]
+		mg, err := cc.fetchMonthly(ctx, monthURL)
+		if err != nil {
+			// soft-fail a month; you could also collect and return partial errors
+			continue
+		}
+		for _, g := range mg.Games {
+			color, opp, oppRating, result := derivePOV(username, g)
+			eco := NormalizeECO(g.ECO)
+			out = append(out, models.GameLite{
+				URL:         g.URL,
+				When:        g.EndTime,
+				Color:       color,
+				Opponent:    opp,
+				OppRating:   oppRating,
+				Result:      result,
+				Rated:       g.Rated,
+				TimeClass:   g.TimeClass,
+				TimeControl: g.TimeControl,
+				PGN:         g.PGN,
+				ECO:         eco,
+				Variant:     chessDotComVariant(g.Rules),
+				StartFEN:    StartFENFromPGN(g.PGN),
+				OpeningInfo: openingFromChessDotCom(g),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (cc ChessComClient) fetchArchives(ctx context.Context, username string) ([]string, error) {
 	u := fmt.Sprintf("https://api.chess.com/pub/player/%s/games/archives", username)
 	var idx archiveIndex
-	if err := getJSON(ctx, u, &idx); err != nil {
+	if err := getJSON(ctx, cc.HTTP, u, &idx); err != nil {
 		if httpErr, ok := err.(httpError); ok && httpErr.Status == http.StatusNotFound {
 			return nil, errUserNotFound
 		}
@@ -513,9 +549,9 @@ func fetchArchives(ctx context.Context, username string) ([]string, error) {
 	return idx.Archives, nil
 }
 
-func fetchMonthly(ctx context.Context, monthURL string) (*monthlyGames, error) {
+func (cc ChessComClient) fetchMonthly(ctx context.Context, monthURL string) (*monthlyGames, error) {
 	var mg monthlyGames
-	if err := getJSON(ctx, monthURL, &mg); err != nil {
+	if err := getJSON(ctx, cc.HTTP, monthURL, &mg); err != nil {
 		return nil, err
 	}
 	return &mg, nil
@@ -528,7 +564,7 @@ type httpError struct {
 
 func (e httpError) Error() string { return fmt.Sprintf("http %d: %s", e.Status, e.Body) }
 
-func getJSON(ctx context.Context, url string, v any) error {
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
@@ -539,7 +575,7 @@ func getJSON(ctx context.Context, url string, v any) error {
 	// basic retry for 429/5xx
 	var last httpError
 	for attempt := 0; attempt < 3; attempt++ {
-		res, err := httpc.Do(req)
+		res, err := client.Do(req)
 		if err != nil {
 			return err
 		}
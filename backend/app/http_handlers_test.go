@@ -38,21 +38,18 @@ func (m *mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	}, nil
 }
 
-func withMockHTTPClient(t *testing.T, responses map[string][]mockResp) func() {
-	t.Helper()
-	original := httpc
-	httpc = &http.Client{Transport: &mockRoundTripper{responses: responses}}
-	return func() { httpc = original }
+func mockHTTPClient(responses map[string][]mockResp) *http.Client {
+	return &http.Client{Transport: &mockRoundTripper{responses: responses}}
 }
 
 func TestGetJSONReturnsHttpError(t *testing.T) {
-	defer withMockHTTPClient(t, map[string][]mockResp{
+	client := mockHTTPClient(map[string][]mockResp{
 		"https://api.chess.com/notfound": {
 			{status: http.StatusNotFound, body: `{"message":"gone"}`},
 		},
-	})()
+	})
 
-	err := getJSON(context.Background(), "https://api.chess.com/notfound", &struct{}{})
+	err := getJSON(context.Background(), client, "https://api.chess.com/notfound", &struct{}{})
 	httpErr, ok := err.(httpError)
 	if !ok {
 		t.Fatalf("expected httpError, got %T", err)
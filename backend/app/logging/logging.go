@@ -0,0 +1,112 @@
+// Package logging builds the slog logger from config and carries
+// request-scoped loggers through contexts.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"example/my-go-api/app/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is read from incoming requests and echoed on responses.
+const RequestIDHeader = "X-Request-Id"
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	requestIDKey
+)
+
+// New returns a logger writing to w: JSON when cfg.Style is "json", text
+// otherwise, dropping records below cfg.Level (info when unset).
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	level := slog.LevelInfo
+	if cfg.Level != "" {
+		// config has already checked the value is debug, info, warn or error.
+		_ = level.UnmarshalText([]byte(cfg.Level))
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Style == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Setup installs New(cfg, os.Stderr) as the default logger, which the log
+// package also writes through.
+func Setup(cfg config.LogConfig) *slog.Logger {
+	l := New(cfg, os.Stderr)
+	slog.SetDefault(l)
+	return l
+}
+
+// WithContext stores l in ctx.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With adds attrs to the logger in ctx.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(args...))
+}
+
+// WithRequestID stores id in ctx and adds it to the logger there.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return With(ctx, "request_id", id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Middleware gives each request an ID, taken from the X-Request-Id header or
+// generated, and a logger carrying it, then logs the request once it is done.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		// Read the logger back from the request: later middleware (auth) adds to it.
+		FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example/my-go-api/app/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewFiltersByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(config.LogConfig{Style: "text", Level: "warn"}, &buf)
+	l.Info("hidden")
+	l.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "msg=shown") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestNewJSONStyle(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(config.LogConfig{Style: "json"}, &buf)
+	l.Debug("hidden")
+	l.Info("hello", "job_id", "j1")
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("want one JSON record, got %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "hello" || rec["job_id"] != "j1" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func serveWithLogger(t *testing.T, header string) (*httptest.ResponseRecorder, map[string]any, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithContext(c.Request.Context(), New(config.LogConfig{Style: "json"}, &buf)))
+	}, Middleware())
+	var seen string
+	router.GET("/ping", func(c *gin.Context) {
+		seen = RequestID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	if header != "" {
+		req.Header.Set(RequestIDHeader, header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("want one JSON record, got %q: %v", buf.String(), err)
+	}
+	return w, rec, seen
+}
+
+func TestMiddlewareKeepsIncomingRequestID(t *testing.T) {
+	w, rec, seen := serveWithLogger(t, "abc-123")
+	if got := w.Header().Get(RequestIDHeader); got != "abc-123" || seen != "abc-123" {
+		t.Fatalf("header %q, context %q, want abc-123", got, seen)
+	}
+	if rec["request_id"] != "abc-123" || rec["route"] != "/ping" || rec["status"] != float64(http.StatusNoContent) {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	w, rec, seen := serveWithLogger(t, "")
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" || seen != id || rec["request_id"] != id {
+		t.Fatalf("header %q, context %q, record %v", id, seen, rec)
+	}
+}
@@ -0,0 +1,124 @@
+// Package metrics defines the Prometheus metrics exported by the API and the
+// workers, and the handlers that serve them.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric below plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var (
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chessgaps_http_request_duration_seconds",
+		Help:    "API request latency by route pattern, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	ProviderFetchDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chessgaps_provider_fetch_duration_seconds",
+		Help:    "Time to fetch a player's games from chess.com or lichess.",
+		Buckets: []float64{.25, .5, 1, 2, 4, 8, 16, 25},
+	}, []string{"provider"})
+
+	ProviderFetchErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "chessgaps_provider_fetch_errors_total",
+		Help: "Failed game fetches by provider, not counting unknown players.",
+	}, []string{"provider"})
+
+	// QueueMessages counts analysis batches by event: enqueued (API), and
+	// received, acked, failed or invalid (worker).
+	QueueMessages = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "chessgaps_queue_messages_total",
+		Help: "Queued analysis batches by event.",
+	}, []string{"event"})
+
+	QueueReceiveErrors = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chessgaps_queue_receive_errors_total",
+		Help: "Failed queue polls.",
+	})
+
+	GamesAnalyzed = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chessgaps_games_analyzed_total",
+		Help: "Games analysed by the workers.",
+	})
+
+	PositionsAnalyzed = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chessgaps_positions_analyzed_total",
+		Help: "Moves analysed by the workers.",
+	})
+
+	EvalFENDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chessgaps_engine_eval_duration_seconds",
+		Help:    "Time for one engine evaluation, by search mode (depth or movetime).",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2, 5},
+	}, []string{"mode"})
+
+	EngineRestarts = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chessgaps_engine_restarts_total",
+		Help: "Engine processes restarted after exiting mid-batch.",
+	})
+
+	QuotaRejections = factory.NewCounter(prometheus.CounterOpts{
+		Name: "chessgaps_quota_rejections_total",
+		Help: "Analysis requests refused for exceeding the weekly quota.",
+	})
+
+	JobDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chessgaps_job_duration_seconds",
+		Help:    "Time for a worker to analyse and save one queued batch, by outcome.",
+		Buckets: []float64{1, 5, 10, 20, 30, 60, 90, 120, 180},
+	}, []string{"outcome"})
+)
+
+// ObserveEval records one search; mode is "depth" or "movetime". The depth or
+// movetime itself is left out of the labels, since it comes from the request.
+func ObserveEval(mode string, d time.Duration) {
+	EvalFENDuration.WithLabelValues(mode).Observe(d.Seconds())
+}
+
+// Outcome is the outcome label for err.
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records HTTPRequestDuration. Requests that match no route share
+// the route label "unmatched".
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
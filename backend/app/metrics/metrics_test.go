@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/games/:username", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/metrics", gin.WrapH(Handler()))
+
+	for _, path := range []string{"/games/alice", "/games/bob", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if n := testutil.CollectAndCount(HTTPRequestDuration); n != 2 {
+		t.Fatalf("want one series per route, got %d", n)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`chessgaps_http_request_duration_seconds_count{method="GET",route="/games/:username",status="200"} 2`,
+		`chessgaps_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("/metrics missing %q", want)
+		}
+	}
+}
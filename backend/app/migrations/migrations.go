@@ -0,0 +1,315 @@
+// Package migrations holds the versioned database schema and applies it.
+//
+// Each version is a pair of files in sql/, NNNN_name.up.sql and
+// NNNN_name.down.sql, embedded into the binary. Applied versions are recorded
+// in schema_migrations; every migration runs in its own transaction.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID keys the advisory lock that keeps two migrators from running at once.
+const lockID = 727_265_001
+
+// ErrSchemaBehind means the database is missing migrations this binary needs.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Migration is one schema version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether the database has it.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// All returns the embedded migrations in version order.
+func All() ([]Migration, error) {
+	return load(files)
+}
+
+// Latest is the highest embedded version.
+func Latest() int {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version", name)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join("sql", name))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return out, nil
+}
+
+// Up applies every pending migration and returns the ones it applied.
+func Up(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Version <= current {
+				continue
+			}
+			if err := apply(ctx, conn, m.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first.
+func Down(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	var reverted []Migration
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current > len(all) {
+			return fmt.Errorf("database is at version %d, newer than this binary's %d", current, len(all))
+		}
+		for v := current; v > 0 && len(reverted) < steps; v-- {
+			m := all[v-1]
+			if err := apply(ctx, conn, m.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Statuses lists every embedded migration with whether it has been applied.
+func Statuses(ctx context.Context, db *sql.DB) ([]Status, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := hasVersionTable(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]time.Time{}
+	if exists {
+		if appliedAt, err = appliedVersions(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Status, 0, len(all))
+	for _, m := range all {
+		at, ok := appliedAt[m.Version]
+		out = append(out, Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return out, nil
+}
+
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			v  int
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[v] = at
+	}
+	return appliedAt, rows.Err()
+}
+
+// Version is the highest applied version, 0 for an empty database. It only
+// reads, so it works for a read-only role and is cheap enough for /ready.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	exists, err := hasVersionTable(ctx, db)
+	if err != nil || !exists {
+		return 0, err
+	}
+	var v int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// Check compares the database with this binary. A database behind it returns
+// ErrSchemaBehind; one ahead of it (a newer binary already migrated) is fine.
+func Check(ctx context.Context, db *sql.DB) (current, latest int, err error) {
+	latest = Latest()
+	current, err = Version(ctx, db)
+	if err != nil {
+		return 0, latest, err
+	}
+	if current < latest {
+		return current, latest, fmt.Errorf("%w: at version %d, need %d", ErrSchemaBehind, current, latest)
+	}
+	return current, latest, nil
+}
+
+func ensureTable(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}) error {
+	_, err := q.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`)
+	return err
+}
+
+// hasVersionTable looks schema_migrations up without creating it.
+func hasVersionTable(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}) (bool, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	return exists, err
+}
+
+// currentVersion creates the bookkeeping table if needed; only Up and Down,
+// which hold the migration lock, call it.
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	if err := ensureTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	var v int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// withLock runs fn on one connection holding the migration advisory lock.
+func withLock(ctx context.Context, db *sql.DB, fn func(*sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	return fn(conn)
+}
+
+// apply runs a migration script and its bookkeeping in one transaction.
+func apply(ctx context.Context, conn *sql.Conn, script string, record func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
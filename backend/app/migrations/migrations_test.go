@@ -0,0 +1,194 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All error: %v", err)
+	}
+	if len(all) == 0 || Latest() != len(all) {
+		t.Fatalf("expected contiguous migrations, got %d with latest %d", len(all), Latest())
+	}
+	for _, m := range all {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Fatalf("migration %d_%s has an empty script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadRejectsBadSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"sql/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"gap": {
+			"sql/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"sql/0003_c.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/0003_c.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"sql/init.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/init.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"two names": {
+			"sql/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := load(fsys); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+// throwawayDB creates an empty database on the server in TEST_POSTGRES_DSN
+// (a postgres:// URL) and drops it when the test ends.
+func throwawayDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set; skipping Postgres integration test")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open admin db: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE DATABASE ` + name); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_POSTGRES_DSN must be a URL: %v", err)
+	}
+	u.Path = "/" + name
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec(`DROP DATABASE IF EXISTS ` + name); err != nil {
+			t.Logf("drop database %s: %v", name, err)
+		}
+	})
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var ok bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&ok); err != nil {
+		t.Fatalf("to_regclass(%s): %v", table, err)
+	}
+	return ok
+}
+
+func TestMigrationsUpDownPostgres(t *testing.T) {
+	db := throwawayDB(t)
+	ctx := context.Background()
+
+	if _, _, err := Check(ctx, db); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("empty database should be behind, got %v", err)
+	}
+	if tableExists(t, db, "schema_migrations") {
+		t.Fatalf("Check must not create schema_migrations")
+	}
+	if statuses, err := Statuses(ctx, db); err != nil || len(statuses) != Latest() || statuses[0].Applied {
+		t.Fatalf("Statuses on an empty database = %+v, %v", statuses, err)
+	}
+
+	applied, err := Up(ctx, db)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != Latest() {
+		t.Fatalf("applied %d migrations, want %d", len(applied), Latest())
+	}
+	if current, _, err := Check(ctx, db); err != nil || current != Latest() {
+		t.Fatalf("Check after up = %d, %v", current, err)
+	}
+	if again, err := Up(ctx, db); err != nil || len(again) != 0 {
+		t.Fatalf("second Up should be a no-op, applied %d, err %v", len(again), err)
+	}
+
+	for _, table := range []string{"users", "jobs", "games", "moves", "repertoire_moves", "drill_cards", "puzzles"} {
+		if !tableExists(t, db, table) {
+			t.Fatalf("table %s missing after up", table)
+		}
+	}
+
+	// The upserts in the app rely on these unique constraints.
+	var gameID int64
+	if err := db.QueryRow(`
+INSERT INTO games (username, url, when_unix, color) VALUES ('alice', 'u1', 1, 'white')
+RETURNING id`).Scan(&gameID); err != nil {
+		t.Fatalf("insert game: %v", err)
+	}
+	res, err := db.Exec(`
+INSERT INTO games (username, url, when_unix, color) VALUES ('alice', 'u1', 2, 'white')
+ON CONFLICT (username, url) DO NOTHING`)
+	if err != nil {
+		t.Fatalf("conflicting game insert: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Fatalf("duplicate (username, url) was inserted")
+	}
+	if _, err := db.Exec(`
+INSERT INTO moves (game_id, ply, move_number, move_uci) VALUES ($1, 1, 1, 'e2e4')
+ON CONFLICT (game_id, ply) DO UPDATE SET motifs = ARRAY['pin']`, gameID); err != nil {
+		t.Fatalf("insert move: %v", err)
+	}
+	if _, err := db.Exec(`
+INSERT INTO users (auth0_sub, plan) VALUES ('sub', 'FREE')
+ON CONFLICT (auth0_sub) DO NOTHING`); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	statuses, err := Statuses(ctx, db)
+	if err != nil {
+		t.Fatalf("Statuses: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Fatalf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+
+	reverted, err := Down(ctx, db, Latest())
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != Latest() || reverted[0].Version != Latest() {
+		t.Fatalf("Down should revert newest first, got %+v", reverted)
+	}
+	if v, err := Version(ctx, db); err != nil || v != 0 {
+		t.Fatalf("Version after down = %d, %v", v, err)
+	}
+	if tableExists(t, db, "games") {
+		t.Fatalf("games should be dropped after down")
+	}
+
+	if _, err := Up(ctx, db); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+-- Tables the backend has always relied on. IF NOT EXISTS lets databases that
+-- predate migrations adopt this history without changes.
+-- gen_random_uuid() is built in from Postgres 13.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    auth0_sub          TEXT NOT NULL UNIQUE,
+    email              TEXT,
+    name               TEXT,
+    plan               TEXT DEFAULT 'FREE',
+    analyses_used      INT NOT NULL DEFAULT 0,
+    usage_period_start TIMESTAMPTZ NOT NULL DEFAULT now(),
+    stripe_customer_id TEXT UNIQUE,
+    last_login         TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username           TEXT NOT NULL,
+    started_by_user_id UUID REFERENCES users (id),
+    status             TEXT NOT NULL DEFAULT 'queued',
+    total_games        INT NOT NULL,
+    batch_size         INT NOT NULL,
+    total_batches      INT NOT NULL,
+    completed_batches  INT NOT NULL DEFAULT 0,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    id              BIGSERIAL PRIMARY KEY,
+    username        TEXT NOT NULL,
+    url             TEXT NOT NULL,
+    when_unix       BIGINT NOT NULL,
+    color           TEXT NOT NULL,
+    opponent        TEXT,
+    opponent_rating INT,
+    result          TEXT,
+    rated           BOOLEAN,
+    time_class      TEXT,
+    time_control    TEXT,
+    pgn             TEXT,
+    eco             TEXT,
+    UNIQUE (username, url)
+);
+
+CREATE INDEX IF NOT EXISTS games_username_when_idx ON games (username, when_unix DESC);
+
+CREATE TABLE IF NOT EXISTS moves (
+    game_id               BIGINT NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    ply                   INT NOT NULL,
+    move_number           INT NOT NULL,
+    fen_before            TEXT,
+    fen_after             TEXT,
+    move_uci              TEXT NOT NULL,
+    move_san              TEXT,
+    color                 CHAR(1),
+    eval_before_cp        INT,
+    eval_after_cp         INT,
+    eval_before_mate      INT,
+    eval_after_mate       INT,
+    eval_depth            INT,
+    eval_time             INT,
+    centipawn_change      INT,
+    best_move_uci         TEXT,
+    is_inaccuracy         BOOLEAN NOT NULL DEFAULT FALSE,
+    is_mistake            BOOLEAN NOT NULL DEFAULT FALSE,
+    is_blunder            BOOLEAN NOT NULL DEFAULT FALSE,
+    is_suboptimal         BOOLEAN NOT NULL DEFAULT FALSE,
+    normalized_fen_before TEXT,
+    played_by             TEXT,
+    PRIMARY KEY (game_id, ply)
+);
+
+CREATE INDEX IF NOT EXISTS moves_normalized_fen_before_idx ON moves (normalized_fen_before);
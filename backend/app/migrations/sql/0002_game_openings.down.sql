@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS games_eco_code_idx;
+
+ALTER TABLE games
+    DROP COLUMN IF EXISTS opening_ply,
+    DROP COLUMN IF EXISTS opening_variation,
+    DROP COLUMN IF EXISTS opening_family,
+    DROP COLUMN IF EXISTS opening_name,
+    DROP COLUMN IF EXISTS eco_code,
+    DROP COLUMN IF EXISTS start_fen,
+    DROP COLUMN IF EXISTS variant;
@@ -0,0 +1,12 @@
+-- Variant and custom start position, plus structured opening metadata.
+
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS variant           TEXT,
+    ADD COLUMN IF NOT EXISTS start_fen         TEXT,
+    ADD COLUMN IF NOT EXISTS eco_code          TEXT,
+    ADD COLUMN IF NOT EXISTS opening_name      TEXT,
+    ADD COLUMN IF NOT EXISTS opening_family    TEXT,
+    ADD COLUMN IF NOT EXISTS opening_variation TEXT,
+    ADD COLUMN IF NOT EXISTS opening_ply       INT;
+
+CREATE INDEX IF NOT EXISTS games_eco_code_idx ON games (eco_code);
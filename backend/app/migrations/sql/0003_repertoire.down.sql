@@ -0,0 +1 @@
+DROP TABLE IF EXISTS repertoire_moves;
@@ -0,0 +1,14 @@
+-- Uploaded opening repertoires, one row per prepared move.
+
+CREATE TABLE IF NOT EXISTS repertoire_moves (
+    username       TEXT NOT NULL,
+    color          TEXT NOT NULL,
+    normalized_fen TEXT NOT NULL,
+    side_to_move   TEXT NOT NULL,
+    move_uci       TEXT NOT NULL,
+    move_san       TEXT NOT NULL,
+    line           TEXT NOT NULL,
+    ply            INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS repertoire_moves_username_color_idx ON repertoire_moves (username, color);
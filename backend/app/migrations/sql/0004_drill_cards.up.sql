@@ -0,0 +1,23 @@
+-- Spaced-repetition cards for repeatedly misplayed positions. Times are unix seconds.
+
+CREATE TABLE IF NOT EXISTS drill_cards (
+    id             BIGSERIAL PRIMARY KEY,
+    username       TEXT NOT NULL,
+    normalized_fen TEXT NOT NULL,
+    side_to_move   TEXT NOT NULL,
+    answers        TEXT[] NOT NULL DEFAULT '{}',
+    times_seen     INT NOT NULL DEFAULT 0,
+    error_count    INT NOT NULL DEFAULT 0,
+    last_error_at  BIGINT NOT NULL DEFAULT 0,
+    status         TEXT NOT NULL DEFAULT 'active',
+    ease           DOUBLE PRECISION NOT NULL DEFAULT 2.5,
+    interval_days  INT NOT NULL DEFAULT 0,
+    repetitions    INT NOT NULL DEFAULT 0,
+    lapses         INT NOT NULL DEFAULT 0,
+    reviews        INT NOT NULL DEFAULT 0,
+    due_at         BIGINT NOT NULL DEFAULT 0,
+    last_review_at BIGINT NOT NULL DEFAULT 0,
+    UNIQUE (username, normalized_fen)
+);
+
+CREATE INDEX IF NOT EXISTS drill_cards_due_idx ON drill_cards (username, status, due_at);
@@ -0,0 +1,20 @@
+-- Puzzles generated from blunders; rejected rows only mark a blunder as examined.
+
+CREATE TABLE IF NOT EXISTS puzzles (
+    id           BIGSERIAL PRIMARY KEY,
+    username     TEXT NOT NULL,
+    game_id      BIGINT NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    source_ply   INT NOT NULL,
+    blunder_by   TEXT NOT NULL,
+    fen          TEXT NOT NULL,
+    solver_color TEXT NOT NULL,
+    solution     TEXT[] NOT NULL DEFAULT '{}',
+    solution_san TEXT[] NOT NULL DEFAULT '{}',
+    theme        TEXT NOT NULL DEFAULT '',
+    eval_cp      INT NOT NULL DEFAULT 0,
+    rejected     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at   BIGINT NOT NULL,
+    UNIQUE (username, game_id, source_ply)
+);
+
+CREATE INDEX IF NOT EXISTS puzzles_username_created_idx ON puzzles (username, created_at DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE moves
+    DROP COLUMN IF EXISTS missed_win_cp,
+    DROP COLUMN IF EXISTS is_missed_win,
+    DROP COLUMN IF EXISTS motifs;
@@ -0,0 +1,6 @@
+-- Tactical motifs on analysed moves, and missed wins after opponent errors.
+
+ALTER TABLE moves
+    ADD COLUMN IF NOT EXISTS motifs        TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS is_missed_win BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS missed_win_cp INT NOT NULL DEFAULT 0;
@@ -0,0 +1,118 @@
+// Package app reports the opponent errors the user failed to punish.
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	missedWinDefaultLimit = 50
+	missedWinMaxLimit     = 500
+)
+
+// GetMissedWins lists the user's replies that gave back most of an opponent's
+// error, newest first. It takes the error report's game filters; move_min and
+// move_max apply only when set, and ?limit= caps the list. Missed wins are
+// kept out of the error reports.
+func (a *App) GetMissedWins(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	filters, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("move_min") == "" {
+		filters.MoveMin = 0
+	}
+	if c.Query("move_max") == "" {
+		filters.MoveMax = 0
+	}
+	if c.Query("include_custom_start") == "" {
+		filters.IncludeCustomStart = true
+	}
+	limit := missedWinDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 && n <= missedWinMaxLimit {
+			limit = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	report, err := a.Stores.Reports.FindMissedWins(ctx, username, filters, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// FindMissedWins loads the user's missed wins with the opponent move that set
+// each one up.
+func (s *sqlStore) FindMissedWins(ctx context.Context, username string, filters ErrorPositionQuery, limit int) (models.MissedWinReport, error) {
+	report := models.MissedWinReport{Username: username, MissedWins: []models.MissedWin{}}
+
+	args := []any{username}
+	filterClauses, args := filters.filterSQL(args)
+	args = append(args, limit)
+	limitArg := fmt.Sprintf("$%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT
+    g.url,
+    g.opponent,
+    g.when_unix,
+    m.ply,
+    m.move_number,
+    m.fen_before,
+    COALESCE(p.move_san, ''),
+    m.move_uci,
+    COALESCE(m.move_san, ''),
+    COALESCE(m.best_move_uci, ''),
+    m.missed_win_cp,
+    m.centipawn_change,
+    COUNT(*) OVER ()
+FROM moves m
+JOIN games g ON g.id = m.game_id
+LEFT JOIN moves p ON p.game_id = m.game_id AND p.ply = m.ply - 1
+WHERE g.username  = $1
+  AND m.played_by = g.username
+  AND m.is_missed_win`+filterClauses+`
+ORDER BY g.when_unix DESC, m.ply
+LIMIT `+limitArg+`;
+`, args...)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.MissedWin
+		if err := rows.Scan(
+			&w.GameURL, &w.Opponent, &w.WhenUnix, &w.Ply, &w.MoveNumber, &w.FEN,
+			&w.OpponentMoveSAN, &w.PlayedUCI, &w.PlayedSAN, &w.BestUCI,
+			&w.SwingCP, &w.GivenBackCP, &report.Total,
+		); err != nil {
+			return report, err
+		}
+		w.BestSAN = sanFromUCI(w.FEN, w.BestUCI)
+		if w.PlayedSAN == "" {
+			w.PlayedSAN = sanFromUCI(w.FEN, w.PlayedUCI)
+		}
+		report.MissedWins = append(report.MissedWins, w)
+	}
+	return report, rows.Err()
+}
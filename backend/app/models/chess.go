@@ -15,6 +15,18 @@ type GameLite struct {
 	GameId      int
 	Moves       []Move
 	ECO         string `json:"eco"`
+	Variant     string `json:"variant"`             // "standard" or "chess960"
+	StartFEN    string `json:"start_fen,omitempty"` // set when the game does not start from the initial position
+	OpeningInfo
+}
+
+// Structured opening metadata, filled the same way for every provider
+type OpeningInfo struct {
+	ECOCode          string `json:"eco_code"`          // e.g. "B90"
+	OpeningName      string `json:"opening_name"`      // e.g. "Sicilian Defense: Najdorf Variation"
+	OpeningFamily    string `json:"opening_family"`    // e.g. "Sicilian Defense"
+	OpeningVariation string `json:"opening_variation"` // e.g. "Najdorf Variation"
+	OpeningPly       int    `json:"opening_ply"`       // plies until the opening was identified, 0 if unknown
 }
 
 type Move struct {
@@ -46,6 +58,9 @@ type MoveAnalysis struct {
 	Is_Innacuracy bool
 	Is_Mistake    bool
 	Is_Blunder    bool
+	Motifs        []string // tactical explanations, e.g. "hanging_piece"; see app.Motifs
+	Is_Missed_Win bool     // the reply gave back most of what the opponent's previous move threw away
+	MissedWinCP   int      // centipawns the opponent's previous move threw away, when Is_Missed_Win
 }
 
 // FENs where you've made a bad move and how many times you've done it
@@ -58,6 +73,8 @@ type SuboptimalFen struct {
 	BlunderCount        int
 	ErrorCount          int
 	ErrorRate           float64
+	TotalCPLost         int   // centipawns lost across the counted errors
+	LastSeen            int64 // unix time of the most recent game reaching the position
 	SideToMove          string
 }
 
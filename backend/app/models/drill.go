@@ -0,0 +1,30 @@
+package models
+
+// A misplayed position to practise, scheduled with SM-2
+type DrillCard struct {
+	ID            int64    `json:"id"`
+	Username      string   `json:"username"`
+	NormalizedFen string   `json:"normalized_fen"`
+	SideToMove    string   `json:"side_to_move"`
+	Answers       []string `json:"answers"` // accepted UCI moves, the engine's best first
+	TimesSeen     int      `json:"times_seen"`
+	ErrorCount    int      `json:"error_count"`
+	LastErrorAt   int64    `json:"last_error_at"` // unix time of the latest game the position was misplayed in
+	Status        string   `json:"status"`        // "active" or "retired"
+	Ease          float64  `json:"ease"`
+	IntervalDays  int      `json:"interval_days"`
+	Repetitions   int      `json:"repetitions"` // correct answers in a row
+	Lapses        int      `json:"lapses"`
+	Reviews       int      `json:"reviews"`
+	DueAt         int64    `json:"due_at"`
+	LastReviewAt  int64    `json:"last_review_at"`
+}
+
+// Outcome of answering a drill card
+type DrillAnswerResult struct {
+	Correct   bool      `json:"correct"`
+	Submitted string    `json:"submitted"`
+	Answers   []string  `json:"answers"`
+	AnswerSAN []string  `json:"answer_san"`
+	Card      DrillCard `json:"card"`
+}
@@ -2,9 +2,10 @@ package models
 
 type UCIScore struct {
 	// Exactly one of these will be set:
-	CP   *int   `json:"cp,omitempty"`   // centipawns, positive means advantage for side to move
-	Mate *int   `json:"mate,omitempty"` // in N, sign indicates who is mating (+ means side to move mates)
-	Best string `json:"bestmove"`       // engine best move in UCI, e.g. "e2e4"
+	CP   *int     `json:"cp,omitempty"`   // centipawns, positive means advantage for side to move
+	Mate *int     `json:"mate,omitempty"` // in N, sign indicates who is mating (+ means side to move mates)
+	Best string   `json:"bestmove"`       // engine best move in UCI, e.g. "e2e4"
+	PV   []string `json:"pv,omitempty"`   // principal variation in UCI, starting with Best
 }
 
 // EngineSettings drives how we query Stockfish for a position.
@@ -13,3 +14,10 @@ type EngineSettings struct {
 	MoveTimeMS  int  `json:"move_time_ms"`
 	UseDepth    bool `json:"use_depth"` // if false, use movetime
 }
+
+// One line of a MultiPV search
+type PVLine struct {
+	MultiPV int      `json:"multipv"` // 1 is the engine's best line
+	Score   UCIScore `json:"score"`
+	PV      []string `json:"pv"` // moves in UCI
+}
@@ -0,0 +1,25 @@
+package models
+
+// One move the player has chosen from an explorer position
+type ExplorerMove struct {
+	MoveUCI        string   `json:"move_uci"`
+	MoveSAN        string   `json:"move_san"`
+	Count          int      `json:"count"`
+	Wins           int      `json:"wins"`
+	Draws          int      `json:"draws"`
+	Losses         int      `json:"losses"`
+	Score          float64  `json:"score"`             // (wins + draws/2) / count
+	AvgEvalAfterCP *float64 `json:"avg_eval_after_cp"` // from the mover's point of view; nil if every eval was a mate score
+	ErrorCount     int      `json:"error_count"`
+	IsBest         bool     `json:"is_best"`
+}
+
+// A position in the player's personal opening tree
+type ExplorerPosition struct {
+	FEN         string         `json:"fen"` // normalized: pieces, side, castling, en passant
+	SideToMove  string         `json:"side_to_move"`
+	Total       int            `json:"total"`
+	BestMoveUCI string         `json:"best_move_uci"`
+	BestMoveSAN string         `json:"best_move_san"`
+	Moves       []ExplorerMove `json:"moves"`
+}
@@ -8,6 +8,7 @@ type LichessGame struct {
 	Speed      string `json:"speed"`
 	Perf       string `json:"perf"`
 	Rated      bool   `json:"rated"`
+	Variant    string `json:"variant"`
 	PGN        string `json:"pgn"`
 	Winner     string `json:"winner"`
 	Clock      *struct {
@@ -17,6 +18,7 @@ type LichessGame struct {
 	Opening *struct {
 		ECO  string `json:"eco"`
 		Name string `json:"name"`
+		Ply  int    `json:"ply"`
 	} `json:"opening"`
 	Players struct {
 		White LichessPlayer `json:"white"`
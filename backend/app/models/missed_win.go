@@ -0,0 +1,25 @@
+package models
+
+// A reply that let the opponent's error go unpunished
+type MissedWin struct {
+	GameURL         string `json:"game_url"`
+	Opponent        string `json:"opponent"`
+	WhenUnix        int64  `json:"when_unix"`
+	Ply             int    `json:"ply"`
+	MoveNumber      int    `json:"move_number"`
+	FEN             string `json:"fen"`               // position after the opponent's error
+	OpponentMoveSAN string `json:"opponent_move_san"` // the error that offered the win
+	PlayedUCI       string `json:"played_uci"`
+	PlayedSAN       string `json:"played_san"`
+	BestUCI         string `json:"best_uci"`
+	BestSAN         string `json:"best_san"`
+	SwingCP         int    `json:"swing_cp"`      // what the opponent's error gave away
+	GivenBackCP     int    `json:"given_back_cp"` // what the user's reply lost of it
+}
+
+// A user's missed wins, newest first
+type MissedWinReport struct {
+	Username   string      `json:"username"`
+	Total      int         `json:"total"` // matching missed wins, before limit
+	MissedWins []MissedWin `json:"missed_wins"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// How often one tactical motif explains the player's errors
+type MotifStat struct {
+	Motif           string  `json:"motif"`
+	Count           int     `json:"count"`
+	BlunderCount    int     `json:"blunder_count"`
+	MistakeCount    int     `json:"mistake_count"`
+	ShareOfErrors   float64 `json:"share_of_errors"`   // Count / Errors
+	ShareOfBlunders float64 `json:"share_of_blunders"` // BlunderCount / Blunders
+}
+
+// Motif breakdown of a player's errors
+type MotifReport struct {
+	Username string      `json:"username"`
+	Errors   int         `json:"errors"`
+	Blunders int         `json:"blunders"`
+	Motifs   []MotifStat `json:"motifs"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// A tactic found after a blunder in one of the player's games
+type Puzzle struct {
+	ID          int64    `json:"id"`
+	Username    string   `json:"username"`
+	GameURL     string   `json:"game_url"`
+	SourcePly   int      `json:"source_ply"` // ply of the blunder that set the puzzle up
+	BlunderBy   string   `json:"blunder_by"` // "user" or "opponent"
+	FEN         string   `json:"fen"`        // position after the blunder; the solver is to move
+	SolverColor string   `json:"solver_color"`
+	Solution    []string `json:"solution"` // UCI, solver's moves and forced replies alternating
+	SolutionSAN []string `json:"solution_san"`
+	Theme       string   `json:"theme"` // "mate", "promotion" or "material"
+	EvalCP      int      `json:"eval_cp"`
+	CreatedAt   int64    `json:"created_at"`
+}
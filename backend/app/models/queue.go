@@ -8,4 +8,7 @@ type JobMessage struct {
 	EngineDepth       int  `json:"engine_depth"`
 	EngineMoveTime    int  `json:"engine_move_time"`
 	EngineUseDepth    bool `json:"engine_use_depth"`
+	RequestID         string `json:"request_id,omitempty"` // API request that queued the batch, for log correlation
+	TraceContext      map[string]string `json:"trace_context,omitempty"` // W3C traceparent/tracestate of the enqueue span
+	GameIDs           []int             `json:"game_ids,omitempty"`      // when set, the batch is exactly these games
 }
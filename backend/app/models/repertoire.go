@@ -0,0 +1,78 @@
+package models
+
+// One repertoire move: in this position, play (or expect) this move
+type RepertoireMove struct {
+	NormalizedFen string `json:"normalized_fen"`
+	SideToMove    string `json:"side_to_move"`
+	MoveUCI       string `json:"move_uci"`
+	MoveSAN       string `json:"move_san"`
+	Line          string `json:"line"` // movetext leading to the position, e.g. "1. e4 c5 2. Nf3"
+	Ply           int    `json:"ply"`
+}
+
+// Where one game left the repertoire
+type GameDeviation struct {
+	URL        string   `json:"url"`
+	When       int64    `json:"when_unix"`
+	Opponent   string   `json:"opponent"`
+	Outcome    string   `json:"outcome"`     // "deviation", "end_of_repertoire" or "in_book"
+	DeviatedBy string   `json:"deviated_by"` // "player" or "opponent"; empty unless Outcome is "deviation"
+	Ply        int      `json:"ply"`
+	Line       string   `json:"line"`
+	FEN        string   `json:"fen"`
+	PlayedUCI  string   `json:"played_uci"`
+	PlayedSAN  string   `json:"played_san"`
+	Expected   []string `json:"expected_san"`
+	CPLoss     int      `json:"cp_loss"` // centipawns the deviating side lost with the deviation
+}
+
+// A repertoire position the player keeps getting wrong
+type ForgottenLine struct {
+	FEN         string         `json:"fen"`
+	Line        string         `json:"line"`
+	Expected    []string       `json:"expected_san"`
+	Played      map[string]int `json:"played_san"` // what was played instead, with counts
+	Times       int            `json:"times"`
+	AvgCPLoss   float64        `json:"avg_cp_loss"`
+	ExampleURLs []string       `json:"example_urls"`
+}
+
+// Repertoire adherence across a player's games with one colour
+type RepertoireReport struct {
+	Username           string          `json:"username"`
+	Color              string          `json:"color"`
+	GamesChecked       int             `json:"games_checked"`
+	InBook             int             `json:"in_book"`
+	EndOfRepertoire    int             `json:"end_of_repertoire"`
+	PlayerDeviations   int             `json:"player_deviations"`
+	OpponentDeviations int             `json:"opponent_deviations"`
+	AvgPlayerCPLoss    float64         `json:"avg_player_cp_loss"`
+	ForgottenLines     []ForgottenLine `json:"forgotten_lines"`
+	Deviations         []GameDeviation `json:"deviations"`
+}
+
+// One move in a repertoire derived from the player's own games
+type RepertoireNode struct {
+	MoveUCI      string           `json:"move_uci"`
+	MoveSAN      string           `json:"move_san"`
+	Ply          int              `json:"ply"`
+	PlayedByUser bool             `json:"played_by_user"`
+	Count        int              `json:"count"`
+	Share        float64          `json:"share"` // fraction of games in the parent position that went this way
+	ErrorCount   int              `json:"error_count"`
+	IsError      bool             `json:"is_error"`      // the player's usual move here is engine-flagged
+	AvgEvalCP    *float64         `json:"avg_eval_cp"`   // after the move, from the mover's point of view
+	BestMoveUCI  string           `json:"best_move_uci"` // engine's usual best move in the parent position
+	BestMoveSAN  string           `json:"best_move_san"`
+	Children     []RepertoireNode `json:"children"`
+}
+
+// The player's de facto repertoire with one colour
+type ExtractedRepertoire struct {
+	Username string           `json:"username"`
+	Color    string           `json:"color"`
+	MinGames int              `json:"min_games"`
+	MinShare float64          `json:"min_share"`
+	Flagged  int              `json:"flagged"` // branches whose usual move is an error
+	Moves    []RepertoireNode `json:"moves"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// How a player fares in one opening with one colour
+type OpeningStat struct {
+	Color       string   `json:"color"` // colour the player had: "white" or "black"
+	ECOCode     string   `json:"eco_code"`
+	OpeningName string   `json:"opening_name"`
+	Games       int      `json:"games"`
+	Wins        int      `json:"wins"`
+	Draws       int      `json:"draws"`
+	Losses      int      `json:"losses"`
+	Score       float64  `json:"score"` // (wins + draws/2) / games
+	ExampleURLs []string `json:"example_urls"`
+}
+
+// A line worth aiming for against the scouted player
+type SteerLine struct {
+	Reason              string   `json:"reason"`  // "low_score" or "frequent_error"
+	PlayAs              string   `json:"play_as"` // colour to take against the scouted player
+	ECOCode             string   `json:"eco_code,omitempty"`
+	OpeningName         string   `json:"opening_name,omitempty"`
+	NormalizedFenBefore string   `json:"normalized_fen_before,omitempty"`
+	Games               int      `json:"games"`
+	Score               float64  `json:"score"`
+	ErrorRate           float64  `json:"error_rate,omitempty"`
+	ExampleURLs         []string `json:"example_urls"`
+}
+
+// Everything we know about an opponent's opening play
+type ScoutingReport struct {
+	Username        string                 `json:"username"`
+	OpeningsAsWhite []OpeningStat          `json:"openings_as_white"`
+	OpeningsAsBlack []OpeningStat          `json:"openings_as_black"`
+	WeakLines       []OpeningStat          `json:"weak_lines"`
+	ErrorPositions  []SuboptimalFensReport `json:"error_positions"`
+	SteerToward     []SteerLine            `json:"steer_toward"`
+}
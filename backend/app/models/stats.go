@@ -0,0 +1,33 @@
+package models
+
+// One week or month of a player's analysed games
+type StatsPoint struct {
+	BucketStart        int64   `json:"bucket_start"` // unix seconds, UTC start of the week (Monday) or month
+	Games              int     `json:"games"`
+	Wins               int     `json:"wins"`
+	Draws              int     `json:"draws"`
+	Losses             int     `json:"losses"`
+	WinRate            float64 `json:"win_rate"` // wins / games
+	Moves              int     `json:"moves"`    // the player's analysed moves
+	AvgCPLoss          float64 `json:"avg_cp_loss"`
+	BlundersPer100     float64 `json:"blunders_per_100"`
+	MistakesPer100     float64 `json:"mistakes_per_100"`
+	InaccuraciesPer100 float64 `json:"inaccuracies_per_100"`
+	RepeatedPositions  int     `json:"repeated_positions"`  // opening moves from positions reached in an earlier game
+	RepeatedErrors     int     `json:"repeated_errors"`     // of those, inaccuracies or worse
+	RepeatedErrorRate  float64 `json:"repeated_error_rate"` // RepeatedErrors / RepeatedPositions
+}
+
+// A time series for one time class and colour; empty fields mean "all"
+type StatsSeries struct {
+	TimeClass string       `json:"time_class,omitempty"`
+	Color     string       `json:"color,omitempty"`
+	Points    []StatsPoint `json:"points"`
+}
+
+// Progress over time for a player
+type StatsReport struct {
+	Username string        `json:"username"`
+	Bucket   string        `json:"bucket"` // "week" or "month"
+	Series   []StatsSeries `json:"series"`
+}
@@ -0,0 +1,146 @@
+// Package app aggregates the tactical motifs behind a user's errors.
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// GetMotifStats reports how often each motif explains the user's errors, e.g.
+// the share of blunders that left a piece en prise. It takes the error report's
+// filters; unlike the report it covers every move unless move_min/move_max are set.
+func (a *App) GetMotifStats(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	filters, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("move_min") == "" {
+		filters.MoveMin = 0
+	}
+	if c.Query("move_max") == "" {
+		filters.MoveMax = 0
+	}
+	if c.Query("min_severity") == "" {
+		filters.MinSeverity = SeverityInaccuracy
+	}
+	if c.Query("include_custom_start") == "" {
+		filters.IncludeCustomStart = true
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	report, err := a.Stores.Reports.FindMotifStats(ctx, username, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// FindMotifStats counts the user's errors and, per motif, the tagged moves.
+// Mate motifs can tag moves the classifier skips, so their counts may include
+// moves outside Errors.
+func (s *sqlStore) FindMotifStats(ctx context.Context, username string, filters ErrorPositionQuery) (models.MotifReport, error) {
+	report := models.MotifReport{Username: username, Motifs: []models.MotifStat{}}
+
+	args := []any{username}
+	filterClauses, args := filters.filterSQL(args)
+
+	// Grouped by the whole motif set; the sets are split below, since SQLite
+	// has no UNNEST.
+	q := `
+WITH user_moves AS (
+    SELECT
+        COALESCE(m.motifs, '{}') AS motifs,
+        ` + filters.errorSQL() + ` AS is_error,
+        m.is_blunder,
+        m.is_mistake
+    FROM moves m
+    JOIN games g ON g.id = m.game_id
+    WHERE g.username  = $1
+      AND m.played_by = g.username` + filterClauses + `
+)
+SELECT
+    motifs,
+    COUNT(*),
+    SUM(CASE WHEN is_error   THEN 1 ELSE 0 END),
+    SUM(CASE WHEN is_blunder THEN 1 ELSE 0 END),
+    SUM(CASE WHEN is_mistake THEN 1 ELSE 0 END)
+FROM user_moves
+GROUP BY motifs;
+`
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	byMotif := map[string]int{} // index into stats
+	var stats []models.MotifStat
+	for rows.Next() {
+		var (
+			motifs                          []string
+			count, errs, blunders, mistakes int
+		)
+		if err := rows.Scan(pq.Array(&motifs), &count, &errs, &blunders, &mistakes); err != nil {
+			return report, err
+		}
+		report.Errors += errs
+		report.Blunders += blunders
+		for _, motif := range motifs {
+			i, ok := byMotif[motif]
+			if !ok {
+				i = len(stats)
+				byMotif[motif] = i
+				stats = append(stats, models.MotifStat{Motif: motif})
+			}
+			st := &stats[i]
+			st.Count += count
+			st.BlunderCount += blunders
+			st.MistakeCount += mistakes
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	report.Motifs = finishMotifStats(stats, report.Errors, report.Blunders)
+	return report, nil
+}
+
+// finishMotifStats fills the shares and orders motifs by count.
+func finishMotifStats(stats []models.MotifStat, errors, blunders int) []models.MotifStat {
+	out := []models.MotifStat{}
+	for _, s := range stats {
+		if errors > 0 {
+			s.ShareOfErrors = float64(s.Count) / float64(errors)
+		}
+		if blunders > 0 {
+			s.ShareOfBlunders = float64(s.BlunderCount) / float64(blunders)
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Motif < out[j].Motif
+	})
+	return out
+}
@@ -0,0 +1,348 @@
+// Package app tags errors with the tactical motif that explains them.
+package app
+
+import (
+	"example/my-go-api/app/models"
+
+	"github.com/notnil/chess"
+)
+
+// Tactical motifs stored on moves.motifs.
+const (
+	MotifHangingPiece    = "hanging_piece"
+	MotifMissedFork      = "missed_fork"
+	MotifPin             = "pin"
+	MotifBackRank        = "back_rank"
+	MotifMissedMate      = "missed_mate"
+	MotifAllowedMate     = "allowed_mate"
+	MotifTrappedPiece    = "trapped_piece"
+	MotifMissedRecapture = "missed_recapture"
+)
+
+// Motifs lists every motif in report order.
+var Motifs = []string{
+	MotifHangingPiece,
+	MotifMissedFork,
+	MotifPin,
+	MotifBackRank,
+	MotifMissedMate,
+	MotifAllowedMate,
+	MotifTrappedPiece,
+	MotifMissedRecapture,
+}
+
+var (
+	diagonalDirs   = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	orthogonalDirs = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+)
+
+// motifInput is one analysed move with the engine's view on either side of it.
+type motifInput struct {
+	Before      *chess.Position // the mover is to move
+	Move        *chess.Move
+	PrevMove    *chess.Move     // the opponent's previous move, nil on the first move
+	BeforeScore models.UCIScore // mover's point of view; Best is the mover's best move
+	AfterScore  models.UCIScore // opponent's point of view; Best and PV are the opponent's
+	IsError     bool            // the move was classified as an inaccuracy or worse
+}
+
+// detectMotifs explains a move with heuristics over the positions before and
+// after it and the engine's lines. Mate motifs are checked on every move, since
+// mate scores are never classified; the rest only on errors.
+func detectMotifs(in motifInput) []string {
+	if in.Before == nil || in.Move == nil {
+		return nil
+	}
+	mover := in.Before.Turn()
+	after := in.Before.Update(in.Move)
+	var tags []string
+
+	before, afterMate := in.BeforeScore.Mate, in.AfterScore.Mate
+	if before != nil && *before > 0 && !(afterMate != nil && *afterMate < 0) {
+		tags = append(tags, MotifMissedMate)
+	}
+	if afterMate != nil && *afterMate > 0 && !(before != nil && *before < 0) {
+		tags = append(tags, MotifAllowedMate)
+		if isBackRankMate(after, in.AfterScore, mover) {
+			tags = append(tags, MotifBackRank)
+		}
+	}
+	if !in.IsError {
+		return tags
+	}
+
+	reply := findMoveByUCI(after, in.AfterScore.Best)
+	best := findMoveByUCI(in.Before, in.BeforeScore.Best)
+	if best != nil && best.String() == in.Move.String() {
+		best = nil
+	}
+
+	if reply != nil && isHangingPiece(in.Before, in.Move, after, reply) {
+		tags = append(tags, MotifHangingPiece)
+	}
+	if best != nil && isFork(in.Before.Update(best), best.S2()) {
+		tags = append(tags, MotifMissedFork)
+	}
+	if (reply != nil && createsPin(after.Update(reply), reply.S2())) ||
+		(best != nil && createsPin(in.Before.Update(best), best.S2())) {
+		tags = append(tags, MotifPin)
+	}
+	if reply != nil && isTrapped(after.Update(reply), in.Move.S2(), mover) {
+		tags = append(tags, MotifTrappedPiece)
+	}
+	if best != nil && in.PrevMove != nil && in.PrevMove.HasTag(chess.Capture) &&
+		best.S2() == in.PrevMove.S2() && in.Move.S2() != in.PrevMove.S2() {
+		tags = append(tags, MotifMissedRecapture)
+	}
+	return tags
+}
+
+// isBackRankMate reports whether the opponent's mating line ends with a rook or
+// queen on the mover's back rank while the mover's king is still on it.
+func isBackRankMate(after *chess.Position, score models.UCIScore, mover chess.Color) bool {
+	pv := score.PV
+	if len(pv) == 0 && score.Best != "" {
+		pv = []string{score.Best}
+	}
+	if score.Mate == nil {
+		return false
+	}
+	plies := 2*(*score.Mate) - 1
+	if len(pv) < plies {
+		return false
+	}
+
+	pos := after
+	var last *chess.Move
+	for _, uci := range pv[:plies] {
+		m := findMoveByUCI(pos, uci)
+		if m == nil {
+			return false
+		}
+		last = m
+		pos = pos.Update(m)
+	}
+	if pos.Status() != chess.Checkmate {
+		return false
+	}
+
+	backRank := chess.Rank1
+	if mover == chess.Black {
+		backRank = chess.Rank8
+	}
+	mater := pos.Board().Piece(last.S2()).Type()
+	if (mater != chess.Rook && mater != chess.Queen) || last.S2().Rank() != backRank {
+		return false
+	}
+	king := kingSquare(pos.Board(), mover)
+	return king != chess.NoSquare && king.Rank() == backRank
+}
+
+// isHangingPiece reports whether the opponent's best reply wins a piece the
+// move left undefended or attacked by something cheaper. Recaptures after the
+// mover's own equal or better capture are trades, not hanging pieces.
+func isHangingPiece(before *chess.Position, move *chess.Move, after *chess.Position, reply *chess.Move) bool {
+	victim := after.Board().Piece(reply.S2())
+	if victim == chess.NoPiece || victim.Color() != before.Turn() || pieceValues[victim.Type()] < 3 {
+		return false
+	}
+	if reply.S2() == move.S2() {
+		taken := before.Board().Piece(move.S2())
+		if taken != chess.NoPiece && pieceValues[taken.Type()] >= pieceValues[victim.Type()] {
+			return false
+		}
+	}
+
+	capturer := after.Board().Piece(reply.S1())
+	if pieceValues[capturer.Type()] < pieceValues[victim.Type()] {
+		return true
+	}
+	afterReply := after.Update(reply)
+	return len(attackersOf(afterReply.Board(), reply.S2(), before.Turn())) == 0
+}
+
+// isFork reports whether the piece on sq attacks two or more targets worth
+// attacking: the king, anything more valuable, or an undefended piece.
+func isFork(pos *chess.Position, sq chess.Square) bool {
+	b := pos.Board()
+	piece := b.Piece(sq)
+	if piece == chess.NoPiece {
+		return false
+	}
+	targets := 0
+	for target, p := range b.SquareMap() {
+		if p.Color() == piece.Color() || !attacks(b, sq, piece, target) {
+			continue
+		}
+		switch {
+		case p.Type() == chess.King:
+			targets++
+		case pieceValues[p.Type()] > pieceValues[piece.Type()]:
+			targets++
+		case pieceValues[p.Type()] >= 3 && len(attackersOf(b, target, p.Color())) == 0:
+			targets++
+		}
+	}
+	return targets >= 2
+}
+
+// createsPin reports whether the slider on sq pins an enemy piece to a more
+// valuable one (or the king) behind it.
+func createsPin(pos *chess.Position, sq chess.Square) bool {
+	b := pos.Board()
+	slider := b.Piece(sq)
+	var dirs [][2]int
+	switch slider.Type() {
+	case chess.Bishop:
+		dirs = diagonalDirs
+	case chess.Rook:
+		dirs = orthogonalDirs
+	case chess.Queen:
+		dirs = append(append([][2]int{}, diagonalDirs...), orthogonalDirs...)
+	default:
+		return false
+	}
+
+	for _, d := range dirs {
+		first := chess.NoPiece
+		for f, r := int(sq.File())+d[0], int(sq.Rank())+d[1]; onBoard(f, r); f, r = f+d[0], r+d[1] {
+			p := b.Piece(chess.NewSquare(chess.File(f), chess.Rank(r)))
+			if p == chess.NoPiece {
+				continue
+			}
+			if p.Color() == slider.Color() {
+				break
+			}
+			if first == chess.NoPiece {
+				if p.Type() == chess.King {
+					break
+				}
+				first = p
+				continue
+			}
+			if p.Type() == chess.King || pieceValues[p.Type()] > pieceValues[first.Type()] {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+// isTrapped reports whether color's piece on sq (with color to move) is
+// attacked where it stands and every square it can go to loses it too.
+func isTrapped(pos *chess.Position, sq chess.Square, color chess.Color) bool {
+	piece := pos.Board().Piece(sq)
+	if piece == chess.NoPiece || piece.Color() != color || pieceValues[piece.Type()] < 3 || pos.Turn() != color {
+		return false
+	}
+	if squareIsSafe(pos.Board(), sq, piece) {
+		return false
+	}
+	for _, m := range pos.ValidMoves() {
+		if m.S1() != sq {
+			continue
+		}
+		if squareIsSafe(pos.Update(m).Board(), m.S2(), piece) {
+			return false
+		}
+	}
+	return true
+}
+
+// squareIsSafe reports whether piece on sq can't be won: nothing attacks it, or
+// every attacker is at least as valuable and the square is defended.
+func squareIsSafe(b *chess.Board, sq chess.Square, piece chess.Piece) bool {
+	attackers := attackersOf(b, sq, piece.Color().Other())
+	if len(attackers) == 0 {
+		return true
+	}
+	for _, a := range attackers {
+		if pieceValues[b.Piece(a).Type()] < pieceValues[piece.Type()] {
+			return false
+		}
+	}
+	return len(attackersOf(b, sq, piece.Color())) > 0
+}
+
+// attackersOf lists the squares of color's pieces attacking target.
+func attackersOf(b *chess.Board, target chess.Square, color chess.Color) []chess.Square {
+	var out []chess.Square
+	for sq, p := range b.SquareMap() {
+		if p.Color() == color && sq != target && attacks(b, sq, p, target) {
+			out = append(out, sq)
+		}
+	}
+	return out
+}
+
+// attacks reports whether p on from attacks to, ignoring pins.
+func attacks(b *chess.Board, from chess.Square, p chess.Piece, to chess.Square) bool {
+	df := int(to.File()) - int(from.File())
+	dr := int(to.Rank()) - int(from.Rank())
+	adf, adr := abs(df), abs(dr)
+
+	switch p.Type() {
+	case chess.Pawn:
+		dir := 1
+		if p.Color() == chess.Black {
+			dir = -1
+		}
+		return dr == dir && adf == 1
+	case chess.Knight:
+		return (adf == 1 && adr == 2) || (adf == 2 && adr == 1)
+	case chess.King:
+		return max(adf, adr) == 1
+	case chess.Bishop:
+		return adf == adr && adf > 0 && clearPath(b, from, df, dr)
+	case chess.Rook:
+		return (df == 0) != (dr == 0) && clearPath(b, from, df, dr)
+	case chess.Queen:
+		return ((adf == adr && adf > 0) || (df == 0) != (dr == 0)) && clearPath(b, from, df, dr)
+	}
+	return false
+}
+
+// clearPath reports whether the squares strictly between from and from+(df,dr)
+// on a straight line are empty.
+func clearPath(b *chess.Board, from chess.Square, df, dr int) bool {
+	sf, sr := sign(df), sign(dr)
+	steps := max(abs(df), abs(dr))
+	for i := 1; i < steps; i++ {
+		sq := chess.NewSquare(chess.File(int(from.File())+i*sf), chess.Rank(int(from.Rank())+i*sr))
+		if b.Piece(sq) != chess.NoPiece {
+			return false
+		}
+	}
+	return true
+}
+
+func kingSquare(b *chess.Board, color chess.Color) chess.Square {
+	for sq, p := range b.SquareMap() {
+		if p.Type() == chess.King && p.Color() == color {
+			return sq
+		}
+	}
+	return chess.NoSquare
+}
+
+func onBoard(f, r int) bool {
+	return f >= 0 && f < 8 && r >= 0 && r < 8
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
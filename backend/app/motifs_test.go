@@ -0,0 +1,146 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"example/my-go-api/app/models"
+
+	"github.com/notnil/chess"
+)
+
+func motifPosition(t *testing.T, fen string) *chess.Position {
+	t.Helper()
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		t.Fatalf("bad fen %q: %v", fen, err)
+	}
+	return chess.NewGame(opt).Position()
+}
+
+func motifMove(t *testing.T, pos *chess.Position, uci string) *chess.Move {
+	t.Helper()
+	m := findMoveByUCI(pos, uci)
+	if m == nil {
+		t.Fatalf("illegal move %s in %s", uci, pos.String())
+	}
+	return m
+}
+
+func TestDetectMotifs(t *testing.T) {
+	recaptureFrom := motifPosition(t, "4k3/8/4n3/8/3N4/4P3/8/4K3 b - - 0 1")
+	prev := motifMove(t, recaptureFrom, "e6d4")
+
+	cases := []struct {
+		name   string
+		before *chess.Position
+		move   string
+		prev   *chess.Move
+		score  models.UCIScore
+		reply  models.UCIScore
+		error  bool
+		want   []string
+	}{
+		{
+			name:   "knight put en prise",
+			before: motifPosition(t, "4k3/8/8/8/3p4/8/8/4KN2 w - - 0 1"),
+			move:   "f1e3",
+			score:  models.UCIScore{CP: intPtr(0), Best: "e1e2"},
+			reply:  models.UCIScore{CP: intPtr(300), Best: "d4e3"},
+			error:  true,
+			want:   []string{MotifHangingPiece},
+		},
+		{
+			name:   "missed knight fork",
+			before: motifPosition(t, "q3k3/8/8/1N6/8/8/8/4K3 w - - 0 1"),
+			move:   "e1e2",
+			score:  models.UCIScore{CP: intPtr(600), Best: "b5c7"},
+			reply:  models.UCIScore{CP: intPtr(900)},
+			error:  true,
+			want:   []string{MotifMissedFork},
+		},
+		{
+			name:   "missed pin",
+			before: motifPosition(t, "4k3/8/2n5/8/8/8/8/4KB2 w - - 0 1"),
+			move:   "e1d1",
+			score:  models.UCIScore{CP: intPtr(150), Best: "f1b5"},
+			reply:  models.UCIScore{CP: intPtr(0)},
+			error:  true,
+			want:   []string{MotifPin},
+		},
+		{
+			name:   "rook leaves the back rank",
+			before: motifPosition(t, "3r2k1/5ppp/8/8/8/8/5PPP/R5K1 b - - 0 1"),
+			move:   "d8d7",
+			score:  models.UCIScore{CP: intPtr(0), Best: "h7h6"},
+			reply:  models.UCIScore{Mate: intPtr(2), Best: "a1a8", PV: []string{"a1a8", "d7d8", "a8d8"}},
+			want:   []string{MotifAllowedMate, MotifBackRank},
+		},
+		{
+			name:   "missed mate",
+			before: motifPosition(t, "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1"),
+			move:   "g1f1",
+			score:  models.UCIScore{Mate: intPtr(1), Best: "a1a8"},
+			reply:  models.UCIScore{CP: intPtr(-50)},
+			want:   []string{MotifMissedMate},
+		},
+		{
+			name:   "missed recapture",
+			before: recaptureFrom.Update(prev),
+			move:   "e1d1",
+			prev:   prev,
+			score:  models.UCIScore{CP: intPtr(0), Best: "e3d4"},
+			reply:  models.UCIScore{CP: intPtr(300)},
+			error:  true,
+			want:   []string{MotifMissedRecapture},
+		},
+		{
+			name:   "accurate move",
+			before: motifPosition(t, "4k3/8/8/8/3p4/8/8/4KN2 w - - 0 1"),
+			move:   "f1e3",
+			score:  models.UCIScore{CP: intPtr(0), Best: "e1e2"},
+			reply:  models.UCIScore{CP: intPtr(300), Best: "d4e3"},
+			want:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := detectMotifs(motifInput{
+				Before:      tc.before,
+				Move:        motifMove(t, tc.before, tc.move),
+				PrevMove:    tc.prev,
+				BeforeScore: tc.score,
+				AfterScore:  tc.reply,
+				IsError:     tc.error,
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("detectMotifs = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsTrapped(t *testing.T) {
+	trapped := motifPosition(t, "r3k3/B1p5/1p6/8/8/8/8/4K3 w - - 0 1")
+	if !isTrapped(trapped, chess.A7, chess.White) {
+		t.Fatalf("bishop on a7 should be trapped")
+	}
+	free := motifPosition(t, "r3k3/B7/1p6/8/8/8/8/4K3 w - - 0 1")
+	if isTrapped(free, chess.A7, chess.White) {
+		t.Fatalf("bishop on a7 can escape via b6")
+	}
+}
+
+func TestFinishMotifStats(t *testing.T) {
+	got := finishMotifStats([]models.MotifStat{
+		{Motif: MotifPin, Count: 2, BlunderCount: 1},
+		{Motif: MotifHangingPiece, Count: 4, BlunderCount: 2},
+	}, 10, 5)
+	if len(got) != 2 || got[0].Motif != MotifHangingPiece {
+		t.Fatalf("expected hanging_piece first, got %+v", got)
+	}
+	if got[0].ShareOfErrors != 0.4 || got[0].ShareOfBlunders != 0.4 || got[1].ShareOfBlunders != 0.2 {
+		t.Fatalf("unexpected shares: %+v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"example/my-go-api/app/models"
+)
+
+// OfflineReport is what `chessgaps analyze` writes: the same error positions
+// GET /errors/:username returns, plus what happened to the file's games.
+type OfflineReport struct {
+	Player          string                        `json:"player"`
+	Source          string                        `json:"source"`
+	GamesInFile     int                           `json:"games_in_file"`
+	OtherPlayers    int                           `json:"skipped_other_players"` // games player did not play
+	SkippedVariants int                           `json:"skipped_variants"`
+	GamesAnalyzed   int                           `json:"games_analyzed"`
+	GamesFailed     int                           `json:"games_failed"`
+	Unscored        int                           `json:"positions_unscored"` // positions the engine gave no score for
+	Failures        []GameFailure                 `json:"failures"`           // games the engine could not analyse
+	Settings        models.EngineSettings         `json:"engine_settings"`
+	Positions       []models.SuboptimalFensReport `json:"positions"`
+}
+
+// AnalyzePGNFile imports player's games from a PGN file into the stores,
+// analyses them through ProcessBatch, and collects every page of the
+// error-position report for q over those games alone. With a persistent store,
+// games from earlier runs and other files are neither re-analysed nor reported.
+// Games the engine fails on are counted in GamesFailed rather than failing the run.
+func (a *App) AnalyzePGNFile(ctx context.Context, pgn, player, source string, settings models.EngineSettings, q ErrorPositionQuery) (OfflineReport, error) {
+	username := strings.ToLower(player)
+	games, others := GamesFromPGN(pgn, username, source)
+	games, skippedVariants := filterSupportedVariants(games)
+	fillMissingOpenings(ctx, games)
+
+	r := OfflineReport{
+		Player:          player,
+		Source:          source,
+		GamesInFile:     len(games) + others + skippedVariants,
+		OtherPlayers:    others,
+		SkippedVariants: skippedVariants,
+		Settings:        settings,
+		Failures:        []GameFailure{},
+		Positions:       []models.SuboptimalFensReport{},
+	}
+	if len(games) == 0 {
+		return r, fmt.Errorf("no games for %s in %s", player, source)
+	}
+	if err := a.Stores.Games.SaveGames(ctx, username, games); err != nil {
+		return r, fmt.Errorf("save games: %w", err)
+	}
+
+	urls := make([]string, len(games))
+	for i, g := range games {
+		urls[i] = g.URL
+	}
+	ids, err := a.Stores.Games.GameIDsByURL(ctx, username, urls)
+	if err != nil {
+		return r, fmt.Errorf("look up imported games: %w", err)
+	}
+	job := models.JobMessage{
+		User:           username,
+		NumGames:       len(ids),
+		GameIDs:        ids,
+		EngineDepth:    settings.Depth,
+		EngineMoveTime: settings.MoveTimeMS,
+		EngineUseDepth: settings.UseDepth,
+	}
+	res, err := a.ProcessBatch(WithJobLogger(ctx, job), job)
+	if err != nil {
+		return r, err
+	}
+	r.GamesAnalyzed = res.Analyzed
+	r.GamesFailed = res.Games - res.Analyzed
+	r.Unscored = res.Unscored
+	if res.Failures != nil {
+		r.Failures = res.Failures
+	}
+
+	q.GameIDs = ids
+	q.Limit = maxErrorPositionLimit
+	for {
+		page, next, err := a.Stores.Moves.FindErrorPositions(ctx, username, q)
+		if err != nil {
+			return r, fmt.Errorf("error positions: %w", err)
+		}
+		r.Positions = append(r.Positions, page...)
+		if next == "" {
+			return r, nil
+		}
+		q.Cursor = next
+	}
+}
+
+//go:embed offline_report.html.tmpl
+var offlineReportHTML string
+
+var offlineReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"add1":      func(i int) int { return i + 1 },
+	"hasPrefix": strings.HasPrefix,
+	"percent":   func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	// Lichess's analysis board takes the FEN in the path with spaces as underscores.
+	"analysisURL": func(fen string) string {
+		return "https://lichess.org/analysis/" + strings.ReplaceAll(fen, " ", "_")
+	},
+}).Parse(offlineReportHTML))
+
+// WriteOfflineReportHTML renders r as a standalone HTML page.
+func WriteOfflineReportHTML(w io.Writer, r OfflineReport) error {
+	return offlineReportTemplate.Execute(w, r)
+}
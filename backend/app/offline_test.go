@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/models"
+)
+
+// lossyEngine rates every position +60 for the side to move, so every move
+// loses 120 centipawns and is a mistake, too small a swing for a missed win.
+const lossyEngine = `while read cmd; do
+  case "$cmd" in
+    uci) echo "id name fake"; echo uciok ;;
+    isready) echo readyok ;;
+    go*) echo "info depth 1 score cp 60 pv e2e4"; echo "bestmove e2e4" ;;
+    quit) exit 0 ;;
+  esac
+done
+`
+
+func TestAnalyzePGNFileReportsRepeatedErrors(t *testing.T) {
+	store, err := OpenSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	a := &App{
+		Config:  &config.Config{Engine: config.EngineConfig{Path: writeEngine(t, lossyEngine), NumMoves: 10}},
+		Workers: 1,
+		Stores:  StoresFrom(store),
+	}
+
+	var pgn strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&pgn, "[White \"Alice\"]\n[Black \"bob%d\"]\n[Result \"0-1\"]\n\n1. e4 e5 2. Nf3 Nc6 0-1\n\n", i)
+	}
+	pgn.WriteString("[White \"carol\"]\n[Black \"bob\"]\n[Result \"1-0\"]\n\n1. d4 1-0\n")
+
+	q := DefaultErrorPositionQuery()
+	r, err := a.AnalyzePGNFile(context.Background(), pgn.String(), "Alice", "games.pgn", models.EngineSettings{MoveTimeMS: 10}, q)
+	if err != nil {
+		t.Fatalf("AnalyzePGNFile: %v", err)
+	}
+	if r.GamesInFile != 4 || r.OtherPlayers != 1 || r.GamesAnalyzed != 3 {
+		t.Fatalf("report counts = %+v", r)
+	}
+	// Alice is white: the start position and the one after 1. e4 e5.
+	if len(r.Positions) != 2 {
+		t.Fatalf("expected 2 error positions, got %d", len(r.Positions))
+	}
+	for _, p := range r.Positions {
+		if p.BadFen.TimesSeen != 3 || p.BadFen.ErrorCount != 3 || len(p.Moves) != 3 {
+			t.Fatalf("position %s seen %d, misplayed %d, %d moves", p.BadFen.NormalizedFenBefore, p.BadFen.TimesSeen, p.BadFen.ErrorCount, len(p.Moves))
+		}
+	}
+
+	var html strings.Builder
+	if err := WriteOfflineReportHTML(&html, r); err != nil {
+		t.Fatalf("WriteOfflineReportHTML: %v", err)
+	}
+	for _, want := range []string{"Repeated errors: Alice", "https://lichess.org/analysis/rnbqkbnr/pppppppp/", "games.pgn#1", "mistake"} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+}
+
+func TestAnalyzePGNFileReportsOnlyTheFile(t *testing.T) {
+	a := &App{
+		Config:  &config.Config{Engine: config.EngineConfig{Path: writeEngine(t, lossyEngine), NumMoves: 10}},
+		Workers: 1,
+		Stores:  StoresFrom(newTestSQLiteStore(t)),
+	}
+	file := func(n int, opponent string) string {
+		var pgn strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&pgn, "[White \"Alice\"]\n[Black \"%s%d\"]\n[Result \"0-1\"]\n\n1. e4 e5 2. Nf3 Nc6 0-1\n\n", opponent, i)
+		}
+		return pgn.String()
+	}
+	analyse := func(source, pgn string) OfflineReport {
+		t.Helper()
+		r, err := a.AnalyzePGNFile(context.Background(), pgn, "Alice", source, models.EngineSettings{MoveTimeMS: 10}, DefaultErrorPositionQuery())
+		if err != nil {
+			t.Fatalf("AnalyzePGNFile %s: %v", source, err)
+		}
+		return r
+	}
+
+	if r := analyse("old.pgn", file(3, "bob")); r.GamesAnalyzed != 3 || len(r.Positions) != 2 {
+		t.Fatalf("old.pgn: analysed %d, %d positions", r.GamesAnalyzed, len(r.Positions))
+	}
+	// One game is seen once, below the report's threshold, whatever old.pgn held.
+	if r := analyse("new.pgn", file(1, "carol")); r.GamesAnalyzed != 1 || len(r.Positions) != 0 {
+		t.Fatalf("new.pgn: analysed %d, positions %+v", r.GamesAnalyzed, r.Positions)
+	}
+	// Importing old.pgn again reports its games alone, not new.pgn's as well.
+	r := analyse("old.pgn", file(3, "bob"))
+	if r.GamesAnalyzed != 3 || len(r.Positions) != 2 {
+		t.Fatalf("old.pgn again: analysed %d, %d positions", r.GamesAnalyzed, len(r.Positions))
+	}
+	for _, p := range r.Positions {
+		if p.BadFen.TimesSeen != 3 {
+			t.Fatalf("position %s seen %d times, want 3", p.BadFen.NormalizedFenBefore, p.BadFen.TimesSeen)
+		}
+	}
+}
+
+func TestAnalyzePGNFileReportsFailedGames(t *testing.T) {
+	store, err := OpenSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	// The engine dies on every search, so each game fails and is restarted for.
+	crashing := `while read cmd; do
+  case "$cmd" in
+    uci) echo uciok ;;
+    isready) echo readyok ;;
+    go*) exit 1 ;;
+    quit) exit 0 ;;
+  esac
+done
+`
+	a := &App{
+		Config:  &config.Config{Engine: config.EngineConfig{Path: writeEngine(t, crashing), NumMoves: 10}},
+		Stores:  StoresFrom(store),
+		Workers: 1,
+	}
+	pgn := "[White \"Alice\"]\n[Black \"bob\"]\n\n1. e4 e5 *\n\n[White \"bob\"]\n[Black \"Alice\"]\n\n1. d4 d5 *\n"
+
+	r, err := a.AnalyzePGNFile(context.Background(), pgn, "Alice", "games.pgn", models.EngineSettings{MoveTimeMS: 10}, DefaultErrorPositionQuery())
+	if err != nil {
+		t.Fatalf("AnalyzePGNFile: %v", err)
+	}
+	if r.GamesAnalyzed != 0 || r.GamesFailed != 2 || len(r.Failures) != 2 {
+		t.Fatalf("report counts = analysed %d, failed %d, failures %+v", r.GamesAnalyzed, r.GamesFailed, r.Failures)
+	}
+
+	var html strings.Builder
+	if err := WriteOfflineReportHTML(&html, r); err != nil {
+		t.Fatalf("WriteOfflineReportHTML: %v", err)
+	}
+	if !strings.Contains(html.String(), "2 failed") || !strings.Contains(html.String(), "Games not analysed") {
+		t.Errorf("HTML report should list the failed games:\n%s", html.String())
+	}
+}
+
+func TestAnalyzePGNFileCountsUnscoredPositions(t *testing.T) {
+	store, err := OpenSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	// The engine names a move but never a score.
+	silent := `while read cmd; do
+  case "$cmd" in
+    uci) echo uciok ;;
+    isready) echo readyok ;;
+    go*) echo "bestmove e2e4" ;;
+    quit) exit 0 ;;
+  esac
+done
+`
+	a := &App{
+		Config:  &config.Config{Engine: config.EngineConfig{Path: writeEngine(t, silent), NumMoves: 10}},
+		Stores:  StoresFrom(store),
+		Workers: 1,
+	}
+	pgn := "[White \"Alice\"]\n[Black \"bob\"]\n\n1. e4 e5 2. Nf3 *\n"
+
+	r, err := a.AnalyzePGNFile(context.Background(), pgn, "Alice", "games.pgn", models.EngineSettings{Depth: 30, UseDepth: true}, DefaultErrorPositionQuery())
+	if err != nil {
+		t.Fatalf("AnalyzePGNFile: %v", err)
+	}
+	if r.GamesAnalyzed != 1 || r.Unscored != 3 {
+		t.Fatalf("report = analysed %d, unscored %d; want 1 and 3", r.GamesAnalyzed, r.Unscored)
+	}
+}
+
+func TestWithEvalTimeout(t *testing.T) {
+	ctx, cancel := withEvalTimeout(context.Background(), models.EngineSettings{Depth: 30, UseDepth: true})
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("a depth search should only be bounded by the caller")
+	}
+
+	ctx, cancel = withEvalTimeout(context.Background(), models.EngineSettings{MoveTimeMS: 5000})
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || time.Until(d) < 15*time.Second {
+		t.Fatalf("a 5s movetime search should get room beyond 2s, deadline %v", d)
+	}
+
+	parent, stop := context.WithCancel(context.Background())
+	ctx, cancel = withEvalTimeout(parent, models.EngineSettings{Depth: 30, UseDepth: true})
+	defer cancel()
+	stop()
+	if ctx.Err() == nil {
+		t.Fatal("the search context should end with the caller's")
+	}
+}
+
+func TestAnalyzePGNFileWithoutPlayerGames(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	_, err := a.AnalyzePGNFile(context.Background(), "[White \"carol\"]\n[Black \"bob\"]\n\n1. d4 *\n", "alice", "games.pgn", models.EngineSettings{MoveTimeMS: 10}, DefaultErrorPositionQuery())
+	if err == nil {
+		t.Fatal("expected an error when the file has no games by the player")
+	}
+}
@@ -0,0 +1,151 @@
+// Package app normalizes provider opening metadata into structured fields.
+package app
+
+import (
+	"context"
+	"strings"
+
+	"example/my-go-api/app/eco"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/models"
+)
+
+// familyEndings mark the last word of an opening family in names that have no
+// "Family: Variation" separator (Chess.com slugs), e.g. "Sicilian Defense Najdorf Variation".
+var familyEndings = map[string]bool{
+	"Opening": true,
+	"Defense": true,
+	"Defence": true,
+	"Game":    true,
+	"Gambit":  true,
+	"Attack":  true,
+	"System":  true,
+}
+
+// openingFromLichess maps the opening block of a Lichess export.
+func openingFromLichess(g models.LichessGame) models.OpeningInfo {
+	if g.Opening == nil {
+		return OpeningFromPGNTags(g.PGN)
+	}
+	info := models.OpeningInfo{
+		ECOCode:     strings.TrimSpace(g.Opening.ECO),
+		OpeningName: strings.TrimSpace(g.Opening.Name),
+		OpeningPly:  g.Opening.Ply,
+	}
+	info.OpeningFamily, info.OpeningVariation = splitOpeningName(info.OpeningName)
+	return info
+}
+
+// openingFromChessDotCom maps Chess.com's PGN tags, falling back to the ECO URL
+// from the archive when the PGN has none.
+func openingFromChessDotCom(g models.Game) models.OpeningInfo {
+	info := OpeningFromPGNTags(g.PGN)
+	if info.OpeningName == "" && g.ECO != "" {
+		info.OpeningName = openingNameFromURL(g.ECO)
+		info.OpeningFamily, info.OpeningVariation = splitOpeningName(info.OpeningName)
+	}
+	return info
+}
+
+// OpeningFromPGNTags derives opening metadata from stored PGN tags. Lichess PGNs
+// carry an "Opening" tag and Chess.com PGNs an "ECOUrl" tag; both carry "ECO".
+// Chess.com's slugs lose hyphens and split family from variation differently
+// ("Queen's Gambit Declined Exchange Variation"), so Chess.com games are named
+// from the embedded book, which uses Lichess's names, and fall back to the slug
+// only for games that never reach a book position.
+func OpeningFromPGNTags(pgn string) models.OpeningInfo {
+	info := models.OpeningInfo{ECOCode: strings.TrimSpace(PGNTag(pgn, "ECO"))}
+	if info.ECOCode == "?" {
+		info.ECOCode = ""
+	}
+	if name := strings.TrimSpace(PGNTag(pgn, "Opening")); name != "" && name != "?" {
+		info.OpeningName = name
+	} else if book, ok := classifyStandardStart(pgn); ok {
+		return book
+	} else if url := PGNTag(pgn, "ECOUrl"); url != "" {
+		info.OpeningName = openingNameFromURL(url)
+	}
+	info.OpeningFamily, info.OpeningVariation = splitOpeningName(info.OpeningName)
+	return info
+}
+
+// classifyStandardStart is ClassifyOpening for games from the initial position;
+// unparsable PGNs count as unclassified.
+func classifyStandardStart(pgn string) (models.OpeningInfo, bool) {
+	if StartFENFromPGN(pgn) != "" {
+		return models.OpeningInfo{}, false
+	}
+	info, ok, err := ClassifyOpening(pgn)
+	return info, ok && err == nil
+}
+
+// openingNameFromURL turns a Chess.com opening URL into a name, restoring the
+// apostrophes the slug drops ("Queen-s-Gambit" -> "Queen's Gambit").
+func openingNameFromURL(ecoURL string) string {
+	name := NormalizeECO(ecoURL)
+	if name == "" {
+		return ""
+	}
+	name = strings.ReplaceAll(" "+name+" ", " s ", "'s ")
+	return strings.TrimSpace(name)
+}
+
+// splitOpeningName splits "Family: Variation, Subvariation" names. Names without
+// a colon are split after the first word that usually ends a family name.
+func splitOpeningName(name string) (family, variation string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ""
+	}
+	if idx := strings.Index(name, ":"); idx != -1 {
+		return strings.TrimSpace(name[:idx]), strings.TrimSpace(name[idx+1:])
+	}
+
+	fields := strings.Fields(name)
+	for i, tok := range fields {
+		if familyEndings[tok] {
+			return strings.Join(fields[:i+1], " "), strings.Join(fields[i+1:], " ")
+		}
+	}
+	return name, ""
+}
+
+// ClassifyOpening identifies a standard-start game's opening from its moves using
+// the built-in book. ok is false when the game never reached a book position.
+func ClassifyOpening(pgn string) (info models.OpeningInfo, ok bool, err error) {
+	book, err := eco.Default()
+	if err != nil {
+		return models.OpeningInfo{}, false, err
+	}
+	o, ok, err := book.ClassifyPGN(pgn)
+	if err != nil || !ok {
+		return models.OpeningInfo{}, false, err
+	}
+	info = models.OpeningInfo{
+		ECOCode:     o.ECO,
+		OpeningName: o.Name,
+		OpeningPly:  o.Ply,
+	}
+	info.OpeningFamily, info.OpeningVariation = splitOpeningName(info.OpeningName)
+	return info, true, nil
+}
+
+// fillMissingOpenings classifies games whose provider sent no opening metadata.
+// Games set up from a custom position are left alone since the book assumes the
+// standard start.
+func fillMissingOpenings(ctx context.Context, games []models.GameLite) {
+	for i := range games {
+		g := &games[i]
+		if g.ECOCode != "" || g.OpeningName != "" || g.StartFEN != "" {
+			continue
+		}
+		info, ok, err := ClassifyOpening(g.PGN)
+		if err != nil {
+			logging.FromContext(ctx).Warn("opening classification failed", "url", g.URL, "err", err)
+			continue
+		}
+		if ok {
+			g.OpeningInfo = info
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"example/my-go-api/app/models"
+)
+
+func TestSplitOpeningName(t *testing.T) {
+	cases := []struct {
+		name, family, variation string
+	}{
+		{"Sicilian Defense: Najdorf Variation, English Attack", "Sicilian Defense", "Najdorf Variation, English Attack"},
+		{"Scotch Game Classical Potter Variation", "Scotch Game", "Classical Potter Variation"},
+		{"Queen's Gambit", "Queen's Gambit", ""},
+		{"Mieses", "Mieses", ""},
+		{"", "", ""},
+	}
+	for _, tc := range cases {
+		family, variation := splitOpeningName(tc.name)
+		if family != tc.family || variation != tc.variation {
+			t.Fatalf("splitOpeningName(%q) = (%q, %q), want (%q, %q)", tc.name, family, variation, tc.family, tc.variation)
+		}
+	}
+}
+
+func TestOpeningFromChessDotComMatchesLichess(t *testing.T) {
+	cases := []struct {
+		url, moves, lichessName string
+	}{
+		{
+			"https://www.chess.com/openings/Queen-s-Gambit-Declined-Exchange-Variation-4.cxd5",
+			"1. d4 d5 2. c4 e6 3. Nc3 Nf6 4. cxd5 *",
+			"Queen's Gambit Declined: Exchange Variation",
+		},
+		{
+			"https://www.chess.com/openings/Caro-Kann-Defense-2.d4",
+			"1. e4 c6 2. d4 *",
+			"Caro-Kann Defense",
+		},
+	}
+	for _, tc := range cases {
+		g := models.Game{
+			ECO: tc.url,
+			PGN: "[ECO \"D35\"]\n[ECOUrl \"" + tc.url + "\"]\n\n" + tc.moves,
+		}
+		got := openingFromChessDotCom(g)
+
+		var lg models.LichessGame
+		if err := json.Unmarshal([]byte(`{"opening":{"name":"`+tc.lichessName+`"}}`), &lg); err != nil {
+			t.Fatalf("json.Unmarshal error = %v", err)
+		}
+		want := openingFromLichess(lg)
+		if got.OpeningName != want.OpeningName || got.OpeningFamily != want.OpeningFamily || got.OpeningVariation != want.OpeningVariation {
+			t.Fatalf("chess.com %s = %+v, want the Lichess naming %+v", tc.url, got, want)
+		}
+	}
+}
+
+func TestOpeningFromChessDotComOffBook(t *testing.T) {
+	g := models.Game{
+		ECO: "https://www.chess.com/openings/Mieses-Opening",
+		PGN: "[ECO \"A00\"]\n\n*",
+	}
+	got := openingFromChessDotCom(g)
+	if got.ECOCode != "A00" || got.OpeningName != "Mieses Opening" || got.OpeningFamily != "Mieses Opening" {
+		t.Fatalf("off-book game should fall back to the slug, got %+v", got)
+	}
+}
+
+func TestOpeningFromLichess(t *testing.T) {
+	var g models.LichessGame
+	data := `{"opening":{"eco":"B90","name":"Sicilian Defense: Najdorf Variation","ply":11}}`
+	if err := json.Unmarshal([]byte(data), &g); err != nil {
+		t.Fatalf("json.Unmarshal error = %v", err)
+	}
+	got := openingFromLichess(g)
+	want := models.OpeningInfo{
+		ECOCode:          "B90",
+		OpeningName:      "Sicilian Defense: Najdorf Variation",
+		OpeningFamily:    "Sicilian Defense",
+		OpeningVariation: "Najdorf Variation",
+		OpeningPly:       11,
+	}
+	if got != want {
+		t.Fatalf("openingFromLichess = %+v, want %+v", got, want)
+	}
+}
+
+func TestOpeningFromPGNTagsLichess(t *testing.T) {
+	pgn := "[ECO \"C00\"]\n[Opening \"French Defense: Normal Variation\"]\n\n1. e4 e6 *"
+	got := OpeningFromPGNTags(pgn)
+	if got.ECOCode != "C00" || got.OpeningFamily != "French Defense" || got.OpeningVariation != "Normal Variation" {
+		t.Fatalf("OpeningFromPGNTags = %+v", got)
+	}
+}
+
+func TestFillMissingOpenings(t *testing.T) {
+	games := []models.GameLite{
+		{URL: "missing", PGN: "[Event \"Upload\"]\n\n1. e4 {[%clk 0:05:00]} e6 {[%clk 0:05:00]} 2. d4 d5 *"},
+		{URL: "provided", PGN: "1. e4 e6 *", OpeningInfo: models.OpeningInfo{ECOCode: "C00", OpeningName: "French Defense"}},
+		{URL: "custom", PGN: "1. e4 e6 *", StartFEN: "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"},
+	}
+	fillMissingOpenings(context.Background(), games)
+
+	if games[0].ECOCode != "C00" || games[0].OpeningFamily != "French Defense" || games[0].OpeningPly != 4 {
+		t.Fatalf("classified opening = %+v", games[0].OpeningInfo)
+	}
+	if games[1].OpeningName != "French Defense" || games[1].OpeningPly != 0 {
+		t.Fatalf("provider metadata should be kept, got %+v", games[1].OpeningInfo)
+	}
+	if games[2].ECOCode != "" {
+		t.Fatalf("custom start games should not be classified, got %+v", games[2].OpeningInfo)
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+)
+
+// SplitPGN splits a PGN file holding any number of games into one string per
+// game, each with its tag pairs and movetext.
+func SplitPGN(text string) []string {
+	text = strings.TrimPrefix(text, "\ufeff") // byte order mark
+	var games []string
+	var cur strings.Builder
+	inMoves := false
+	flush := func() {
+		if g := strings.TrimSpace(cur.String()); g != "" {
+			games = append(games, g)
+		}
+		cur.Reset()
+		inMoves = false
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		isTag := reTagPair.MatchString(trimmed)
+		if isTag && inMoves {
+			flush()
+		}
+		if !isTag && trimmed != "" {
+			inMoves = true
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+	}
+	flush()
+	return games
+}
+
+// GamesFromPGN maps each game in a PGN file onto a GameLite from player's
+// point of view, the way the providers do. Games player did not play are
+// skipped and counted. Games without a Link or URL Site tag get a URL made
+// from source and their position in the file, so re-imports update them.
+func GamesFromPGN(text, player, source string) (games []models.GameLite, skipped int) {
+	for i, pgn := range SplitPGN(text) {
+		tags := map[string]string{}
+		for _, m := range reTagPair.FindAllStringSubmatch(pgn, -1) {
+			tags[m[1]] = m[2]
+		}
+		s := BuildTagSummary(tags, player)
+		if s.Color == "" {
+			skipped++
+			continue
+		}
+
+		url := s.Link
+		if url == "" && strings.HasPrefix(s.Site, "http") {
+			url = s.Site
+		}
+		if url == "" {
+			url = fmt.Sprintf("%s#%d", source, i+1)
+		}
+
+		eco := tags["Opening"]
+		if eco == "" {
+			eco = s.ECO
+		}
+
+		games = append(games, models.GameLite{
+			URL:         url,
+			When:        pgnTimestamp(s),
+			Color:       s.Color,
+			Opponent:    s.Opponent,
+			OppRating:   s.OppRating,
+			Result:      lichessResultForUser(pgnWinner(s.Result), s.Color),
+			Rated:       strings.HasPrefix(strings.ToLower(s.Event), "rated"),
+			TimeClass:   timeClassFromControl(s.TimeControl),
+			TimeControl: s.TimeControl,
+			PGN:         pgn,
+			ECO:         eco,
+			Variant:     lichessVariant(strings.ReplaceAll(tags["Variant"], " ", "")),
+			StartFEN:    StartFENFromPGN(pgn),
+		})
+	}
+	return games, skipped
+}
+
+// pgnTimestamp reads UTCDate/UTCTime, falling back to Date; 0 when unknown.
+func pgnTimestamp(s TagSummary) int64 {
+	if t, err := time.Parse("2006.01.02 15:04:05", s.UTCDate+" "+s.UTCTime); err == nil {
+		return t.Unix()
+	}
+	if t, err := time.Parse("2006.01.02", s.Date); err == nil {
+		return t.Unix()
+	}
+	return 0
+}
+
+// pgnWinner turns a Result tag into "white", "black" or "" for a draw or
+// unfinished game.
+func pgnWinner(result string) string {
+	switch result {
+	case "1-0":
+		return "white"
+	case "0-1":
+		return "black"
+	}
+	return ""
+}
+
+// timeClassFromControl buckets a TimeControl tag ("300+3", "1/259200", "-") by
+// Lichess's estimate of base + 40 increments.
+func timeClassFromControl(tc string) string {
+	if tc == "" || tc == "-" || strings.Contains(tc, "/") {
+		return "daily"
+	}
+	base, inc, _ := strings.Cut(tc, "+")
+	b, err := strconv.Atoi(base)
+	if err != nil {
+		return ""
+	}
+	i, _ := strconv.Atoi(inc)
+	switch est := b + 40*i; {
+	case est < 180:
+		return "bullet"
+	case est < 480:
+		return "blitz"
+	case est < 1500:
+		return "rapid"
+	default:
+		return "classical"
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+const twoGamesPGN = "\ufeff" + `[Event "Rated blitz game"]
+[Site "https://lichess.org/abcd1234"]
+[UTCDate "2024.03.01"]
+[UTCTime "12:00:00"]
+[White "Alice"]
+[Black "bob"]
+[WhiteElo "1500"]
+[BlackElo "1620"]
+[Result "0-1"]
+[TimeControl "180+2"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 0-1
+
+[Event "Casual game"]
+[Site "Club night"]
+[Date "2024.03.02"]
+[White "carol"]
+[Black "alice"]
+[Result "1/2-1/2"]
+[TimeControl "-"]
+
+1. d4 d5 1/2-1/2
+`
+
+func TestSplitPGN(t *testing.T) {
+	games := SplitPGN(twoGamesPGN)
+	if len(games) != 2 {
+		t.Fatalf("expected 2 games, got %d: %q", len(games), games)
+	}
+	if !strings.HasPrefix(games[1], `[Event "Casual game"]`) {
+		t.Fatalf("second game should start at its tags, got %q", games[1])
+	}
+}
+
+func TestGamesFromPGNPlayerPointOfView(t *testing.T) {
+	games, skipped := GamesFromPGN(twoGamesPGN, "alice", "club.pgn")
+	if len(games) != 2 || skipped != 0 {
+		t.Fatalf("got %d games, %d skipped", len(games), skipped)
+	}
+
+	g := games[0]
+	if g.URL != "https://lichess.org/abcd1234" || g.Color != "white" || g.Opponent != "bob" || g.OppRating != 1620 {
+		t.Fatalf("first game = %+v", g)
+	}
+	if g.Result != "loss" || !g.Rated || g.TimeClass != "blitz" || g.When != 1709294400 {
+		t.Fatalf("first game result/rated/class/when = %s %v %s %d", g.Result, g.Rated, g.TimeClass, g.When)
+	}
+
+	g = games[1]
+	if g.URL != "club.pgn#2" || g.Color != "black" || g.Result != "draw" || g.Rated || g.TimeClass != "daily" {
+		t.Fatalf("second game = %+v", g)
+	}
+
+	if games, skipped := GamesFromPGN(twoGamesPGN, "dave", "club.pgn"); len(games) != 0 || skipped != 2 {
+		t.Fatalf("dave: got %d games, %d skipped", len(games), skipped)
+	}
+}
+
+func TestTimeClassFromControl(t *testing.T) {
+	for tc, want := range map[string]string{
+		"60":        "bullet",
+		"120+1":     "bullet",
+		"180+2":     "blitz",
+		"600":       "rapid",
+		"1800+30":   "classical",
+		"1/259200":  "daily",
+		"-":         "daily",
+		"not a tc!": "",
+	} {
+		if got := timeClassFromControl(tc); got != want {
+			t.Errorf("timeClassFromControl(%q) = %q, want %q", tc, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package app walks PGN movetext including variations into a tree of positions.
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// rePGNToken splits movetext into comments, NAGs, variation brackets, move
+// numbers, results and SAN moves. Order matters: move numbers and results must
+// be tried before the catch-all SAN token.
+var rePGNToken = regexp.MustCompile(`\{[^}]*\}|;[^\n]*|\$\d+|\(|\)|\d+\.(?:\.\.)?|1-0|0-1|1/2-1/2|\*|[^\s(){};]+`)
+
+// pgnTreeEdge is one move of a PGN game or any of its variations.
+type pgnTreeEdge struct {
+	FenBefore  string // normalized FEN of the position the move is played from
+	SideToMove string // "w" or "b"
+	MoveUCI    string
+	MoveSAN    string
+	Ply        int    // 1-based ply from the game's starting position
+	Line       string // movetext leading to FenBefore, e.g. "1. e4 c5 2. Nf3"
+}
+
+type pgnTreeState struct {
+	cur  *chess.Position
+	prev *chess.Position
+	path []string
+}
+
+// parsePGNTree reads one or more PGN games (tag sections separate games) and
+// returns every move on every variation, deduplicated by position and move.
+func parsePGNTree(pgn string) ([]pgnTreeEdge, error) {
+	var (
+		edges    []pgnTreeEdge
+		seen     = map[string]int{}
+		movetext strings.Builder
+		startFEN string
+		inMoves  bool
+		gameNum  int
+	)
+
+	flush := func() error {
+		if strings.TrimSpace(movetext.String()) == "" {
+			return nil
+		}
+		gameNum++
+		if err := walkPGNMovetext(movetext.String(), startFEN, func(e pgnTreeEdge) {
+			key := e.FenBefore + "|" + e.MoveUCI
+			if i, ok := seen[key]; ok {
+				if e.Ply < edges[i].Ply {
+					edges[i] = e
+				}
+				return
+			}
+			seen[key] = len(edges)
+			edges = append(edges, e)
+		}); err != nil {
+			return fmt.Errorf("game %d: %w", gameNum, err)
+		}
+		movetext.Reset()
+		startFEN = ""
+		return nil
+	}
+
+	for _, line := range strings.Split(pgn, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if inMoves {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				inMoves = false
+			}
+			if m := reTagPair.FindStringSubmatch(trimmed); m != nil && m[1] == "FEN" {
+				startFEN = m[2]
+			}
+			continue
+		}
+		if trimmed != "" {
+			inMoves = true
+		}
+		movetext.WriteString(line)
+		movetext.WriteString("\n")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
+
+// walkPGNMovetext replays movetext from startFEN (or the initial position),
+// calling visit for each move. A variation replaces the move just before it.
+func walkPGNMovetext(movetext, startFEN string, visit func(pgnTreeEdge)) error {
+	start := chess.StartingPosition()
+	if startFEN != "" {
+		opt, err := chess.FEN(startFEN)
+		if err != nil {
+			return err
+		}
+		start = chess.NewGame(opt).Position()
+	}
+
+	state := pgnTreeState{cur: start}
+	var stack []pgnTreeState
+
+	for _, tok := range rePGNToken.FindAllString(movetext, -1) {
+		switch {
+		case tok == "(":
+			if state.prev == nil {
+				return fmt.Errorf("variation before any move")
+			}
+			saved := state
+			saved.path = append([]string(nil), state.path...)
+			stack = append(stack, saved)
+			state = pgnTreeState{
+				cur:  state.prev,
+				path: append([]string(nil), state.path[:len(state.path)-1]...),
+			}
+		case tok == ")":
+			if len(stack) == 0 {
+				return fmt.Errorf("unbalanced ')'")
+			}
+			state = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(tok, "{"), strings.HasPrefix(tok, ";"), strings.HasPrefix(tok, "$"),
+			tok == "1-0", tok == "0-1", tok == "1/2-1/2", tok == "*",
+			strings.HasSuffix(tok, "."):
+			// comments, NAGs, results and move numbers carry no moves
+		default:
+			san := strings.TrimRight(tok, "!?")
+			if strings.HasPrefix(san, "0-0") {
+				// Castling written with zeros, which notnil/chess does not read.
+				san = strings.ReplaceAll(san, "0", "O")
+			}
+			m, err := chess.AlgebraicNotation{}.Decode(state.cur, san)
+			if err != nil {
+				return fmt.Errorf("move %q: %w", san, err)
+			}
+			fen := state.cur.String()
+			side := "w"
+			if state.cur.Turn() == chess.Black {
+				side = "b"
+			}
+			sanStr := chess.AlgebraicNotation{}.Encode(state.cur, m)
+			visit(pgnTreeEdge{
+				FenBefore:  NormalizeFEN(fen),
+				SideToMove: side,
+				MoveUCI:    chess.UCINotation{}.Encode(state.cur, m),
+				MoveSAN:    sanStr,
+				Ply:        len(state.path) + 1,
+				Line:       formatSANLine(start, state.path),
+			})
+			state.prev = state.cur
+			state.cur = state.cur.Update(m)
+			state.path = append(state.path, sanStr)
+		}
+	}
+	if len(stack) != 0 {
+		return fmt.Errorf("unbalanced '('")
+	}
+	return nil
+}
+
+// formatSANLine renders SAN moves played from start as numbered movetext.
+func formatSANLine(start *chess.Position, sans []string) string {
+	fields := strings.Fields(start.String())
+	moveNumber := 1
+	if len(fields) >= 6 {
+		fmt.Sscanf(fields[5], "%d", &moveNumber)
+	}
+	white := start.Turn() == chess.White
+
+	var sb strings.Builder
+	for i, san := range sans {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		if white {
+			fmt.Fprintf(&sb, "%d. ", moveNumber)
+		} else if i == 0 {
+			fmt.Fprintf(&sb, "%d... ", moveNumber)
+		}
+		sb.WriteString(san)
+		if !white {
+			moveNumber++
+		}
+		white = !white
+	}
+	return sb.String()
+}
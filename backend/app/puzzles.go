@@ -0,0 +1,321 @@
+// Package app generates training puzzles from blunders in the user's games.
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/notnil/chess"
+)
+
+// Puzzle themes.
+const (
+	PuzzleMate      = "mate"
+	PuzzlePromotion = "promotion"
+	PuzzleMaterial  = "material"
+)
+
+const (
+	puzzleDefaultLimit = 20
+	puzzleMaxLimit     = 200
+)
+
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   1,
+	chess.Knight: 3,
+	chess.Bishop: 3,
+	chess.Rook:   5,
+	chess.Queen:  9,
+}
+
+// PuzzleOptions tune how strict the generator is.
+type PuzzleOptions struct {
+	MinWinCP       int // the best move must be at least this good for the solver
+	MaterialGain   int // pawns the solver must be up, net, for a material puzzle to end
+	MaxSolverMoves int
+}
+
+// DefaultPuzzleOptions accepts tactics worth at least two pawns within five moves.
+func DefaultPuzzleOptions() PuzzleOptions {
+	return PuzzleOptions{
+		MinWinCP:       200,
+		MaterialGain:   2,
+		MaxSolverMoves: 5,
+	}
+}
+
+// puzzleCandidate is the position right after a blunder.
+type puzzleCandidate struct {
+	GameID int64
+	Ply    int
+	FEN    string
+	ByUser bool
+	URL    string
+}
+
+// errPuzzleRejected marks positions without a unique winning line.
+var errPuzzleRejected = errors.New("no unique winning line")
+
+// GetPuzzles returns the user's generated puzzles, newest first, optionally
+// filtered by ?theme= and ?source=user|opponent (whose blunder set them up).
+func (a *App) GetPuzzles(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	theme := strings.ToLower(c.Query("theme"))
+	if theme != "" && theme != PuzzleMate && theme != PuzzlePromotion && theme != PuzzleMaterial {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "theme must be one of mate, promotion, material"})
+		return
+	}
+	source := strings.ToLower(c.Query("source"))
+	if source != "" && source != "user" && source != "opponent" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be user or opponent"})
+		return
+	}
+	limit := puzzleDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 && n <= puzzleMaxLimit {
+			limit = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	puzzles, err := a.Stores.Puzzles.ListPuzzles(ctx, username, theme, source, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"username": username,
+		"puzzles":  puzzles,
+	})
+}
+
+// BuildPuzzle searches fen for a unique winning line for the side to move. The
+// solver's every move must be the only winning one (the engine's second line
+// must fall short of MinWinCP); the opponent's replies are the engine's best.
+// A mate line ends on mate, anything else once the solver is MaterialGain
+// pawns up even after the opponent's reply. errPuzzleRejected means no puzzle.
+func BuildPuzzle(ctx context.Context, eng *UCIEngine, fen string, settings models.EngineSettings, opts PuzzleOptions) (models.Puzzle, error) {
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		return models.Puzzle{}, err
+	}
+	pos := chess.NewGame(opt).Position()
+	solver := pos.Turn()
+	startMaterial := materialBalance(pos, solver)
+
+	p := models.Puzzle{
+		FEN:         fen,
+		SolverColor: "white",
+		Solution:    []string{},
+		SolutionSAN: []string{},
+	}
+	if solver == chess.Black {
+		p.SolverColor = "black"
+	}
+	promoted := false
+
+	for i := 0; i < opts.MaxSolverMoves; i++ {
+		lines, err := eng.EvalMultiPV(ctx, pos.String(), settings, 2)
+		if err != nil {
+			return p, err
+		}
+		if len(lines) == 0 {
+			return p, errPuzzleRejected
+		}
+		top := lines[0]
+		if i == 0 {
+			p.EvalCP = comparableCP(top.Score)
+			if p.EvalCP < opts.MinWinCP {
+				return p, errPuzzleRejected
+			}
+		}
+		if len(lines) > 1 && comparableCP(lines[1].Score) >= opts.MinWinCP {
+			return p, errPuzzleRejected
+		}
+
+		m := findMoveByUCI(pos, top.Score.Best)
+		if m == nil {
+			return p, errPuzzleRejected
+		}
+		p.Solution = append(p.Solution, top.Score.Best)
+		p.SolutionSAN = append(p.SolutionSAN, chess.AlgebraicNotation{}.Encode(pos, m))
+		if m.Promo() != chess.NoPieceType {
+			promoted = true
+		}
+		pos = pos.Update(m)
+		if pos.Status() == chess.Checkmate {
+			p.Theme = PuzzleMate
+			return p, nil
+		}
+
+		reply, err := eng.EvalFEN(ctx, pos.String(), settings)
+		if err != nil {
+			return p, err
+		}
+		rm := findMoveByUCI(pos, reply.Best)
+		if rm == nil {
+			return p, errPuzzleRejected
+		}
+		after := pos.Update(rm)
+
+		// A mating line must run to mate; otherwise stop once the gain survives
+		// the opponent's best reply, without making the solver play it out.
+		if top.Score.Mate == nil && materialBalance(after, solver)-startMaterial >= opts.MaterialGain {
+			p.Theme = PuzzleMaterial
+			if promoted {
+				p.Theme = PuzzlePromotion
+			}
+			return p, nil
+		}
+
+		p.Solution = append(p.Solution, reply.Best)
+		p.SolutionSAN = append(p.SolutionSAN, chess.AlgebraicNotation{}.Encode(pos, rm))
+		pos = after
+	}
+	return p, errPuzzleRejected
+}
+
+// materialBalance is color's material minus the opponent's, in pawns.
+func materialBalance(pos *chess.Position, color chess.Color) int {
+	balance := 0
+	for _, piece := range pos.Board().SquareMap() {
+		v := pieceValues[piece.Type()]
+		if piece.Color() == color {
+			balance += v
+		} else {
+			balance -= v
+		}
+	}
+	return balance
+}
+
+// GeneratePuzzles tries up to limit of the user's not yet examined blunders
+// and stores every attempt, so rejected positions aren't searched again.
+func GeneratePuzzles(ctx context.Context, store PuzzleStore, eng *UCIEngine, username string, settings models.EngineSettings, opts PuzzleOptions, limit int) (found, rejected int, err error) {
+	cands, err := store.FindPuzzleCandidates(ctx, username, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, cand := range cands {
+		p, err := BuildPuzzle(ctx, eng, cand.FEN, settings, opts)
+		isRejected := errors.Is(err, errPuzzleRejected)
+		if err != nil && !isRejected {
+			return found, rejected, err
+		}
+
+		p.Username = username
+		p.GameURL = cand.URL
+		p.SourcePly = cand.Ply
+		p.BlunderBy = "opponent"
+		if cand.ByUser {
+			p.BlunderBy = "user"
+		}
+		if err := store.SavePuzzle(ctx, cand.GameID, p, isRejected); err != nil {
+			return found, rejected, err
+		}
+		if isRejected {
+			rejected++
+		} else {
+			found++
+		}
+	}
+	return found, rejected, nil
+}
+
+// FindPuzzleCandidates returns positions after blunders in the user's games,
+// by either side, that haven't been tried yet, newest games first.
+func (s *sqlStore) FindPuzzleCandidates(ctx context.Context, username string, limit int) ([]puzzleCandidate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT m.game_id, m.ply, m.fen_after, m.played_by = g.username, g.url
+FROM moves m
+JOIN games g ON g.id = m.game_id
+WHERE g.username = $1
+  AND m.is_blunder
+  AND COALESCE(m.fen_after, '') <> ''
+  AND NOT EXISTS (
+      SELECT 1 FROM puzzles p
+      WHERE p.username = g.username
+        AND p.game_id = m.game_id
+        AND p.source_ply = m.ply
+  )
+ORDER BY g.when_unix DESC, m.ply
+LIMIT $2;
+`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []puzzleCandidate
+	for rows.Next() {
+		var c puzzleCandidate
+		if err := rows.Scan(&c.GameID, &c.Ply, &c.FEN, &c.ByUser, &c.URL); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SavePuzzle records a generation attempt for a blunder; rejected attempts are
+// kept only so the blunder isn't examined again.
+func (s *sqlStore) SavePuzzle(ctx context.Context, gameID int64, p models.Puzzle, rejected bool) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO puzzles (
+    username, game_id, source_ply, blunder_by, fen, solver_color,
+    solution, solution_san, theme, eval_cp, rejected, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (username, game_id, source_ply) DO NOTHING;
+`,
+		p.Username, gameID, p.SourcePly, p.BlunderBy, p.FEN, p.SolverColor,
+		pq.Array(p.Solution), pq.Array(p.SolutionSAN), p.Theme, p.EvalCP, rejected, time.Now().Unix(),
+	)
+	return err
+}
+
+// ListPuzzles returns the user's accepted puzzles, newest first.
+func (s *sqlStore) ListPuzzles(ctx context.Context, username, theme, blunderBy string, limit int) ([]models.Puzzle, error) {
+	out := []models.Puzzle{}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT p.id, p.username, g.url, p.source_ply, p.blunder_by, p.fen, p.solver_color,
+       p.solution, p.solution_san, p.theme, p.eval_cp, p.created_at
+FROM puzzles p
+JOIN games g ON g.id = p.game_id
+WHERE p.username = $1
+  AND NOT p.rejected
+  AND ($2 = '' OR p.theme = $2)
+  AND ($3 = '' OR p.blunder_by = $3)
+ORDER BY p.created_at DESC, p.id DESC
+LIMIT $4;
+`, username, theme, blunderBy, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Puzzle
+		if err := rows.Scan(
+			&p.ID, &p.Username, &p.GameURL, &p.SourcePly, &p.BlunderBy, &p.FEN, &p.SolverColor,
+			pq.Array(&p.Solution), pq.Array(&p.SolutionSAN), &p.Theme, &p.EvalCP, &p.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
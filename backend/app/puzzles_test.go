@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"example/my-go-api/app/models"
+
+	"github.com/notnil/chess"
+)
+
+var puzzleSettings = models.EngineSettings{UseDepth: true, Depth: 12}
+
+func TestBuildPuzzleMateInOne(t *testing.T) {
+	eng, _ := newTestEngine([]string{
+		"readyok",
+		"info depth 12 multipv 1 score mate 1 pv a1a8",
+		"info depth 12 multipv 2 score cp 40 pv g1f1",
+		"bestmove a1a8",
+		"readyok",
+	})
+	p, err := BuildPuzzle(context.Background(), eng, "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", puzzleSettings, DefaultPuzzleOptions())
+	if err != nil {
+		t.Fatalf("BuildPuzzle: %v", err)
+	}
+	if p.Theme != PuzzleMate || strings.Join(p.Solution, " ") != "a1a8" || p.SolutionSAN[0] != "Ra8#" || p.SolverColor != "white" {
+		t.Fatalf("puzzle = %+v", p)
+	}
+}
+
+func TestBuildPuzzleKnightFork(t *testing.T) {
+	eng, _ := newTestEngine([]string{
+		// solver move 1: Nc7+ is the only winning move
+		"readyok",
+		"info depth 12 multipv 1 score cp 800 pv b5c7 e8d7 c7a8",
+		"info depth 12 multipv 2 score cp -600 pv b5d6",
+		"bestmove b5c7",
+		"readyok",
+		// opponent reply
+		"info depth 12 score cp -800 pv e8d7",
+		"bestmove e8d7",
+		// solver move 2: Nxa8
+		"readyok",
+		"info depth 12 multipv 1 score cp 850 pv c7a8",
+		"info depth 12 multipv 2 score cp -600 pv e1e2",
+		"bestmove c7a8",
+		"readyok",
+		// opponent reply; the queen stays won
+		"bestmove d7c8",
+	})
+	p, err := BuildPuzzle(context.Background(), eng, "q3k3/8/8/1N6/8/8/8/4K3 w - - 0 1", puzzleSettings, DefaultPuzzleOptions())
+	if err != nil {
+		t.Fatalf("BuildPuzzle: %v", err)
+	}
+	if p.Theme != PuzzleMaterial || strings.Join(p.SolutionSAN, " ") != "Nc7+ Kd7 Nxa8" || p.EvalCP != 800 {
+		t.Fatalf("puzzle = %+v", p)
+	}
+}
+
+func TestBuildPuzzleRejectsAmbiguousAndQuiet(t *testing.T) {
+	cases := map[string][]string{
+		"two winning moves": {
+			"readyok",
+			"info depth 12 multipv 1 score cp 500 pv b5c7",
+			"info depth 12 multipv 2 score cp 450 pv b5d6",
+			"bestmove b5c7",
+			"readyok",
+		},
+		"not winning": {
+			"readyok",
+			"info depth 12 multipv 1 score cp 90 pv b5c7",
+			"info depth 12 multipv 2 score cp 10 pv b5d6",
+			"bestmove b5c7",
+			"readyok",
+		},
+	}
+	for name, lines := range cases {
+		t.Run(name, func(t *testing.T) {
+			eng, _ := newTestEngine(lines)
+			_, err := BuildPuzzle(context.Background(), eng, "q3k3/8/8/1N6/8/8/8/4K3 w - - 0 1", puzzleSettings, DefaultPuzzleOptions())
+			if !errors.Is(err, errPuzzleRejected) {
+				t.Fatalf("BuildPuzzle err = %v, want rejection", err)
+			}
+		})
+	}
+}
+
+func TestMaterialBalance(t *testing.T) {
+	opt, err := chess.FEN("q3k3/8/8/1N6/8/8/8/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("FEN: %v", err)
+	}
+	if got := materialBalance(chess.NewGame(opt).Position(), chess.White); got != -6 {
+		t.Fatalf("materialBalance = %d, want -6", got)
+	}
+}
@@ -0,0 +1,105 @@
+// Package app reports whether the API or a worker can serve, dependency by dependency.
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-check timeouts. The engine gets longer: a cold start loads its network.
+const (
+	readyCheckTimeout  = 3 * time.Second
+	engineCheckTimeout = 10 * time.Second
+)
+
+// DependencyStatus is one dependency's result in the /ready response.
+type DependencyStatus struct {
+	Status     string `json:"status"` // "ok" or "error"
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Readiness is the /ready response body.
+type Readiness struct {
+	Status string                      `json:"status"` // "ready" or "unavailable"
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// CheckReadiness runs every configured check in parallel: the database and
+// its migrations, the queue, and with engine set, the engine handshake.
+// Dependencies the App does not have are left out.
+func (a *App) CheckReadiness(ctx context.Context, engine bool) Readiness {
+	checks := map[string]func(context.Context) error{}
+	if h := a.Stores.Health; h != nil {
+		checks["database"] = h.Ping
+		checks["migrations"] = h.CheckSchema
+	}
+	if a.Queue != nil {
+		checks["queue"] = a.Queue.Ping
+	}
+	if engine {
+		checks["engine"] = func(ctx context.Context) error {
+			return CheckEngine(ctx, a.Config.Engine.Path)
+		}
+	}
+
+	r := Readiness{Status: "ready", Checks: map[string]DependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timeout := readyCheckTimeout
+			if name == "engine" {
+				timeout = engineCheckTimeout
+			}
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			st := DependencyStatus{Status: "ok"}
+			if err := check(cctx); err != nil {
+				st = DependencyStatus{Status: "error", Error: err.Error()}
+			}
+			st.DurationMS = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			r.Checks[name] = st
+			if st.Status != "ok" {
+				r.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+	return r
+}
+
+// Ready is the API's readiness endpoint: 200 when the database, migrations and
+// queue all check out, 503 with the failing ones otherwise.
+func (a *App) Ready(c *gin.Context) {
+	writeReadiness(c.Writer, a.CheckReadiness(c.Request.Context(), false))
+}
+
+// WorkerReadyHandler serves the worker's readiness, which adds the engine check.
+func (a *App) WorkerReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReadiness(w, a.CheckReadiness(r.Context(), true))
+	})
+}
+
+func writeReadiness(w http.ResponseWriter, r Readiness) {
+	status := http.StatusOK
+	if r.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(r)
+}
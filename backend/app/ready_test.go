@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadyReportsEachDependency(t *testing.T) {
+	a, _, _ := newTestApp(t)
+
+	w := serve(t, a, http.MethodGet, "/ready")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var body Readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Status != "ready" || len(body.Checks) != 3 {
+		t.Fatalf("unexpected readiness %+v", body)
+	}
+	for _, name := range []string{"database", "migrations", "queue"} {
+		if body.Checks[name].Status != "ok" {
+			t.Fatalf("%s = %+v", name, body.Checks[name])
+		}
+	}
+}
+
+func TestReadyFailsWhenQueueUnreachable(t *testing.T) {
+	a, queue, _ := newTestApp(t)
+	queue.pingErr = errors.New("AWS.SimpleQueueService.NonExistentQueue")
+
+	w := serve(t, a, http.MethodGet, "/ready")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	var body Readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if q := body.Checks["queue"]; body.Status != "unavailable" || q.Status != "error" || q.Error == "" {
+		t.Fatalf("unexpected readiness %+v", body)
+	}
+	if body.Checks["database"].Status != "ok" {
+		t.Fatalf("database should still pass: %+v", body.Checks["database"])
+	}
+}
+
+// writeEngine writes a shell script standing in for the engine binary.
+func writeEngine(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "engine")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write engine: %v", err)
+	}
+	return path
+}
+
+func TestWorkerReadyChecksEngine(t *testing.T) {
+	a, _, _ := newTestApp(t)
+	a.Config.Engine.Path = writeEngine(t, `while read cmd; do
+  case "$cmd" in
+    uci) echo "id name fake"; echo uciok ;;
+    isready) echo readyok ;;
+    quit) exit 0 ;;
+  esac
+done
+`)
+
+	w := httptest.NewRecorder()
+	a.WorkerReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var body Readiness
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if w.Code != http.StatusOK || body.Checks["engine"].Status != "ok" {
+		t.Fatalf("status = %d, readiness %+v", w.Code, body)
+	}
+}
+
+func TestCheckEngineFailures(t *testing.T) {
+	cases := map[string]string{
+		"exits":    "exit 1\n",
+		"no uciok": "read cmd; echo 'id name fake'\n",
+		"hangs":    "sleep 5\n",
+	}
+	for name, script := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			if err := CheckEngine(ctx, writeEngine(t, script)); err == nil {
+				t.Fatal("want an error")
+			}
+		})
+	}
+	if err := CheckEngine(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("want an error for a missing binary")
+	}
+}
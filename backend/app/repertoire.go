@@ -0,0 +1,422 @@
+// Package app stores uploaded opening repertoires and checks games against them.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxRepertoireBytes         = 1 << 20
+	repertoireDefaultGameLimit = 200
+	repertoireMaxGameLimit     = 2000
+	repertoireExampleURLs      = 3
+)
+
+// Ways a game can relate to the repertoire.
+const (
+	RepertoireDeviation = "deviation"
+	RepertoireEnded     = "end_of_repertoire"
+	RepertoireInBook    = "in_book"
+)
+
+// repertoireBook maps normalized FEN to the repertoire moves from that position.
+type repertoireBook map[string][]models.RepertoireMove
+
+func newRepertoireBook(moves []models.RepertoireMove) repertoireBook {
+	book := repertoireBook{}
+	for _, m := range moves {
+		book[m.NormalizedFen] = append(book[m.NormalizedFen], m)
+	}
+	return book
+}
+
+func (b repertoireBook) maxPly() int {
+	max := 0
+	for _, moves := range b {
+		for _, m := range moves {
+			if m.Ply > max {
+				max = m.Ply
+			}
+		}
+	}
+	return max
+}
+
+// repertoireGame is one imported game with its analysed moves in ply order.
+type repertoireGame struct {
+	URL      string
+	When     int64
+	Opponent string
+	Moves    []models.Move
+}
+
+// parseRepertoireColor reads the required ?color= parameter.
+func parseRepertoireColor(c *gin.Context) (string, error) {
+	color := strings.ToLower(c.Query("color"))
+	if color != "white" && color != "black" {
+		return "", errors.New("color must be white or black")
+	}
+	return color, nil
+}
+
+// UploadRepertoire replaces the user's repertoire for ?color= with the PGN in
+// the request body. Every move on every variation becomes a repertoire move.
+func (a *App) UploadRepertoire(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	color, err := parseRepertoireColor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRepertoireBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	if len(body) > maxRepertoireBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "repertoire PGN too large"})
+		return
+	}
+
+	moves, err := ParseRepertoire(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid PGN: " + err.Error()})
+		return
+	}
+	if len(moves) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PGN contains no moves"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := a.Stores.Repertoire.SaveRepertoire(ctx, username, color, moves); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"username":  username,
+		"color":     color,
+		"moves":     len(moves),
+		"positions": len(newRepertoireBook(moves)),
+	})
+}
+
+// GetRepertoireDeviations checks the user's recent games with ?color= against
+// their repertoire and reports where each one left it.
+func (a *App) GetRepertoireDeviations(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	color, err := parseRepertoireColor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := repertoireDefaultGameLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 && n <= repertoireMaxGameLimit {
+			limit = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	moves, err := a.Stores.Repertoire.LoadRepertoire(ctx, username, color)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(moves) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no repertoire uploaded for " + color})
+		return
+	}
+	book := newRepertoireBook(moves)
+
+	games, err := a.Stores.Repertoire.LoadRepertoireGames(ctx, username, color, book.maxPly()+1, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildRepertoireReport(username, color, book, games))
+}
+
+// ParseRepertoire turns a PGN (variations included) into repertoire moves.
+func ParseRepertoire(pgn string) ([]models.RepertoireMove, error) {
+	edges, err := parsePGNTree(pgn)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.RepertoireMove, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, models.RepertoireMove{
+			NormalizedFen: e.FenBefore,
+			SideToMove:    e.SideToMove,
+			MoveUCI:       e.MoveUCI,
+			MoveSAN:       e.MoveSAN,
+			Line:          e.Line,
+			Ply:           e.Ply,
+		})
+	}
+	return out, nil
+}
+
+// findDeviation walks a game's moves until one isn't in the book. A position the
+// book has no moves for means the repertoire ran out before the game left it.
+func findDeviation(book repertoireBook, color string, g repertoireGame) models.GameDeviation {
+	dev := models.GameDeviation{
+		URL:      g.URL,
+		When:     g.When,
+		Opponent: g.Opponent,
+		Outcome:  RepertoireInBook,
+		Expected: []string{},
+	}
+	for _, m := range g.Moves {
+		fen := m.FenBefore.FEN
+		expected := book[fen]
+		if len(expected) == 0 {
+			dev.Outcome = RepertoireEnded
+			dev.Ply = m.Ply
+			dev.FEN = fen
+			return dev
+		}
+
+		inBook := false
+		for _, e := range expected {
+			if e.MoveUCI == m.MoveUCI {
+				inBook = true
+				break
+			}
+		}
+		if inBook {
+			continue
+		}
+
+		dev.Outcome = RepertoireDeviation
+		dev.DeviatedBy = "opponent"
+		if m.Color == color[:1] {
+			dev.DeviatedBy = "player"
+		}
+		dev.Ply = m.Ply
+		dev.FEN = fen
+		dev.Line = expected[0].Line
+		dev.PlayedUCI = m.MoveUCI
+		dev.PlayedSAN = m.MoveSAN
+		dev.CPLoss = m.Analysis.CPChange
+		for _, e := range expected {
+			dev.Expected = append(dev.Expected, e.MoveSAN)
+		}
+		return dev
+	}
+	return dev
+}
+
+// buildRepertoireReport classifies every game and groups the player's own
+// deviations by position into the most frequently forgotten lines.
+func buildRepertoireReport(username, color string, book repertoireBook, games []repertoireGame) models.RepertoireReport {
+	report := models.RepertoireReport{
+		Username:       username,
+		Color:          color,
+		ForgottenLines: []models.ForgottenLine{},
+		Deviations:     []models.GameDeviation{},
+	}
+
+	byFEN := map[string]*models.ForgottenLine{}
+	var order []string
+	totalLoss := 0
+	for _, g := range games {
+		dev := findDeviation(book, color, g)
+		report.GamesChecked++
+		switch dev.Outcome {
+		case RepertoireInBook:
+			report.InBook++
+		case RepertoireEnded:
+			report.EndOfRepertoire++
+		case RepertoireDeviation:
+			report.Deviations = append(report.Deviations, dev)
+			if dev.DeviatedBy == "opponent" {
+				report.OpponentDeviations++
+				continue
+			}
+			report.PlayerDeviations++
+			totalLoss += dev.CPLoss
+
+			fl, ok := byFEN[dev.FEN]
+			if !ok {
+				fl = &models.ForgottenLine{
+					FEN:         dev.FEN,
+					Line:        dev.Line,
+					Expected:    dev.Expected,
+					Played:      map[string]int{},
+					ExampleURLs: []string{},
+				}
+				byFEN[dev.FEN] = fl
+				order = append(order, dev.FEN)
+			}
+			fl.Times++
+			fl.Played[dev.PlayedSAN]++
+			fl.AvgCPLoss += float64(dev.CPLoss)
+			if len(fl.ExampleURLs) < repertoireExampleURLs && dev.URL != "" {
+				fl.ExampleURLs = append(fl.ExampleURLs, dev.URL)
+			}
+		}
+	}
+
+	if report.PlayerDeviations > 0 {
+		report.AvgPlayerCPLoss = float64(totalLoss) / float64(report.PlayerDeviations)
+	}
+	for _, fen := range order {
+		fl := byFEN[fen]
+		fl.AvgCPLoss /= float64(fl.Times)
+		report.ForgottenLines = append(report.ForgottenLines, *fl)
+	}
+	sort.SliceStable(report.ForgottenLines, func(i, j int) bool {
+		a, b := report.ForgottenLines[i], report.ForgottenLines[j]
+		if a.Times != b.Times {
+			return a.Times > b.Times
+		}
+		return a.AvgCPLoss > b.AvgCPLoss
+	})
+	return report
+}
+
+// SaveRepertoire replaces the user's repertoire for one colour.
+func (s *sqlStore) SaveRepertoire(ctx context.Context, username, color string, moves []models.RepertoireMove) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteRepertoire(ctx, tx, username, color); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO repertoire_moves (
+    username, color, normalized_fen, side_to_move, move_uci, move_san, line, ply
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range moves {
+		if _, err := stmt.ExecContext(ctx,
+			username, color, m.NormalizedFen, m.SideToMove,
+			m.MoveUCI, m.MoveSAN, m.Line, m.Ply,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func deleteRepertoire(ctx context.Context, tx *sql.Tx, username, color string) error {
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM repertoire_moves WHERE username = $1 AND color = $2`,
+		username, color,
+	)
+	return err
+}
+
+// LoadRepertoire returns the user's repertoire moves for one colour.
+func (s *sqlStore) LoadRepertoire(ctx context.Context, username, color string) ([]models.RepertoireMove, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT normalized_fen, side_to_move, move_uci, move_san, line, ply
+FROM repertoire_moves
+WHERE username = $1 AND color = $2
+ORDER BY ply, normalized_fen, move_uci;
+`, username, color)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.RepertoireMove
+	for rows.Next() {
+		var m models.RepertoireMove
+		if err := rows.Scan(&m.NormalizedFen, &m.SideToMove, &m.MoveUCI, &m.MoveSAN, &m.Line, &m.Ply); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// LoadRepertoireGames loads the user's most recent standard-start games with
+// color and their analysed moves up to maxPly, in ply order. Each move's
+// FenBefore holds the normalized FEN, which is how the book is keyed.
+func (s *sqlStore) LoadRepertoireGames(ctx context.Context, username, color string, maxPly, limit int) ([]repertoireGame, error) {
+	rows, err := s.db.QueryContext(ctx, `
+WITH recent AS (
+    SELECT g.id, g.url, g.when_unix, g.opponent
+    FROM games g
+    WHERE g.username = $1
+      AND g.color = $2
+      AND g.start_fen IS NULL
+    ORDER BY g.when_unix DESC
+    LIMIT $4
+)
+SELECT r.id, r.url, r.when_unix, r.opponent,
+       m.ply, m.color, m.normalized_fen_before, m.move_uci, COALESCE(m.move_san, ''),
+       COALESCE(m.centipawn_change, 0)
+FROM recent r
+JOIN moves m ON m.game_id = r.id
+WHERE m.ply <= $3
+ORDER BY r.when_unix DESC, r.id, m.ply;
+`, username, color, maxPly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		out    []repertoireGame
+		lastID = -1
+	)
+	for rows.Next() {
+		var (
+			id int
+			g  repertoireGame
+			m  models.Move
+		)
+		if err := rows.Scan(
+			&id, &g.URL, &g.When, &g.Opponent,
+			&m.Ply, &m.Color, &m.FenBefore.FEN, &m.MoveUCI, &m.MoveSAN,
+			&m.Analysis.CPChange,
+		); err != nil {
+			return nil, err
+		}
+		if id != lastID {
+			out = append(out, g)
+			lastID = id
+		}
+		out[len(out)-1].Moves = append(out[len(out)-1].Moves, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,393 @@
+// Package app derives a player's de facto repertoire from their analysed games.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/notnil/chess"
+)
+
+const (
+	extractDefaultMinGames = 3
+	extractDefaultMinShare = 0.2
+	pgnLineWidth           = 80
+)
+
+// repertoireEdge is one aggregated (position, move) pair from the moves table.
+type repertoireEdge struct {
+	FEN          string
+	MoveUCI      string
+	MoveSAN      string
+	BestMoveUCI  string
+	Count        int
+	ErrorCount   int
+	AvgEvalCP    *float64
+	PlayedByUser bool
+}
+
+// GetExtractedRepertoire builds the tree of moves the user (and their opponents)
+// actually play with ?color=, keeping moves seen at least min_games times and in
+// at least min_share of the games reaching the position. ?format=pgn exports it
+// as a PGN with variations. The error report's game filters apply, including
+// move_min/move_max for the depth of the tree.
+func (a *App) GetExtractedRepertoire(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	color, err := parseRepertoireColor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := parseErrorPositionQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The tree is rooted at the initial position, so it starts at move one.
+	filters.MoveMin = 0
+	filters.IncludeCustomStart = false
+	if c.Query("min_severity") == "" {
+		filters.MinSeverity = SeverityInaccuracy
+	}
+
+	minGames := extractDefaultMinGames
+	if v := c.Query("min_games"); v != "" {
+		n, err := parsePositiveInt(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_games must be a positive integer"})
+			return
+		}
+		minGames = n
+	}
+	minShare := extractDefaultMinShare
+	if v := c.Query("min_share"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_share must be between 0 and 1"})
+			return
+		}
+		minShare = f
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "pgn" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or pgn"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	edges, err := a.Stores.Reports.FindRepertoireEdges(ctx, username, color, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rep := models.ExtractedRepertoire{
+		Username: username,
+		Color:    color,
+		MinGames: minGames,
+		MinShare: minShare,
+		Moves:    buildRepertoireTree(edges, minGames, minShare),
+	}
+	rep.Flagged = countFlagged(rep.Moves)
+
+	if format == "pgn" {
+		filename := fmt.Sprintf("%s-%s-repertoire.pgn", username, color)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, "application/x-chess-pgn", []byte(ExtractedRepertoirePGN(rep)))
+		return
+	}
+	c.JSON(http.StatusOK, rep)
+}
+
+// FindRepertoireEdges aggregates every move played in the user's games with
+// color, by position and move, counting errors at filters' severity.
+func (s *sqlStore) FindRepertoireEdges(ctx context.Context, username, color string, filters ErrorPositionQuery) ([]repertoireEdge, error) {
+	filters.Color = color
+
+	args := []any{username}
+	filterClauses, args := filters.filterSQL(args)
+
+	q := `
+WITH edge_moves AS (
+    SELECT
+        m.normalized_fen_before,
+        m.move_uci,
+        m.move_san,
+        m.eval_after_cp,
+        m.best_move_uci,
+        CASE WHEN ` + filters.errorSQL() + ` THEN 1 ELSE 0 END AS is_error,
+        CASE WHEN m.played_by = g.username THEN 1 ELSE 0 END AS by_user
+    FROM moves m
+    JOIN games g ON g.id = m.game_id
+    WHERE g.username = $1` + filterClauses + `
+),
+best AS (` + commonBestMoveSQL("edge_moves", "normalized_fen_before", "move_uci") + `
+)
+SELECT
+    e.normalized_fen_before,
+    e.move_uci,
+    MAX(e.move_san),
+    COUNT(*),
+    SUM(e.is_error),
+    -- eval_after_cp is from the side to move after the move, so flip it for the mover
+    CAST(AVG(-e.eval_after_cp) AS DOUBLE PRECISION),
+    MAX(e.by_user) = 1,
+    COALESCE(MAX(b.best_move_uci), '')
+FROM edge_moves e
+LEFT JOIN best b
+    ON b.normalized_fen_before = e.normalized_fen_before
+   AND b.move_uci = e.move_uci
+   AND b.rn = 1
+GROUP BY e.normalized_fen_before, e.move_uci;
+`
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []repertoireEdge
+	for rows.Next() {
+		var (
+			e       repertoireEdge
+			san     sql.NullString
+			avgEval sql.NullFloat64
+		)
+		if err := rows.Scan(
+			&e.FEN,
+			&e.MoveUCI,
+			&san,
+			&e.Count,
+			&e.ErrorCount,
+			&avgEval,
+			&e.PlayedByUser,
+			&e.BestMoveUCI,
+		); err != nil {
+			return nil, err
+		}
+		e.MoveSAN = san.String
+		if avgEval.Valid {
+			v := avgEval.Float64
+			e.AvgEvalCP = &v
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// buildRepertoireTree walks from the initial position following every move that
+// passes the thresholds, most frequent first. A move is flagged when most of
+// the player's games with it were engine-flagged errors.
+func buildRepertoireTree(edges []repertoireEdge, minGames int, minShare float64) []models.RepertoireNode {
+	byFEN := map[string][]repertoireEdge{}
+	for _, e := range edges {
+		byFEN[e.FEN] = append(byFEN[e.FEN], e)
+	}
+	for fen := range byFEN {
+		list := byFEN[fen]
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].MoveUCI < list[j].MoveUCI
+		})
+	}
+
+	var expand func(pos *chess.Position, ply int, onPath map[string]bool) []models.RepertoireNode
+	expand = func(pos *chess.Position, ply int, onPath map[string]bool) []models.RepertoireNode {
+		fen := NormalizeFEN(pos.String())
+		if onPath[fen] {
+			return []models.RepertoireNode{}
+		}
+		onPath[fen] = true
+		defer delete(onPath, fen)
+
+		total := 0
+		for _, e := range byFEN[fen] {
+			total += e.Count
+		}
+
+		nodes := []models.RepertoireNode{}
+		for _, e := range byFEN[fen] {
+			share := float64(e.Count) / float64(total)
+			if e.Count < minGames || share < minShare {
+				continue
+			}
+			m := findMoveByUCI(pos, e.MoveUCI)
+			if m == nil {
+				continue
+			}
+			node := models.RepertoireNode{
+				MoveUCI:      e.MoveUCI,
+				MoveSAN:      chess.AlgebraicNotation{}.Encode(pos, m),
+				Ply:          ply,
+				PlayedByUser: e.PlayedByUser,
+				Count:        e.Count,
+				Share:        share,
+				ErrorCount:   e.ErrorCount,
+				AvgEvalCP:    e.AvgEvalCP,
+			}
+			if e.PlayedByUser && e.ErrorCount*2 > e.Count {
+				node.IsError = true
+				if best := findMoveByUCI(pos, e.BestMoveUCI); best != nil {
+					node.BestMoveUCI = e.BestMoveUCI
+					node.BestMoveSAN = chess.AlgebraicNotation{}.Encode(pos, best)
+				}
+			}
+			node.Children = expand(pos.Update(m), ply+1, onPath)
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	return expand(chess.StartingPosition(), 1, map[string]bool{})
+}
+
+// findMoveByUCI returns the legal move matching uci, or nil.
+func findMoveByUCI(pos *chess.Position, uci string) *chess.Move {
+	if uci == "" {
+		return nil
+	}
+	for _, m := range pos.ValidMoves() {
+		if (chess.UCINotation{}).Encode(pos, m) == uci {
+			return m
+		}
+	}
+	return nil
+}
+
+func countFlagged(nodes []models.RepertoireNode) int {
+	n := 0
+	for _, node := range nodes {
+		if node.IsError {
+			n++
+		}
+		n += countFlagged(node.Children)
+	}
+	return n
+}
+
+// ExtractedRepertoirePGN renders the tree as a single PGN game: the most
+// frequent move is the main line, the others are variations, and each move
+// carries a comment with its frequency and average eval (White's point of view).
+// Flagged moves get the $2 (mistake) annotation.
+func ExtractedRepertoirePGN(rep models.ExtractedRepertoire) string {
+	white, black := "?", "?"
+	side := "White"
+	if rep.Color == "white" {
+		white = rep.Username
+	} else {
+		black = rep.Username
+		side = "Black"
+	}
+
+	var sb strings.Builder
+	for _, tag := range [][2]string{
+		{"Event", fmt.Sprintf("%s repertoire as %s", rep.Username, side)},
+		{"Site", "?"},
+		{"Date", "????.??.??"},
+		{"Round", "?"},
+		{"White", white},
+		{"Black", black},
+		{"Result", "*"},
+	} {
+		fmt.Fprintf(&sb, "[%s %q]\n", tag[0], tag[1])
+	}
+	sb.WriteString("\n")
+
+	var tokens []string
+	if len(rep.Moves) > 0 {
+		tokens = appendPGNLine(tokens, rep.Moves)
+	}
+	tokens = append(tokens, "*")
+	sb.WriteString(wrapPGNTokens(tokens, pgnLineWidth))
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// appendPGNLine writes nodes[0] as the continuation and the rest as variations.
+func appendPGNLine(tokens []string, nodes []models.RepertoireNode) []string {
+	main := nodes[0]
+	tokens = appendPGNMove(tokens, main)
+	for _, alt := range nodes[1:] {
+		tokens = append(tokens, "(")
+		tokens = appendPGNMove(tokens, alt)
+		if len(alt.Children) > 0 {
+			tokens = appendPGNLine(tokens, alt.Children)
+		}
+		tokens = append(tokens, ")")
+	}
+	if len(main.Children) > 0 {
+		tokens = appendPGNLine(tokens, main.Children)
+	}
+	return tokens
+}
+
+// appendPGNMove writes a numbered move and its comment. Every move has a
+// comment, so Black's moves always repeat the move number.
+func appendPGNMove(tokens []string, n models.RepertoireNode) []string {
+	number := (n.Ply + 1) / 2
+	if n.Ply%2 == 1 {
+		tokens = append(tokens, fmt.Sprintf("%d.", number))
+	} else {
+		tokens = append(tokens, fmt.Sprintf("%d...", number))
+	}
+	tokens = append(tokens, n.MoveSAN)
+	if n.IsError {
+		tokens = append(tokens, "$2")
+	}
+	return append(tokens, repertoireNodeComment(n))
+}
+
+func repertoireNodeComment(n models.RepertoireNode) string {
+	parts := []string{fmt.Sprintf("%d games, %.0f%%", n.Count, n.Share*100)}
+	if n.AvgEvalCP != nil {
+		eval := *n.AvgEvalCP
+		if n.Ply%2 == 0 {
+			eval = -eval
+		}
+		parts = append(parts, fmt.Sprintf("eval %+.2f", eval/100))
+	}
+	if n.IsError {
+		msg := fmt.Sprintf("usual move is an error (%d/%d)", n.ErrorCount, n.Count)
+		if n.BestMoveSAN != "" {
+			msg += ", engine prefers " + n.BestMoveSAN
+		}
+		parts = append(parts, msg)
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
+
+// wrapPGNTokens joins tokens with spaces, breaking lines at width.
+func wrapPGNTokens(tokens []string, width int) string {
+	var sb strings.Builder
+	lineLen := 0
+	for _, tok := range tokens {
+		if lineLen > 0 && lineLen+1+len(tok) > width {
+			sb.WriteString("\n")
+			lineLen = 0
+		} else if lineLen > 0 {
+			sb.WriteString(" ")
+			lineLen++
+		}
+		sb.WriteString(tok)
+		lineLen += len(tok)
+	}
+	return sb.String()
+}
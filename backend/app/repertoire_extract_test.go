@@ -0,0 +1,114 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"example/my-go-api/app/models"
+
+	"github.com/notnil/chess"
+)
+
+// edgeAfter builds an aggregated edge for uci played after the SAN moves in line.
+func edgeAfter(t *testing.T, line string, uci string, count, errors int, byUser bool) repertoireEdge {
+	t.Helper()
+	pos := chess.StartingPosition()
+	for _, san := range strings.Fields(line) {
+		m, err := chess.AlgebraicNotation{}.Decode(pos, san)
+		if err != nil {
+			t.Fatalf("decode %s: %v", san, err)
+		}
+		pos = pos.Update(m)
+	}
+	eval := 25.0
+	return repertoireEdge{
+		FEN:          NormalizeFEN(pos.String()),
+		MoveUCI:      uci,
+		Count:        count,
+		ErrorCount:   errors,
+		AvgEvalCP:    &eval,
+		PlayedByUser: byUser,
+		BestMoveUCI:  "d2d4",
+	}
+}
+
+func TestBuildRepertoireTree(t *testing.T) {
+	edges := []repertoireEdge{
+		edgeAfter(t, "", "e2e4", 10, 0, true),
+		edgeAfter(t, "", "d2d4", 1, 0, true), // below min games
+		edgeAfter(t, "e4", "c7c5", 6, 0, false),
+		edgeAfter(t, "e4", "e7e5", 3, 0, false),
+		edgeAfter(t, "e4", "a7a6", 1, 0, false),
+		edgeAfter(t, "e4 c5", "g1f3", 4, 0, true),
+		edgeAfter(t, "e4 c5", "b1c3", 2, 0, true), // below min games
+		edgeAfter(t, "e4 e5", "f1c4", 3, 2, true), // usually an error
+	}
+	tree := buildRepertoireTree(edges, 3, 0.2)
+
+	if len(tree) != 1 || tree[0].MoveSAN != "e4" || tree[0].Ply != 1 {
+		t.Fatalf("root = %+v", tree)
+	}
+	replies := tree[0].Children
+	if len(replies) != 2 || replies[0].MoveSAN != "c5" || replies[1].MoveSAN != "e5" {
+		t.Fatalf("replies = %+v", replies)
+	}
+	if replies[0].Share != 0.6 {
+		t.Fatalf("c5 share = %v, want 0.6", replies[0].Share)
+	}
+	bc4 := replies[1].Children
+	if len(bc4) != 1 || !bc4[0].IsError || bc4[0].BestMoveSAN != "d4" {
+		t.Fatalf("Bc4 = %+v", bc4)
+	}
+	if replies[0].Children[0].IsError {
+		t.Fatalf("Nf3 should not be flagged")
+	}
+	if countFlagged(tree) != 1 {
+		t.Fatalf("countFlagged = %d, want 1", countFlagged(tree))
+	}
+}
+
+func TestExtractedRepertoirePGNRoundTrip(t *testing.T) {
+	edges := []repertoireEdge{
+		edgeAfter(t, "", "e2e4", 10, 0, true),
+		edgeAfter(t, "e4", "c7c5", 6, 0, false),
+		edgeAfter(t, "e4", "e7e5", 4, 0, false),
+		edgeAfter(t, "e4 c5", "g1f3", 6, 0, true),
+		edgeAfter(t, "e4 e5", "f1c4", 4, 3, true),
+	}
+	rep := models.ExtractedRepertoire{
+		Username: "alice",
+		Color:    "white",
+		Moves:    buildRepertoireTree(edges, 3, 0.2),
+	}
+	pgn := ExtractedRepertoirePGN(rep)
+
+	for _, want := range []string{
+		`[White "alice"]`,
+		`[Result "*"]`,
+		"1. e4 {10 games, 100%; eval +0.25}",
+		"1... c5 {6 games, 60%; eval -0.25}",
+		"( 1... e5",
+		"2. Bc4 $2 {4 games, 100%; eval +0.25; usual move is an error (3/4), engine prefers d4}",
+	} {
+		if !strings.Contains(strings.ReplaceAll(pgn, "\n", " "), want) {
+			t.Fatalf("PGN missing %q:\n%s", want, pgn)
+		}
+	}
+
+	// The export must read back as the same tree.
+	moves, err := ParseRepertoire(pgn)
+	if err != nil {
+		t.Fatalf("ParseRepertoire(export): %v\n%s", err, pgn)
+	}
+	if len(moves) != 5 {
+		t.Fatalf("round trip has %d moves, want 5", len(moves))
+	}
+}
+
+func TestWrapPGNTokens(t *testing.T) {
+	got := wrapPGNTokens([]string{"1.", "e4", "{a long comment}", "1...", "e5"}, 12)
+	want := "1. e4\n{a long comment}\n1... e5"
+	if got != want {
+		t.Fatalf("wrapPGNTokens = %q, want %q", got, want)
+	}
+}
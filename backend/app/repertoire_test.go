@@ -0,0 +1,193 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"example/my-go-api/app/models"
+
+	"github.com/notnil/chess"
+)
+
+const testRepertoirePGN = `[Event "White repertoire"]
+
+1. e4 c5 (1... e5 2. Nf3 Nc6 3. Bb5) (1... c6 2. d4 d5 3. e5) 2. Nf3 {Open Sicilian} d6 3. d4! *
+`
+
+// movesFromSAN replays SAN moves from the initial position as analysed moves.
+func movesFromSAN(t *testing.T, cpLoss map[int]int, sans ...string) []models.Move {
+	t.Helper()
+	pos := chess.StartingPosition()
+	var out []models.Move
+	for i, san := range sans {
+		m, err := chess.AlgebraicNotation{}.Decode(pos, san)
+		if err != nil {
+			t.Fatalf("decode %s: %v", san, err)
+		}
+		color := "w"
+		if pos.Turn() == chess.Black {
+			color = "b"
+		}
+		out = append(out, models.Move{
+			MoveUCI:   chess.UCINotation{}.Encode(pos, m),
+			MoveSAN:   san,
+			Ply:       i + 1,
+			Color:     color,
+			FenBefore: models.FENEval{FEN: NormalizeFEN(pos.String())},
+			Analysis:  models.MoveAnalysis{CPChange: cpLoss[i+1]},
+		})
+		pos = pos.Update(m)
+	}
+	return out
+}
+
+func TestParseRepertoireVariations(t *testing.T) {
+	moves, err := ParseRepertoire(testRepertoirePGN)
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	book := newRepertoireBook(moves)
+
+	afterE4 := NormalizeFEN("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1")
+	replies := book[afterE4]
+	if len(replies) != 3 {
+		t.Fatalf("replies to 1. e4 = %+v, want c5, e5 and c6", replies)
+	}
+	var sans []string
+	for _, r := range replies {
+		sans = append(sans, r.MoveSAN)
+		if r.Line != "1. e4" || r.Ply != 2 || r.SideToMove != "b" {
+			t.Fatalf("reply %+v has wrong line, ply or side", r)
+		}
+	}
+	if strings.Join(sans, " ") != "c5 e5 c6" {
+		t.Fatalf("reply order = %v", sans)
+	}
+
+	var bb5 *models.RepertoireMove
+	for i := range moves {
+		if moves[i].MoveSAN == "Bb5" {
+			bb5 = &moves[i]
+		}
+	}
+	if bb5 == nil || bb5.Line != "1. e4 e5 2. Nf3 Nc6" || bb5.Ply != 5 {
+		t.Fatalf("Bb5 = %+v", bb5)
+	}
+	if book.maxPly() != 5 {
+		t.Fatalf("maxPly = %d, want 5", book.maxPly())
+	}
+}
+
+func TestParseRepertoireErrors(t *testing.T) {
+	for _, pgn := range []string{
+		"1. e4 e5 2. Ke3",
+		"1. e4 (1. d4",
+		"1. e4 e5 )",
+		"( 1. e4 )",
+	} {
+		if _, err := ParseRepertoire(pgn); err == nil {
+			t.Fatalf("ParseRepertoire(%q) should fail", pgn)
+		}
+	}
+}
+
+func TestParseRepertoireZeroCastling(t *testing.T) {
+	moves, err := ParseRepertoire("1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. 0-0 Nf6 (4... d6 5. c3) 5. d3 0-0 *")
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	var sans []string
+	for _, m := range moves {
+		sans = append(sans, m.MoveSAN)
+	}
+	if got := strings.Join(sans, " "); got != "e4 e5 Nf3 Nc6 Bc4 Bc5 O-O Nf6 d6 c3 d3 O-O" {
+		t.Fatalf("moves = %s", got)
+	}
+	if last := moves[len(moves)-1]; last.SideToMove != "b" || last.MoveUCI != "e8g8" || last.Ply != 10 {
+		t.Fatalf("black castling = %+v", last)
+	}
+}
+
+func TestParseRepertoireFENStart(t *testing.T) {
+	pgn := `[SetUp "1"]
+[FEN "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2"]
+
+2. Nf3 Nc6 (2... d6 3. d4) *`
+	moves, err := ParseRepertoire(pgn)
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	for _, m := range moves {
+		if m.MoveSAN == "d4" && m.Line != "2. Nf3 d6" {
+			t.Fatalf("d4 line = %q", m.Line)
+		}
+	}
+	if len(moves) != 4 {
+		t.Fatalf("got %d moves, want 4", len(moves))
+	}
+}
+
+func TestFindDeviation(t *testing.T) {
+	moves, err := ParseRepertoire(testRepertoirePGN)
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	book := newRepertoireBook(moves)
+
+	cases := []struct {
+		name       string
+		sans       []string
+		outcome    string
+		deviatedBy string
+		ply        int
+	}{
+		{"player forgets", []string{"e4", "c5", "Nf3", "d6", "c3"}, RepertoireDeviation, "player", 5},
+		{"opponent deviates", []string{"e4", "d5", "exd5"}, RepertoireDeviation, "opponent", 2},
+		{"repertoire ends", []string{"e4", "c5", "Nf3", "d6", "d4", "cxd4"}, RepertoireEnded, "", 6},
+		{"game ends in book", []string{"e4", "e5", "Nf3"}, RepertoireInBook, "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := repertoireGame{URL: "u", Moves: movesFromSAN(t, map[int]int{5: 40}, tc.sans...)}
+			dev := findDeviation(book, "white", g)
+			if dev.Outcome != tc.outcome || dev.DeviatedBy != tc.deviatedBy || dev.Ply != tc.ply {
+				t.Fatalf("deviation = %+v", dev)
+			}
+		})
+	}
+}
+
+func TestBuildRepertoireReport(t *testing.T) {
+	moves, err := ParseRepertoire(testRepertoirePGN)
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	book := newRepertoireBook(moves)
+
+	games := []repertoireGame{
+		{URL: "g1", Moves: movesFromSAN(t, map[int]int{5: 40}, "e4", "c5", "Nf3", "d6", "c3")},
+		{URL: "g2", Moves: movesFromSAN(t, map[int]int{5: 80}, "e4", "c5", "Nf3", "d6", "Bc4")},
+		{URL: "g3", Moves: movesFromSAN(t, map[int]int{3: 150}, "e4", "e5", "Bc4")},
+		{URL: "g4", Moves: movesFromSAN(t, nil, "e4", "d5")},
+		{URL: "g5", Moves: movesFromSAN(t, nil, "e4", "c6", "d4")},
+	}
+	r := buildRepertoireReport("alice", "white", book, games)
+
+	if r.GamesChecked != 5 || r.PlayerDeviations != 3 || r.OpponentDeviations != 1 || r.InBook != 1 {
+		t.Fatalf("counts = %+v", r)
+	}
+	if r.AvgPlayerCPLoss != 90 {
+		t.Fatalf("AvgPlayerCPLoss = %v, want 90", r.AvgPlayerCPLoss)
+	}
+	if len(r.ForgottenLines) != 2 {
+		t.Fatalf("forgotten lines = %+v", r.ForgottenLines)
+	}
+	top := r.ForgottenLines[0]
+	if top.Times != 2 || top.AvgCPLoss != 60 || top.Line != "1. e4 c5 2. Nf3 d6" ||
+		top.Played["c3"] != 1 || top.Played["Bc4"] != 1 || len(top.ExampleURLs) != 2 {
+		t.Fatalf("top forgotten line = %+v", top)
+	}
+	if len(top.Expected) != 1 || top.Expected[0] != "d4" {
+		t.Fatalf("expected = %v", top.Expected)
+	}
+}
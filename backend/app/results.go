@@ -0,0 +1,20 @@
+// Package app maps provider game results onto win/draw/loss outcomes.
+package app
+
+import "strings"
+
+// drawResults are the games.result values (Chess.com and Lichess) that mean a draw.
+var drawResults = []string{"draw", "agreed", "repetition", "stalemate", "insufficient", "50move", "timevsinsufficient"}
+
+// SQL fragments classifying g.result from the player's point of view.
+var (
+	sqlIsWin  = `(g.result = 'win')`
+	sqlIsDraw = `(g.result IN (` + sqlStringList(drawResults) + `))`
+	sqlIsLoss = `(g.result <> 'win' AND g.result NOT IN (` + sqlStringList(drawResults) + `))`
+)
+
+// sqlStringList renders fixed values, which must not contain quotes, as a
+// quoted SQL list.
+func sqlStringList(vals []string) string {
+	return "'" + strings.Join(vals, "','") + "'"
+}
@@ -4,6 +4,9 @@ package app
 import (
 	"time"
 
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
+	"example/my-go-api/app/tracing"
 	"example/my-go-api/auth"
 
 	"github.com/gin-contrib/cors"
@@ -11,17 +14,20 @@ import (
 )
 
 // NewRouter builds the shared HTTP router for both local and Lambda execution.
-func NewRouter() (*gin.Engine, error) {
-	router := gin.Default()
+func NewRouter(a *App) (*gin.Engine, error) {
+	router := gin.New()
+	router.Use(gin.Recovery(), logging.Middleware(), metrics.Middleware(), tracing.Middleware())
 	router.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		MaxAge:       12 * time.Hour,
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", logging.RequestIDHeader, "traceparent", "tracestate"},
+		ExposeHeaders: []string{logging.RequestIDHeader},
+		MaxAge:        12 * time.Hour,
 	}))
 
-	router.GET("/health", Health)
-	router.POST("/api/stripe/webhook", StripeWebhook)
+	router.GET("/health", a.Health)
+	router.GET("/ready", a.Ready)
+	router.POST("/api/stripe/webhook", a.StripeWebhook)
 
 	verifier, err := auth.NewVerifierFromEnv()
 	if err != nil && !auth.AuthDisabled() {
@@ -31,17 +37,30 @@ func NewRouter() (*gin.Engine, error) {
 	protected := router.Group("/")
 	protected.Use(auth.Middleware(verifier, auth.MiddlewareConfig{
 		OnAuthenticated: func(c *gin.Context, claims *auth.Claims) error {
-			return UpsertUserFromClaims(c.Request.Context(), claims)
+			return UpsertUserFromClaims(c.Request.Context(), a.Stores.Users, claims)
 		},
 	}))
-	protected.GET("/me", Me)
-	protected.GET("/chessgames/:username", GetChessGames)
-	protected.GET("/errors/:username", GetErrorPositions)
-	protected.GET("/games/count/:username", GetGamesCount)
-	protected.GET("/jobs/:jobid", GetJobStatus)
-	protected.POST("/api/billing/create-checkout-session", CreateCheckoutSession)
-	protected.POST("/api/billing/portal-session", CreatePortalSession)
-	protected.POST("/api/billing/update-plan", UpdateUserPlan)
+	protected.GET("/me", a.Me)
+	protected.GET("/chessgames/:username", a.GetChessGames)
+	protected.GET("/errors/:username", a.GetErrorPositions)
+	protected.GET("/errors/:username/export", a.ExportErrorPositions)
+	protected.GET("/scout/:username", a.GetScoutingReport)
+	protected.GET("/explorer/:username", a.GetExplorerPosition)
+	protected.POST("/repertoire/:username", a.UploadRepertoire)
+	protected.GET("/repertoire/:username/deviations", a.GetRepertoireDeviations)
+	protected.GET("/repertoire/:username/extracted", a.GetExtractedRepertoire)
+	protected.POST("/drills/sync/:username", a.SyncDrills)
+	protected.GET("/drills/due/:username", a.GetDueDrills)
+	protected.POST("/drills/answer/:username/:id", a.AnswerDrill)
+	protected.GET("/puzzles/:username", a.GetPuzzles)
+	protected.GET("/motifs/:username", a.GetMotifStats)
+	protected.GET("/missed-wins/:username", a.GetMissedWins)
+	protected.GET("/stats/:username", a.GetStats)
+	protected.GET("/games/count/:username", a.GetGamesCount)
+	protected.GET("/jobs/:jobid", a.GetJobStatus)
+	protected.POST("/api/billing/create-checkout-session", a.CreateCheckoutSession)
+	protected.POST("/api/billing/portal-session", a.CreatePortalSession)
+	protected.POST("/api/billing/update-plan", a.UpdateUserPlan)
 
 	return router, nil
 }
@@ -0,0 +1,232 @@
+// Package app builds opponent scouting reports from imported games.
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scoutDefaultMinGames = 3
+	scoutDefaultLimit    = 10
+	scoutExampleURLs     = 3
+	// Lines where the scouted player scores below this are worth steering toward.
+	scoutWeakScore = 0.5
+)
+
+// GetScoutingReport summarizes an opponent's openings, weak lines and recurring
+// errors. The opponent's games are imported through /chessgames/:username like
+// anyone else's; their moves are the ones played_by the imported username.
+func (a *App) GetScoutingReport(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+
+	minGames := scoutDefaultMinGames
+	if v := c.Query("min_games"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 {
+			minGames = n
+		}
+	}
+	limit := scoutDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	stats, err := a.Stores.Reports.FindOpeningStats(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	errorQuery := DefaultErrorPositionQuery()
+	errorQuery.Limit = limit
+	positions, _, err := a.Stores.Moves.FindErrorPositions(ctx, username, errorQuery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildScoutingReport(username, stats, positions, minGames, limit))
+}
+
+// FindOpeningStats aggregates a player's results per colour and opening, most
+// played first, with a few recent game URLs for each.
+func (s *sqlStore) FindOpeningStats(ctx context.Context, username string) ([]models.OpeningStat, error) {
+	// One row per example game: each opening's newest scoutExampleURLs games,
+	// carrying the opening's totals.
+	q := `
+WITH user_games AS (
+    SELECT
+        g.color,
+        COALESCE(g.eco_code, '') AS eco_code,
+        COALESCE(NULLIF(g.opening_name, ''), NULLIF(g.eco, ''), 'Unknown') AS opening_name,
+        g.url,
+        g.when_unix,
+        CASE WHEN ` + sqlIsWin + `  THEN 1 ELSE 0 END AS win,
+        CASE WHEN ` + sqlIsDraw + ` THEN 1 ELSE 0 END AS draw,
+        CASE WHEN ` + sqlIsLoss + ` THEN 1 ELSE 0 END AS loss
+    FROM games g
+    WHERE g.username = $1
+      AND g.start_fen IS NULL
+),
+ranked AS (
+    SELECT
+        color, eco_code, opening_name, url,
+        COUNT(*)  OVER (PARTITION BY color, eco_code, opening_name) AS games,
+        SUM(win)  OVER (PARTITION BY color, eco_code, opening_name) AS wins,
+        SUM(draw) OVER (PARTITION BY color, eco_code, opening_name) AS draws,
+        SUM(loss) OVER (PARTITION BY color, eco_code, opening_name) AS losses,
+        ROW_NUMBER() OVER (PARTITION BY color, eco_code, opening_name ORDER BY when_unix DESC) AS rn
+    FROM user_games
+)
+SELECT color, eco_code, opening_name, games, wins, draws, losses, url
+FROM ranked
+WHERE rn <= $2
+ORDER BY games DESC, opening_name, color, eco_code, rn;
+`
+
+	rows, err := s.db.QueryContext(ctx, q, username, scoutExampleURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.OpeningStat
+	for rows.Next() {
+		var (
+			st  models.OpeningStat
+			url string
+		)
+		if err := rows.Scan(
+			&st.Color,
+			&st.ECOCode,
+			&st.OpeningName,
+			&st.Games,
+			&st.Wins,
+			&st.Draws,
+			&st.Losses,
+			&url,
+		); err != nil {
+			return nil, err
+		}
+		if n := len(out); n == 0 || out[n-1].Color != st.Color || out[n-1].ECOCode != st.ECOCode || out[n-1].OpeningName != st.OpeningName {
+			st.Score = openingScore(st)
+			st.ExampleURLs = []string{}
+			out = append(out, st)
+		}
+		last := &out[len(out)-1]
+		last.ExampleURLs = append(last.ExampleURLs, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func openingScore(s models.OpeningStat) float64 {
+	if s.Games == 0 {
+		return 0
+	}
+	return (float64(s.Wins) + float64(s.Draws)/2) / float64(s.Games)
+}
+
+func oppositeColor(color string) string {
+	if color == "white" {
+		return "black"
+	}
+	return "white"
+}
+
+// buildScoutingReport splits opening stats by colour, picks the worst-scoring
+// lines with at least minGames games and merges them with the error positions
+// into a "steer toward" list.
+func buildScoutingReport(username string, stats []models.OpeningStat, positions []models.SuboptimalFensReport, minGames, limit int) models.ScoutingReport {
+	report := models.ScoutingReport{
+		Username:        username,
+		OpeningsAsWhite: []models.OpeningStat{},
+		OpeningsAsBlack: []models.OpeningStat{},
+		WeakLines:       []models.OpeningStat{},
+		ErrorPositions:  positions,
+		SteerToward:     []models.SteerLine{},
+	}
+	if report.ErrorPositions == nil {
+		report.ErrorPositions = []models.SuboptimalFensReport{}
+	}
+
+	for _, s := range stats {
+		if s.Color == "white" && len(report.OpeningsAsWhite) < limit {
+			report.OpeningsAsWhite = append(report.OpeningsAsWhite, s)
+		} else if s.Color == "black" && len(report.OpeningsAsBlack) < limit {
+			report.OpeningsAsBlack = append(report.OpeningsAsBlack, s)
+		}
+		if s.Games >= minGames && s.Score < scoutWeakScore {
+			report.WeakLines = append(report.WeakLines, s)
+		}
+	}
+	sort.SliceStable(report.WeakLines, func(i, j int) bool {
+		if report.WeakLines[i].Score != report.WeakLines[j].Score {
+			return report.WeakLines[i].Score < report.WeakLines[j].Score
+		}
+		return report.WeakLines[i].Games > report.WeakLines[j].Games
+	})
+	if len(report.WeakLines) > limit {
+		report.WeakLines = report.WeakLines[:limit]
+	}
+	if len(report.ErrorPositions) > limit {
+		report.ErrorPositions = report.ErrorPositions[:limit]
+	}
+
+	for _, s := range report.WeakLines {
+		report.SteerToward = append(report.SteerToward, models.SteerLine{
+			Reason:      "low_score",
+			PlayAs:      oppositeColor(s.Color),
+			ECOCode:     s.ECOCode,
+			OpeningName: s.OpeningName,
+			Games:       s.Games,
+			Score:       s.Score,
+			ExampleURLs: s.ExampleURLs,
+		})
+	}
+	for _, p := range report.ErrorPositions {
+		line := models.SteerLine{
+			Reason:              "frequent_error",
+			NormalizedFenBefore: p.BadFen.NormalizedFenBefore,
+			Games:               p.BadFen.TimesSeen,
+			ErrorRate:           p.BadFen.ErrorRate,
+			ExampleURLs:         []string{},
+		}
+		// The scouted player is to move in their error positions.
+		line.PlayAs = "black"
+		if p.BadFen.SideToMove == "b" {
+			line.PlayAs = "white"
+		}
+		seen := map[string]bool{}
+		for _, m := range p.Moves {
+			if m.URL == "" || seen[m.URL] || len(line.ExampleURLs) >= scoutExampleURLs {
+				continue
+			}
+			seen[m.URL] = true
+			line.ExampleURLs = append(line.ExampleURLs, m.URL)
+			if line.ECOCode == "" && line.OpeningName == "" {
+				line.OpeningName = m.ECO
+			}
+		}
+		report.SteerToward = append(report.SteerToward, line)
+	}
+
+	return report
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"example/my-go-api/app/models"
+)
+
+func TestResultSQL(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+	results := []string{"win", "agreed", "repetition", "50move", "checkmated", "resigned", "timeout"}
+	var games []models.GameLite
+	for i, r := range results {
+		games = append(games, models.GameLite{URL: fmt.Sprintf("g%d", i), When: int64(i), Color: "white", Result: r})
+	}
+	if err := s.SaveGames(ctx, "alice", games); err != nil {
+		t.Fatalf("SaveGames: %v", err)
+	}
+
+	var wins, draws, losses int
+	if err := s.db.QueryRowContext(ctx, `
+SELECT
+    SUM(CASE WHEN `+sqlIsWin+`  THEN 1 ELSE 0 END),
+    SUM(CASE WHEN `+sqlIsDraw+` THEN 1 ELSE 0 END),
+    SUM(CASE WHEN `+sqlIsLoss+` THEN 1 ELSE 0 END)
+FROM games g`).Scan(&wins, &draws, &losses); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if wins != 1 || draws != 3 || losses != 3 {
+		t.Fatalf("wins/draws/losses = %d/%d/%d, want 1/3/3", wins, draws, losses)
+	}
+}
+
+func TestBuildScoutingReport(t *testing.T) {
+	stats := []models.OpeningStat{
+		{Color: "white", OpeningName: "Italian Game", Games: 10, Wins: 7, Draws: 1, Losses: 2, ExampleURLs: []string{"w1"}},
+		{Color: "black", OpeningName: "Sicilian Defense", Games: 6, Wins: 1, Draws: 1, Losses: 4, ExampleURLs: []string{"b1", "b2"}},
+		{Color: "black", OpeningName: "French Defense", Games: 2, Losses: 2, ExampleURLs: []string{"b3"}},
+	}
+	for i := range stats {
+		stats[i].Score = openingScore(stats[i])
+	}
+	positions := []models.SuboptimalFensReport{{
+		BadFen: models.SuboptimalFen{NormalizedFenBefore: "fen", TimesSeen: 4, ErrorRate: 0.75, SideToMove: "w"},
+		Moves:  []models.Move{{URL: "g1", ECO: "Scotch Game"}, {URL: "g1"}, {URL: "g2"}},
+	}}
+
+	report := buildScoutingReport("bob", stats, positions, 3, 10)
+
+	if len(report.OpeningsAsWhite) != 1 || len(report.OpeningsAsBlack) != 2 {
+		t.Fatalf("openings by colour = %d white, %d black", len(report.OpeningsAsWhite), len(report.OpeningsAsBlack))
+	}
+	// French has too few games to count as a weak line.
+	if len(report.WeakLines) != 1 || report.WeakLines[0].OpeningName != "Sicilian Defense" {
+		t.Fatalf("weak lines = %+v", report.WeakLines)
+	}
+	if len(report.SteerToward) != 2 {
+		t.Fatalf("expected 2 steer-toward lines, got %+v", report.SteerToward)
+	}
+	weak := report.SteerToward[0]
+	if weak.Reason != "low_score" || weak.PlayAs != "white" || len(weak.ExampleURLs) != 2 {
+		t.Fatalf("low_score line = %+v", weak)
+	}
+	errLine := report.SteerToward[1]
+	if errLine.Reason != "frequent_error" || errLine.PlayAs != "black" || errLine.OpeningName != "Scotch Game" {
+		t.Fatalf("frequent_error line = %+v", errLine)
+	}
+	if len(errLine.ExampleURLs) != 2 || errLine.ExampleURLs[0] != "g1" || errLine.ExampleURLs[1] != "g2" {
+		t.Fatalf("frequent_error urls = %v", errLine.ExampleURLs)
+	}
+}
@@ -0,0 +1,144 @@
+-- SQLite schema for local, single-file use. It mirrors the Postgres migrations
+-- in migrations/sql at their latest version; keep the two in sync, and keep
+-- user_version at the end equal to that version. OpenSQLiteStore refuses files
+-- with a lower one.
+-- TEXT[] columns hold Postgres array literals ('{a,b}'), read via pq.Array.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                 TEXT PRIMARY KEY,
+    auth0_sub          TEXT NOT NULL UNIQUE,
+    email              TEXT,
+    name               TEXT,
+    plan               TEXT DEFAULT 'FREE',
+    analyses_used      INTEGER NOT NULL DEFAULT 0,
+    usage_period_start TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    stripe_customer_id TEXT UNIQUE,
+    last_login         TIMESTAMP,
+    created_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id                 TEXT PRIMARY KEY,
+    username           TEXT NOT NULL,
+    started_by_user_id TEXT REFERENCES users (id),
+    status             TEXT NOT NULL DEFAULT 'queued',
+    total_games        INTEGER NOT NULL,
+    batch_size         INTEGER NOT NULL,
+    total_batches      INTEGER NOT NULL,
+    completed_batches  INTEGER NOT NULL DEFAULT 0,
+    created_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    id                INTEGER PRIMARY KEY,
+    username          TEXT NOT NULL,
+    url               TEXT NOT NULL,
+    when_unix         INTEGER NOT NULL,
+    color             TEXT NOT NULL,
+    opponent          TEXT,
+    opponent_rating   INTEGER,
+    result            TEXT,
+    rated             BOOLEAN,
+    time_class        TEXT,
+    time_control      TEXT,
+    pgn               TEXT,
+    eco               TEXT,
+    variant           TEXT,
+    start_fen         TEXT,
+    eco_code          TEXT,
+    opening_name      TEXT,
+    opening_family    TEXT,
+    opening_variation TEXT,
+    opening_ply       INTEGER,
+    UNIQUE (username, url)
+);
+
+CREATE INDEX IF NOT EXISTS games_username_when_idx ON games (username, when_unix DESC);
+
+CREATE TABLE IF NOT EXISTS moves (
+    game_id               INTEGER NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    ply                   INTEGER NOT NULL,
+    move_number           INTEGER NOT NULL,
+    fen_before            TEXT,
+    fen_after             TEXT,
+    move_uci              TEXT NOT NULL,
+    move_san              TEXT,
+    color                 TEXT,
+    eval_before_cp        INTEGER,
+    eval_after_cp         INTEGER,
+    eval_before_mate      INTEGER,
+    eval_after_mate       INTEGER,
+    eval_depth            INTEGER,
+    eval_time             INTEGER,
+    centipawn_change      INTEGER,
+    best_move_uci         TEXT,
+    is_inaccuracy         BOOLEAN NOT NULL DEFAULT FALSE,
+    is_mistake            BOOLEAN NOT NULL DEFAULT FALSE,
+    is_blunder            BOOLEAN NOT NULL DEFAULT FALSE,
+    is_suboptimal         BOOLEAN NOT NULL DEFAULT FALSE,
+    normalized_fen_before TEXT,
+    played_by             TEXT,
+    motifs                TEXT NOT NULL DEFAULT '{}',
+    is_missed_win         BOOLEAN NOT NULL DEFAULT FALSE,
+    missed_win_cp         INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (game_id, ply)
+);
+
+CREATE INDEX IF NOT EXISTS moves_normalized_fen_before_idx ON moves (normalized_fen_before);
+
+CREATE TABLE IF NOT EXISTS repertoire_moves (
+    username       TEXT NOT NULL,
+    color          TEXT NOT NULL,
+    normalized_fen TEXT NOT NULL,
+    side_to_move   TEXT NOT NULL,
+    move_uci       TEXT NOT NULL,
+    move_san       TEXT NOT NULL,
+    line           TEXT NOT NULL,
+    ply            INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS repertoire_moves_username_color_idx ON repertoire_moves (username, color);
+
+CREATE TABLE IF NOT EXISTS drill_cards (
+    id             INTEGER PRIMARY KEY,
+    username       TEXT NOT NULL,
+    normalized_fen TEXT NOT NULL,
+    side_to_move   TEXT NOT NULL,
+    answers        TEXT NOT NULL DEFAULT '{}',
+    times_seen     INTEGER NOT NULL DEFAULT 0,
+    error_count    INTEGER NOT NULL DEFAULT 0,
+    last_error_at  INTEGER NOT NULL DEFAULT 0,
+    status         TEXT NOT NULL DEFAULT 'active',
+    ease           REAL NOT NULL DEFAULT 2.5,
+    interval_days  INTEGER NOT NULL DEFAULT 0,
+    repetitions    INTEGER NOT NULL DEFAULT 0,
+    lapses         INTEGER NOT NULL DEFAULT 0,
+    reviews        INTEGER NOT NULL DEFAULT 0,
+    due_at         INTEGER NOT NULL DEFAULT 0,
+    last_review_at INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (username, normalized_fen)
+);
+
+CREATE INDEX IF NOT EXISTS drill_cards_due_idx ON drill_cards (username, status, due_at);
+
+CREATE TABLE IF NOT EXISTS puzzles (
+    id           INTEGER PRIMARY KEY,
+    username     TEXT NOT NULL,
+    game_id      INTEGER NOT NULL REFERENCES games (id) ON DELETE CASCADE,
+    source_ply   INTEGER NOT NULL,
+    blunder_by   TEXT NOT NULL,
+    fen          TEXT NOT NULL,
+    solver_color TEXT NOT NULL,
+    solution     TEXT NOT NULL DEFAULT '{}',
+    solution_san TEXT NOT NULL DEFAULT '{}',
+    theme        TEXT NOT NULL DEFAULT '',
+    eval_cp      INTEGER NOT NULL DEFAULT 0,
+    rejected     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at   INTEGER NOT NULL,
+    UNIQUE (username, game_id, source_ply)
+);
+
+CREATE INDEX IF NOT EXISTS puzzles_username_created_idx ON puzzles (username, created_at DESC);
+
+PRAGMA user_version = 6;
@@ -0,0 +1,302 @@
+// Package app reports a user's progress over time.
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatsBucketWeek  = "week"
+	StatsBucketMonth = "month"
+
+	// Moves up to this number count as opening moves for the repeated-position series.
+	statsOpeningMoves = 10
+)
+
+// StatsQuery selects and splits the progress series.
+type StatsQuery struct {
+	Bucket         string // StatsBucketWeek or StatsBucketMonth
+	TimeClass      string
+	Color          string
+	From           int64 // unix seconds, inclusive
+	To             int64 // unix seconds, exclusive
+	SplitTimeClass bool  // one series per time class
+	SplitColor     bool  // one series per colour
+}
+
+// statsRow is one bucket of one series as aggregated by the database.
+type statsRow struct {
+	Bucket         int64
+	TimeClass      string
+	Color          string
+	Games          int
+	Wins           int
+	Draws          int
+	Losses         int
+	Moves          int
+	CPLost         int64
+	Blunders       int
+	Mistakes       int
+	Inaccuracies   int
+	Repeated       int
+	RepeatedErrors int
+}
+
+// GetStats returns the user's progress as time series bucketed by
+// ?bucket=week|month, optionally filtered by time_class, color, from and to,
+// and split into one series per value with ?split=time_class,color.
+func (a *App) GetStats(c *gin.Context) {
+	username := strings.ToLower(c.Param("username"))
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing username"})
+		return
+	}
+	q, err := parseStatsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	rows, err := a.Stores.Reports.FindStats(ctx, username, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.StatsReport{
+		Username: username,
+		Bucket:   q.Bucket,
+		Series:   buildStatsSeries(rows),
+	})
+}
+
+func parseStatsQuery(c *gin.Context) (StatsQuery, error) {
+	q := StatsQuery{
+		Bucket:    strings.ToLower(c.DefaultQuery("bucket", StatsBucketWeek)),
+		TimeClass: strings.ToLower(strings.TrimSpace(c.Query("time_class"))),
+	}
+	if q.Bucket != StatsBucketWeek && q.Bucket != StatsBucketMonth {
+		return q, fmt.Errorf("bucket must be week or month")
+	}
+	if v := strings.ToLower(c.Query("color")); v != "" {
+		if v != "white" && v != "black" {
+			return q, fmt.Errorf("color must be white or black")
+		}
+		q.Color = v
+	}
+	for _, d := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"from", &q.From},
+		{"to", &q.To},
+	} {
+		if v := c.Query(d.name); v != "" {
+			ts, err := parseReportDate(v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be a unix timestamp or YYYY-MM-DD", d.name)
+			}
+			*d.dst = ts
+		}
+	}
+	if v := c.Query("split"); v != "" {
+		for _, dim := range strings.Split(strings.ToLower(v), ",") {
+			switch strings.TrimSpace(dim) {
+			case "time_class":
+				q.SplitTimeClass = true
+			case "color":
+				q.SplitColor = true
+			default:
+				return q, fmt.Errorf("split must list time_class and/or color")
+			}
+		}
+	}
+	return q, nil
+}
+
+// FindStats aggregates the user's analysed games and moves per bucket and
+// series. A move is "repeated" when the user reached the same opening position
+// in an earlier game; that is looked up over all of the user's games, so from
+// and to only limit which buckets are returned.
+func (s *sqlStore) FindStats(ctx context.Context, username string, q StatsQuery) ([]statsRow, error) {
+	bucketExpr, ok := s.statsBucketSQL[q.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown stats bucket %q", q.Bucket)
+	}
+
+	args := []any{username, statsOpeningMoves}
+	var gameFilters, rangeFilters strings.Builder
+	add := func(sb *strings.Builder, clause string, v any) {
+		args = append(args, v)
+		fmt.Fprintf(sb, "\n      AND "+clause, fmt.Sprintf("$%d", len(args)))
+	}
+	if q.TimeClass != "" {
+		add(&gameFilters, "g.time_class = %s", q.TimeClass)
+	}
+	if q.Color != "" {
+		add(&gameFilters, "g.color = %s", q.Color)
+	}
+	if q.From > 0 {
+		add(&rangeFilters, "when_unix >= %s", q.From)
+	}
+	if q.To > 0 {
+		add(&rangeFilters, "when_unix < %s", q.To)
+	}
+
+	timeClassExpr, colorExpr := "''", "''"
+	if q.SplitTimeClass {
+		timeClassExpr = "COALESCE(g.time_class, '')"
+	}
+	if q.SplitColor {
+		colorExpr = "g.color"
+	}
+
+	query := `
+WITH user_games AS (
+    SELECT
+        g.id,
+        g.when_unix,
+        ` + bucketExpr + ` AS bucket,
+        ` + timeClassExpr + ` AS time_class,
+        ` + colorExpr + ` AS color,
+        CASE WHEN ` + sqlIsWin + `  THEN 1 ELSE 0 END AS win,
+        CASE WHEN ` + sqlIsDraw + ` THEN 1 ELSE 0 END AS draw,
+        CASE WHEN ` + sqlIsLoss + ` THEN 1 ELSE 0 END AS loss
+    FROM games g
+    WHERE g.username = $1
+      AND EXISTS (SELECT 1 FROM moves m WHERE m.game_id = g.id)` + gameFilters.String() + `
+),
+user_moves AS (
+    SELECT
+        ug.bucket,
+        ug.time_class,
+        ug.color,
+        ug.when_unix,
+        m.centipawn_change,
+        m.is_blunder,
+        m.is_mistake,
+        m.is_inaccuracy,
+        m.move_number <= $2
+            AND FIRST_VALUE(m.game_id) OVER (
+                PARTITION BY m.normalized_fen_before
+                ORDER BY ug.when_unix, ug.id
+            ) <> m.game_id AS repeated
+    FROM moves m
+    JOIN user_games ug ON ug.id = m.game_id
+    WHERE m.played_by = $1
+),
+game_stats AS (
+    SELECT bucket, time_class, color,
+        COUNT(*)  AS games,
+        SUM(win)  AS wins,
+        SUM(draw) AS draws,
+        SUM(loss) AS losses
+    FROM user_games
+    WHERE TRUE` + rangeFilters.String() + `
+    GROUP BY bucket, time_class, color
+),
+move_stats AS (
+    SELECT bucket, time_class, color,
+        COUNT(*) AS moves,
+        SUM(COALESCE(centipawn_change, 0)) AS cp_lost,
+        SUM(CASE WHEN is_blunder    THEN 1 ELSE 0 END) AS blunders,
+        SUM(CASE WHEN is_mistake    THEN 1 ELSE 0 END) AS mistakes,
+        SUM(CASE WHEN is_inaccuracy THEN 1 ELSE 0 END) AS inaccuracies,
+        SUM(CASE WHEN repeated THEN 1 ELSE 0 END) AS repeated,
+        SUM(CASE WHEN repeated AND (is_inaccuracy OR is_mistake OR is_blunder) THEN 1 ELSE 0 END) AS repeated_errors
+    FROM user_moves
+    WHERE TRUE` + rangeFilters.String() + `
+    GROUP BY bucket, time_class, color
+)
+SELECT
+    gs.bucket, gs.time_class, gs.color,
+    gs.games, gs.wins, gs.draws, gs.losses,
+    COALESCE(ms.moves, 0), COALESCE(ms.cp_lost, 0),
+    COALESCE(ms.blunders, 0), COALESCE(ms.mistakes, 0), COALESCE(ms.inaccuracies, 0),
+    COALESCE(ms.repeated, 0), COALESCE(ms.repeated_errors, 0)
+FROM game_stats gs
+LEFT JOIN move_stats ms USING (bucket, time_class, color)
+ORDER BY gs.time_class, gs.color, gs.bucket;
+`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []statsRow
+	for rows.Next() {
+		var r statsRow
+		if err := rows.Scan(
+			&r.Bucket, &r.TimeClass, &r.Color,
+			&r.Games, &r.Wins, &r.Draws, &r.Losses,
+			&r.Moves, &r.CPLost,
+			&r.Blunders, &r.Mistakes, &r.Inaccuracies,
+			&r.Repeated, &r.RepeatedErrors,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// buildStatsSeries groups the rows into series and turns counts into rates.
+// Buckets without analysed games are left out rather than zero-filled.
+func buildStatsSeries(rows []statsRow) []models.StatsSeries {
+	series := []models.StatsSeries{}
+	index := map[[2]string]int{}
+	for _, r := range rows {
+		key := [2]string{r.TimeClass, r.Color}
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, models.StatsSeries{TimeClass: r.TimeClass, Color: r.Color})
+		}
+
+		p := models.StatsPoint{
+			BucketStart:       r.Bucket,
+			Games:             r.Games,
+			Wins:              r.Wins,
+			Draws:             r.Draws,
+			Losses:            r.Losses,
+			Moves:             r.Moves,
+			RepeatedPositions: r.Repeated,
+			RepeatedErrors:    r.RepeatedErrors,
+		}
+		if r.Games > 0 {
+			p.WinRate = float64(r.Wins) / float64(r.Games)
+		}
+		if r.Moves > 0 {
+			per100 := 100 / float64(r.Moves)
+			p.AvgCPLoss = float64(r.CPLost) / float64(r.Moves)
+			p.BlundersPer100 = float64(r.Blunders) * per100
+			p.MistakesPer100 = float64(r.Mistakes) * per100
+			p.InaccuraciesPer100 = float64(r.Inaccuracies) * per100
+		}
+		if r.Repeated > 0 {
+			p.RepeatedErrorRate = float64(r.RepeatedErrors) / float64(r.Repeated)
+		}
+		series[i].Points = append(series[i].Points, p)
+	}
+
+	for i := range series {
+		sort.Slice(series[i].Points, func(a, b int) bool {
+			return series[i].Points[a].BucketStart < series[i].Points[b].BucketStart
+		})
+	}
+	return series
+}
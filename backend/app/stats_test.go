@@ -0,0 +1,52 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestParseStatsQuery(t *testing.T) {
+	q, err := parseStatsQuery(newQueryContext("bucket=Month&color=white&from=2024-01-01&split=time_class,color"))
+	if err != nil {
+		t.Fatalf("parseStatsQuery error: %v", err)
+	}
+	if q.Bucket != StatsBucketMonth || q.Color != "white" || q.From != 1704067200 || !q.SplitTimeClass || !q.SplitColor {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+
+	q, err = parseStatsQuery(newQueryContext(""))
+	if err != nil || q.Bucket != StatsBucketWeek || q.SplitTimeClass || q.SplitColor {
+		t.Fatalf("defaults = %+v, err %v", q, err)
+	}
+
+	for _, raw := range []string{"bucket=day", "color=red", "split=opening", "to=yesterday"} {
+		if _, err := parseStatsQuery(newQueryContext(raw)); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestBuildStatsSeries(t *testing.T) {
+	series := buildStatsSeries([]statsRow{
+		{Bucket: 1706486400, TimeClass: "blitz", Games: 4, Wins: 2, Draws: 1, Losses: 1, Moves: 200, CPLost: 5000, Blunders: 4, Mistakes: 6, Inaccuracies: 10, Repeated: 20, RepeatedErrors: 5},
+		{Bucket: 1705881600, TimeClass: "blitz", Games: 1, Losses: 1},
+		{Bucket: 1705881600, TimeClass: "rapid", Games: 2, Wins: 2, Moves: 50, CPLost: 1000},
+	})
+	if len(series) != 2 || series[0].TimeClass != "blitz" || series[1].TimeClass != "rapid" {
+		t.Fatalf("unexpected series: %+v", series)
+	}
+
+	blitz := series[0].Points
+	if len(blitz) != 2 || blitz[0].BucketStart != 1705881600 {
+		t.Fatalf("points should be in bucket order: %+v", blitz)
+	}
+	if blitz[0].AvgCPLoss != 0 || blitz[0].WinRate != 0 {
+		t.Fatalf("a bucket without moves should have zero rates: %+v", blitz[0])
+	}
+	p := blitz[1]
+	if p.WinRate != 0.5 || p.AvgCPLoss != 25 || p.BlundersPer100 != 2 || p.MistakesPer100 != 3 || p.InaccuraciesPer100 != 5 {
+		t.Fatalf("unexpected rates: %+v", p)
+	}
+	if p.RepeatedErrorRate != 0.25 {
+		t.Fatalf("repeated error rate = %v, want 0.25", p.RepeatedErrorRate)
+	}
+}
@@ -0,0 +1,181 @@
+// Package app defines the storage interfaces the handlers and workers depend on.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrUserNotFound is returned by UserStore lookups for an unknown auth0 subject.
+var ErrUserNotFound = errors.New("user not found")
+
+// GameStore persists imported games.
+type GameStore interface {
+	// SaveGames inserts games for username, skipping URLs already stored.
+	SaveGames(ctx context.Context, username string, games []models.GameLite) error
+	// LoadGames reads a batch of games, newest first, using LIMIT/OFFSET.
+	LoadGames(ctx context.Context, username string, limit, offset int) ([]models.GameLite, error)
+	// LoadGamesByID reads username's games with the given ids, newest first.
+	LoadGamesByID(ctx context.Context, username string, ids []int) ([]models.GameLite, error)
+	// GameIDsByURL returns the ids of username's games stored under urls.
+	GameIDsByURL(ctx context.Context, username string, urls []string) ([]int, error)
+	CountGames(ctx context.Context, username string) (int, error)
+	// LoadGamesMissingOpening pages by id through games without opening metadata.
+	LoadGamesMissingOpening(ctx context.Context, afterID, limit int) ([]models.GameLite, error)
+	UpdateGameOpenings(ctx context.Context, games []models.GameLite) error
+}
+
+// MoveStore persists analysed moves and reports on them.
+type MoveStore interface {
+	// SaveMoves upserts the analysed moves of each game by (game_id, ply).
+	SaveMoves(ctx context.Context, games []models.GameLite, settings models.EngineSettings) error
+	// FindErrorPositions returns one page of the error-position report and the
+	// cursor of the next page, "" on the last.
+	FindErrorPositions(ctx context.Context, username string, q ErrorPositionQuery) ([]models.SuboptimalFensReport, string, error)
+}
+
+// JobStore tracks analysis jobs and their batches.
+type JobStore interface {
+	CreateJob(ctx context.Context, username string, startedByUserID uuid.UUID, totalGames, batchSize, totalBatches int) (string, error)
+	UpdateJobProgress(ctx context.Context, jobID string) error
+	FindJobStatus(ctx context.Context, jobID string) (models.JobStatus, error)
+}
+
+// UserStore persists accounts, plans and weekly usage.
+type UserStore interface {
+	// UpsertUser creates the user on first login and bumps last_login after.
+	UpsertUser(ctx context.Context, auth0Sub, email, name string) error
+	// GetUser returns ErrUserNotFound for an unknown subject.
+	GetUser(ctx context.Context, auth0Sub string) (models.User, error)
+	// UpdateUsage loads the user (creating a free one if missing) with the row
+	// locked, lets fn adjust AnalysesUsed and UsagePeriodStart, and stores them
+	// unless fn returns an error, which is passed through.
+	UpdateUsage(ctx context.Context, auth0Sub string, fn func(*models.User) error) (models.User, error)
+	SetStripeCustomerID(ctx context.Context, auth0Sub, customerID string) error
+	SetPlan(ctx context.Context, auth0Sub string, plan models.Plan) error
+	SetPlanByStripeCustomer(ctx context.Context, customerID string, plan models.Plan) error
+}
+
+// DrillStore persists the spaced-repetition drill cards.
+type DrillStore interface {
+	// FindDrillCandidates returns positions the user misplayed often enough per
+	// filters, with the engine's usual best move and when they last erred there.
+	FindDrillCandidates(ctx context.Context, username string, filters ErrorPositionQuery) ([]drillCandidate, error)
+	LoadDrillCards(ctx context.Context, username string) ([]models.DrillCard, error)
+	// ListDueDrillCards returns active cards due by now, most overdue first.
+	ListDueDrillCards(ctx context.Context, username string, now time.Time, limit int) ([]models.DrillCard, error)
+	// GetDrillCard returns ErrDrillNotFound for an id username has no card under.
+	GetDrillCard(ctx context.Context, username string, id int64) (models.DrillCard, error)
+	// SaveDrillCards upserts cards by (username, normalized_fen).
+	SaveDrillCards(ctx context.Context, cards []models.DrillCard) error
+	UpdateDrillSchedule(ctx context.Context, card models.DrillCard) error
+}
+
+// PuzzleStore persists generated puzzles and the blunders they came from.
+type PuzzleStore interface {
+	// FindPuzzleCandidates returns positions after blunders not tried yet.
+	FindPuzzleCandidates(ctx context.Context, username string, limit int) ([]puzzleCandidate, error)
+	// SavePuzzle records an attempt; rejected ones only mark the blunder as tried.
+	SavePuzzle(ctx context.Context, gameID int64, p models.Puzzle, rejected bool) error
+	ListPuzzles(ctx context.Context, username, theme, blunderBy string, limit int) ([]models.Puzzle, error)
+}
+
+// RepertoireStore persists uploaded repertoires and reads the games checked
+// against them.
+type RepertoireStore interface {
+	// SaveRepertoire replaces the user's repertoire for one colour.
+	SaveRepertoire(ctx context.Context, username, color string, moves []models.RepertoireMove) error
+	LoadRepertoire(ctx context.Context, username, color string) ([]models.RepertoireMove, error)
+	LoadRepertoireGames(ctx context.Context, username, color string, maxPly, limit int) ([]repertoireGame, error)
+}
+
+// ReportStore aggregates analysed games and moves for the read-only reports.
+type ReportStore interface {
+	FindExplorerPosition(ctx context.Context, username, fen string, filters ErrorPositionQuery) (models.ExplorerPosition, error)
+	FindMissedWins(ctx context.Context, username string, filters ErrorPositionQuery, limit int) (models.MissedWinReport, error)
+	FindMotifStats(ctx context.Context, username string, filters ErrorPositionQuery) (models.MotifReport, error)
+	FindOpeningStats(ctx context.Context, username string) ([]models.OpeningStat, error)
+	FindRepertoireEdges(ctx context.Context, username, color string, filters ErrorPositionQuery) ([]repertoireEdge, error)
+	FindStats(ctx context.Context, username string, q StatsQuery) ([]statsRow, error)
+}
+
+// HealthChecker reports on the database behind the stores, for /ready.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+	// CheckSchema fails when the database is missing migrations.
+	CheckSchema(ctx context.Context) error
+}
+
+// Stores bundles the storage backends handed to the router and the workers.
+type Stores struct {
+	Games      GameStore
+	Moves      MoveStore
+	Jobs       JobStore
+	Users      UserStore
+	Drills     DrillStore
+	Puzzles    PuzzleStore
+	Repertoire RepertoireStore
+	Reports    ReportStore
+	Health     HealthChecker // nil when the backend cannot report
+}
+
+// StoresFrom uses one backend for every store.
+func StoresFrom(s interface {
+	GameStore
+	MoveStore
+	JobStore
+	UserStore
+	DrillStore
+	PuzzleStore
+	RepertoireStore
+	ReportStore
+}) Stores {
+	stores := Stores{
+		Games: s, Moves: s, Jobs: s, Users: s,
+		Drills: s, Puzzles: s, Repertoire: s, Reports: s,
+	}
+	if h, ok := s.(HealthChecker); ok {
+		stores.Health = h
+	}
+	return stores
+}
+
+// MustOpenStores opens the backend picked by the store config: Postgres (the
+// default, see OpenPostgres) or a single SQLite file.
+func MustOpenStores() Stores {
+	stores, err := OpenStores()
+	if err != nil {
+		log.Fatalf("open stores: %v", err)
+	}
+	return stores
+}
+
+// OpenStores is MustOpenStores returning the error.
+func OpenStores() (Stores, error) {
+	cfg, err := config.Load(config.SectionStore)
+	if err != nil {
+		return Stores{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	switch cfg.Store.Driver {
+	case "sqlite":
+		s, err := OpenSQLiteStore(cfg.Store.SQLitePath)
+		if err != nil {
+			return Stores{}, err
+		}
+		return StoresFrom(s), nil
+	default:
+		d, err := OpenPostgres()
+		if err != nil {
+			return Stores{}, err
+		}
+		return StoresFrom(NewPostgresStore(d)), nil
+	}
+}
@@ -0,0 +1,368 @@
+// Package app implements the stores on Postgres, bulk loading with COPY.
+package app
+
+import (
+	"context"
+	"database/sql"
+
+	"example/my-go-api/app/migrations"
+	"example/my-go-api/app/models"
+
+	"github.com/lib/pq"
+)
+
+// PostgresStore is the production backend. It shares the portable queries
+// with SQLiteStore and stages bulk writes in temp tables filled with COPY.
+type PostgresStore struct {
+	sqlStore
+}
+
+// NewPostgresStore wraps an open Postgres connection pool.
+func NewPostgresStore(d *sql.DB) *PostgresStore {
+	return &PostgresStore{sqlStore{
+		db:      d,
+		lockRow: "\n\t\tFOR UPDATE",
+		txOpts:  &sql.TxOptions{Isolation: sql.LevelSerializable},
+		statsBucketSQL: map[string]string{
+			StatsBucketWeek:  `EXTRACT(EPOCH FROM date_trunc('week', to_timestamp(g.when_unix) AT TIME ZONE 'UTC'))::BIGINT`,
+			StatsBucketMonth: `EXTRACT(EPOCH FROM date_trunc('month', to_timestamp(g.when_unix) AT TIME ZONE 'UTC'))::BIGINT`,
+		},
+	}}
+}
+
+// CheckSchema fails with migrations.ErrSchemaBehind until `migrate up` has run.
+func (s *PostgresStore) CheckSchema(ctx context.Context) error {
+	_, _, err := migrations.Check(ctx, s.db)
+	return err
+}
+
+func (s *PostgresStore) SaveGames(ctx context.Context, username string, games []models.GameLite) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	// One transaction for everything
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 1) Temp staging table
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMP TABLE tmp_games (
+			username          TEXT,
+			url               TEXT,
+			when_unix         BIGINT,
+			color             TEXT,
+			opponent          TEXT,
+			opponent_rating   INT,
+			result            TEXT,
+			rated             BOOLEAN,
+			time_class        TEXT,
+			time_control      TEXT,
+			pgn               TEXT,
+			eco               TEXT,
+			variant           TEXT,
+			start_fen         TEXT,
+			eco_code          TEXT,
+			opening_name      TEXT,
+			opening_family    TEXT,
+			opening_variation TEXT,
+			opening_ply       INT
+		) ON COMMIT DROP;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2) COPY into tmp_games
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"tmp_games",
+		"username",
+		"url",
+		"when_unix",
+		"color",
+		"opponent",
+		"opponent_rating",
+		"result",
+		"rated",
+		"time_class",
+		"time_control",
+		"pgn",
+		"eco",
+		"variant",
+		"start_fen",
+		"eco_code",
+		"opening_name",
+		"opening_family",
+		"opening_variation",
+		"opening_ply",
+	))
+	if err != nil {
+		return err
+	}
+
+	for _, g := range games {
+		if _, err := stmt.Exec(
+			username,
+			g.URL,
+			g.When,
+			g.Color,
+			g.Opponent,
+			g.OppRating,
+			g.Result,
+			g.Rated,
+			g.TimeClass,
+			g.TimeControl,
+			g.PGN,
+			g.ECO,
+			g.Variant,
+			nullIfEmpty(g.StartFEN),
+			nullIfEmpty(g.ECOCode),
+			nullIfEmpty(g.OpeningName),
+			nullIfEmpty(g.OpeningFamily),
+			nullIfEmpty(g.OpeningVariation),
+			g.OpeningPly,
+		); err != nil {
+			return err
+		}
+	}
+
+	// finish COPY
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	// 3) Insert into real table with conflict handling
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO games (
+			username,
+			url,
+			when_unix,
+			color,
+			opponent,
+			opponent_rating,
+			result,
+			rated,
+			time_class,
+			time_control,
+			pgn,
+			eco,
+			variant,
+			start_fen,
+			eco_code,
+			opening_name,
+			opening_family,
+			opening_variation,
+			opening_ply
+		)
+		SELECT
+			username,
+			url,
+			when_unix,
+			color,
+			opponent,
+			opponent_rating,
+			result,
+			rated,
+			time_class,
+			time_control,
+			pgn,
+			eco,
+			variant,
+			start_fen,
+			eco_code,
+			opening_name,
+			opening_family,
+			opening_variation,
+			opening_ply
+		FROM tmp_games
+		ON CONFLICT (username, url) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 4) Commit
+	return tx.Commit()
+}
+
+func (s *PostgresStore) SaveMoves(ctx context.Context, games []models.GameLite, settings models.EngineSettings) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 1) Temp staging table
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMP TABLE tmp_moves (
+			game_id           BIGINT,
+			ply               INT,
+			move_number       INT,
+			fen_before		  TEXT,
+			fen_after		  TEXT,
+			move_uci          TEXT,
+			move_san          TEXT,
+			color             CHAR(1),
+			eval_before_cp       INT,
+			eval_after_cp     INT,
+			eval_before_mate         INT,
+			eval_after_mate INT,
+			eval_depth        INT,
+			eval_time      INT,
+			centipawn_change INT,
+			best_move_uci   TEXT,
+			is_inaccuracy BOOLEAN,
+			is_mistake BOOLEAN,
+			is_blunder BOOLEAN,
+			is_suboptimal BOOLEAN,
+			normalized_fen_before TEXT,
+			played_by TEXT,
+			motifs TEXT[],
+			is_missed_win BOOLEAN,
+			missed_win_cp INT
+		) ON COMMIT DROP;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2) COPY into tmp_moves
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"tmp_moves",
+		"game_id", "ply", "move_number", "fen_before", "fen_after",
+		"move_uci", "move_san", "color",
+		"eval_depth", "eval_time",
+		"eval_before_cp", "eval_after_cp",
+		"eval_before_mate", "eval_after_mate",
+		"centipawn_change", "best_move_uci", "is_inaccuracy", "is_mistake", "is_blunder", "is_suboptimal",
+		"normalized_fen_before", "played_by", "motifs", "is_missed_win", "missed_win_cp",
+	))
+	if err != nil {
+		return err
+	}
+
+	for _, g := range games {
+		for _, e := range g.Moves {
+
+			normalizedFen := NormalizeFEN(e.FenBefore.FEN)
+			if _, err := stmt.Exec(
+				g.GameId,
+				e.Ply,
+				e.MoveNumber,
+				e.FenBefore.FEN,
+				e.FenAfter.FEN,
+				e.MoveUCI,
+				e.MoveSAN,
+				e.Color,
+				settings.Depth,
+				settings.MoveTimeMS,
+				e.FenBefore.Score.CP,
+				e.FenAfter.Score.CP,
+				e.FenBefore.Score.Mate,
+				e.FenAfter.Score.Mate,
+				e.Analysis.CPChange,
+				e.FenBefore.Score.Best,
+				e.Analysis.Is_Innacuracy,
+				e.Analysis.Is_Mistake,
+				e.Analysis.Is_Blunder,
+				e.Analysis.Is_Suboptimal,
+				normalizedFen,
+				e.PlayedBy,
+				pq.Array(e.Analysis.Motifs),
+				e.Analysis.Is_Missed_Win,
+				e.Analysis.MissedWinCP,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+	stmt.Close()
+
+	// 3) Upsert from tmp_moves into moves
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO moves (
+			game_id, ply, move_number, fen_before,
+			fen_after, move_uci, move_san, color,
+			eval_depth, eval_time, eval_before_cp,
+			eval_after_cp, eval_before_mate, eval_after_mate, centipawn_change, best_move_uci, is_inaccuracy, is_mistake, is_blunder,
+			is_suboptimal, normalized_fen_before, played_by, motifs, is_missed_win, missed_win_cp
+		)
+		SELECT
+			game_id, ply, move_number, fen_before,
+			fen_after, move_uci, move_san, color,
+			eval_depth, eval_time, eval_before_cp,
+			eval_after_cp, eval_before_mate, eval_after_mate, centipawn_change, best_move_uci, is_inaccuracy, is_mistake, is_blunder,
+			is_suboptimal, normalized_fen_before, played_by, COALESCE(motifs, '{}'), is_missed_win, missed_win_cp
+		FROM tmp_moves
+		ON CONFLICT (game_id, ply) DO UPDATE
+		SET
+			eval_depth = EXCLUDED.eval_depth,
+			eval_time = EXCLUDED.eval_time,
+			eval_before_cp = EXCLUDED.eval_before_cp,
+			eval_after_cp = EXCLUDED.eval_after_cp,
+			eval_before_mate = EXCLUDED.eval_before_mate,
+			eval_after_mate = EXCLUDED.eval_after_mate,
+			centipawn_change = EXCLUDED.centipawn_change,
+			best_move_uci = EXCLUDED.best_move_uci,
+			is_inaccuracy = EXCLUDED.is_inaccuracy,
+			is_mistake = EXCLUDED.is_mistake,
+			is_blunder = EXCLUDED.is_blunder,
+			is_suboptimal = EXCLUDED.is_suboptimal,
+			motifs = EXCLUDED.motifs,
+			is_missed_win = EXCLUDED.is_missed_win,
+			missed_win_cp = EXCLUDED.missed_win_cp;
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveRepertoire replaces the user's repertoire for one colour with COPY.
+func (s *PostgresStore) SaveRepertoire(ctx context.Context, username, color string, moves []models.RepertoireMove) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteRepertoire(ctx, tx, username, color); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"repertoire_moves",
+		"username", "color", "normalized_fen", "side_to_move",
+		"move_uci", "move_san", "line", "ply",
+	))
+	if err != nil {
+		return err
+	}
+	for _, m := range moves {
+		if _, err := stmt.Exec(
+			username, color, m.NormalizedFen, m.SideToMove,
+			m.MoveUCI, m.MoveSAN, m.Line, m.Ply,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,831 @@
+// Package app implements the stores in SQL shared by Postgres and SQLite.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// sqlStore holds the queries Postgres and SQLite both accept: $N placeholders,
+// ON CONFLICT upserts and CTEs. TEXT[] columns are read and written with
+// pq.Array, which SQLite stores as the same '{a,b}' text.
+type sqlStore struct {
+	db *sql.DB
+	// lockRow is appended to the SELECT in read-modify-write transactions.
+	lockRow string
+	txOpts  *sql.TxOptions
+	// statsBucketSQL maps a stats bucket to the unix time its g.when_unix
+	// falls in, truncated in UTC.
+	statsBucketSQL map[string]string
+}
+
+// commonBestMoveSQL selects from the CTE from the most common non-empty
+// best_move_uci per keys, ties going to the lowest, as the row with rn = 1.
+// It stands in for Postgres' MODE() WITHIN GROUP, which SQLite lacks.
+func commonBestMoveSQL(from string, keys ...string) string {
+	cols, partition := "", ""
+	if len(keys) > 0 {
+		cols = strings.Join(keys, ", ") + ", "
+		partition = "PARTITION BY " + strings.Join(keys, ", ") + " "
+	}
+	return `
+    SELECT ` + cols + `best_move_uci,
+        ROW_NUMBER() OVER (` + partition + `ORDER BY COUNT(*) DESC, best_move_uci) AS rn
+    FROM ` + from + `
+    WHERE COALESCE(best_move_uci, '') <> ''
+    GROUP BY ` + cols + `best_move_uci`
+}
+
+// Ping checks the database answers.
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// gameColumns are the games columns scanGames reads, in its order.
+const gameColumns = `
+			id,
+			url,
+			when_unix,
+			color,
+			opponent,
+			opponent_rating,
+			result,
+			rated,
+			time_class,
+			time_control,
+			pgn,
+			COALESCE(variant, 'standard'),
+			COALESCE(start_fen, ''),
+			COALESCE(eco_code, ''),
+			COALESCE(opening_name, ''),
+			COALESCE(opening_family, ''),
+			COALESCE(opening_variation, ''),
+			COALESCE(opening_ply, 0)`
+
+// LoadGames reads a batch of games for a username using LIMIT/OFFSET.
+// Example: limit = 100, offset = batchIndex * limit
+func (s *sqlStore) LoadGames(ctx context.Context, username string, limit, offset int) ([]models.GameLite, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT`+gameColumns+`
+		FROM games
+		WHERE username = $1
+		ORDER BY when_unix DESC
+		LIMIT $2
+		OFFSET $3
+	`, username, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanGames(rows)
+}
+
+// LoadGamesByID reads username's games with the given ids, newest first.
+func (s *sqlStore) LoadGamesByID(ctx context.Context, username string, ids []int) ([]models.GameLite, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT`+gameColumns+`
+		FROM games
+		WHERE username = $1
+		  AND id IN (`+intList(ids)+`)
+		ORDER BY when_unix DESC
+	`, username)
+	if err != nil {
+		return nil, err
+	}
+	return scanGames(rows)
+}
+
+// urlLookupChunk bounds the placeholders of one GameIDsByURL query, well
+// under SQLite's and Postgres' limits.
+const urlLookupChunk = 500
+
+// GameIDsByURL returns the ids of username's games stored under urls, in no
+// particular order. URLs not stored are left out.
+func (s *sqlStore) GameIDsByURL(ctx context.Context, username string, urls []string) ([]int, error) {
+	var ids []int
+	for len(urls) > 0 {
+		chunk := urls[:min(len(urls), urlLookupChunk)]
+		urls = urls[len(chunk):]
+
+		args := []any{username}
+		placeholders := make([]string, len(chunk))
+		for i, u := range chunk {
+			args = append(args, u)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id
+			FROM games
+			WHERE username = $1
+			  AND url IN (`+strings.Join(placeholders, ", ")+`)
+		`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// intList renders ids as a comma-separated SQL list. Integers need no
+// placeholders, so the list is not bound by the drivers' parameter limits.
+func intList(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scanGames reads rows selected with gameColumns and closes them.
+func scanGames(rows *sql.Rows) ([]models.GameLite, error) {
+	defer rows.Close()
+
+	var out []models.GameLite
+	for rows.Next() {
+		var g models.GameLite
+		if err := rows.Scan(
+			&g.GameId,
+			&g.URL,
+			&g.When,
+			&g.Color,
+			&g.Opponent,
+			&g.OppRating,
+			&g.Result,
+			&g.Rated,
+			&g.TimeClass,
+			&g.TimeControl,
+			&g.PGN,
+			&g.Variant,
+			&g.StartFEN,
+			&g.ECOCode,
+			&g.OpeningName,
+			&g.OpeningFamily,
+			&g.OpeningVariation,
+			&g.OpeningPly,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadGamesMissingOpening reads games with no structured opening metadata, in id
+// order after afterID, so a backfill can page through them.
+func (s *sqlStore) LoadGamesMissingOpening(ctx context.Context, afterID, limit int) ([]models.GameLite, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, url, pgn
+		FROM games
+		WHERE id > $1
+		  AND eco_code IS NULL
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.GameLite
+	for rows.Next() {
+		var g models.GameLite
+		if err := rows.Scan(&g.GameId, &g.URL, &g.PGN); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateGameOpenings writes the structured opening fields for each game by id.
+func (s *sqlStore) UpdateGameOpenings(ctx context.Context, games []models.GameLite) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		UPDATE games
+		SET
+			eco_code = $2,
+			opening_name = $3,
+			opening_family = $4,
+			opening_variation = $5,
+			opening_ply = $6
+		WHERE id = $1;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, g := range games {
+		if _, err := stmt.ExecContext(
+			ctx,
+			g.GameId,
+			nullIfEmpty(g.ECOCode),
+			nullIfEmpty(g.OpeningName),
+			nullIfEmpty(g.OpeningFamily),
+			nullIfEmpty(g.OpeningVariation),
+			g.OpeningPly,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CountGames returns the number of games stored for a user.
+func (s *sqlStore) CountGames(ctx context.Context, username string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM games
+		WHERE username = $1;
+	`, username).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// FindErrorPositions reports positions the user keeps misplaying, filtered, sorted
+// and paged per q. It returns the cursor for the next page, or "" on the last page.
+func (s *sqlStore) FindErrorPositions(ctx context.Context, username string, q ErrorPositionQuery) ([]models.SuboptimalFensReport, string, error) {
+
+	args := []any{username}
+	filters, args := q.filterSQL(args)
+
+	args = append(args, q.MinTimesSeen, q.MinErrors)
+	thresholds := fmt.Sprintf("times_seen >= $%d\n      AND error_count >= $%d", len(args)-1, len(args))
+
+	cursorClause := ""
+	if q.Cursor != "" {
+		cur, err := decodeErrorPositionCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, cur.SortKey, cur.FEN)
+		cursorClause = fmt.Sprintf(
+			"WHERE sort_key < $%d OR (sort_key = $%d AND normalized_fen_before > $%d)",
+			len(args)-1, len(args)-1, len(args),
+		)
+	}
+
+	// Fetch one extra row to know whether there is another page.
+	args = append(args, q.Limit+1)
+	limitArg := fmt.Sprintf("$%d", len(args))
+
+	fenQuery := `
+WITH user_moves AS (
+    SELECT
+        m.normalized_fen_before,
+        m.color,
+        m.centipawn_change,
+        m.is_suboptimal,
+        m.is_inaccuracy,
+        m.is_mistake,
+        m.is_blunder,
+        ` + q.errorSQL() + ` AS is_error,
+        g.when_unix
+    FROM moves m
+    JOIN games g ON g.id = m.game_id
+    WHERE g.username   = $1
+      AND m.played_by  = g.username` + filters + `
+),
+position_stats AS (
+    SELECT
+        normalized_fen_before,
+        COUNT(*) AS times_seen,
+        SUM(CASE WHEN is_suboptimal THEN 1 ELSE 0 END) AS suboptimal_count,
+        SUM(CASE WHEN is_inaccuracy THEN 1 ELSE 0 END) AS inaccuracy_count,
+        SUM(CASE WHEN is_mistake    THEN 1 ELSE 0 END) AS mistake_count,
+        SUM(CASE WHEN is_blunder    THEN 1 ELSE 0 END) AS blunder_count,
+        SUM(CASE WHEN is_error      THEN 1 ELSE 0 END) AS error_count,
+        SUM(CASE WHEN is_error THEN COALESCE(centipawn_change, 0) ELSE 0 END) AS total_cp_lost,
+        MAX(when_unix) AS last_seen,
+        MIN(color) AS side_to_move
+    FROM user_moves
+    GROUP BY normalized_fen_before
+),
+filtered AS (
+    SELECT
+        *,
+        (CAST(error_count AS DOUBLE PRECISION) / times_seen) AS error_rate
+    FROM position_stats
+    WHERE ` + thresholds + `
+),
+ranked AS (
+    SELECT
+        *,
+        ` + q.sortSQL() + ` AS sort_key
+    FROM filtered
+)
+SELECT
+    normalized_fen_before,
+    times_seen,
+    suboptimal_count,
+    inaccuracy_count,
+    mistake_count,
+    blunder_count,
+    error_count,
+    error_rate,
+    total_cp_lost,
+    last_seen,
+    side_to_move,
+    sort_key
+FROM ranked
+` + cursorClause + `
+ORDER BY sort_key DESC, normalized_fen_before ASC
+LIMIT ` + limitArg + `;
+`
+
+	rows, err := s.db.QueryContext(ctx, fenQuery, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var (
+		reports  []models.SuboptimalFensReport
+		fens     []string
+		sortKeys []float64
+	)
+
+	for rows.Next() {
+		var (
+			fen     models.SuboptimalFen
+			sortKey float64
+		)
+		if err := rows.Scan(
+			&fen.NormalizedFenBefore,
+			&fen.TimesSeen,
+			&fen.SuboptimalCount,
+			&fen.InaccuracyCount,
+			&fen.MistakeCount,
+			&fen.BlunderCount,
+			&fen.ErrorCount,
+			&fen.ErrorRate,
+			&fen.TotalCPLost,
+			&fen.LastSeen,
+			&fen.SideToMove,
+			&sortKey,
+		); err != nil {
+			return nil, "", err
+		}
+		sortKeys = append(sortKeys, sortKey)
+
+		// collect FEN list for batch query
+		fens = append(fens, fen.NormalizedFenBefore)
+
+		reports = append(reports, models.SuboptimalFensReport{
+			BadFen: fen,
+			Moves:  nil, // will fill after batch query
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(reports) > q.Limit {
+		reports, fens = reports[:q.Limit], fens[:q.Limit]
+		nextCursor = encodeErrorPositionCursor(errorPositionCursor{
+			SortKey: sortKeys[q.Limit-1],
+			FEN:     fens[q.Limit-1],
+		})
+	}
+
+	if len(reports) == 0 {
+		return reports, "", nil
+	}
+
+	// batch fetch moves for all FENs at once
+	movesByFEN, err := s.fetchErrorMovesBatch(ctx, username, fens, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// attach moves to each report
+	for i := range reports {
+		fenKey := reports[i].BadFen.NormalizedFenBefore
+		if mv, ok := movesByFEN[fenKey]; ok {
+			reports[i].Moves = mv
+		} else {
+			// keep as empty slice if no moves found
+			reports[i].Moves = []models.Move{}
+		}
+	}
+
+	return reports, nextCursor, nil
+}
+
+// New batched helper: fetches error moves for many FENs in one query.
+// The same filters as the position report apply, so the moves match its counts.
+func (s *sqlStore) fetchErrorMovesBatch(ctx context.Context, username string, normalizedFens []string, q ErrorPositionQuery) (map[string][]models.Move, error) {
+	result := make(map[string][]models.Move, len(normalizedFens))
+	if len(normalizedFens) == 0 {
+		return result, nil
+	}
+
+	args := []any{username}
+	fenArgs := make([]string, len(normalizedFens))
+	for i, fen := range normalizedFens {
+		args = append(args, fen)
+		fenArgs[i] = fmt.Sprintf("$%d", len(args))
+	}
+	filters, args := q.filterSQL(args)
+
+	movesQuery := `
+SELECT
+    g.username,
+    g.url,
+	g.eco,
+    g.when_unix,
+    g.color            AS game_color,
+    g.opponent,
+    g.opponent_rating,
+    g.result,
+    g.time_class,
+    g.time_control,
+
+    m.game_id,
+    m.ply,
+    m.move_number,
+    m.color            AS move_color,
+    m.normalized_fen_before,
+    m.fen_before,
+
+    m.move_san,
+    m.move_uci         AS played_move_uci,
+    m.best_move_uci    AS engine_best_move_uci,
+
+    m.eval_before_cp,
+    m.eval_after_cp,
+    m.centipawn_change,
+
+    m.is_suboptimal,
+    m.is_inaccuracy,
+    m.is_mistake,
+    m.is_blunder,
+    COALESCE(m.motifs, '{}')
+FROM moves m
+JOIN games g ON g.id = m.game_id
+WHERE g.username              = $1
+  AND m.played_by             = g.username
+  AND m.normalized_fen_before IN (` + strings.Join(fenArgs, ", ") + `)
+  AND ` + q.errorSQL() + filters + `
+ORDER BY m.normalized_fen_before, g.when_unix DESC;
+`
+
+	rows, err := s.db.QueryContext(ctx, movesQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			user        string
+			url         string
+			eco         string
+			whenUnix    int64
+			gameColor   string
+			opponent    string
+			opponentElo int
+			resultStr   string
+			timeClass   string
+			timeControl string
+
+			gameID         int64
+			ply            int
+			moveNumber     int
+			moveColor      string
+			normalized     string
+			fenBefore      string
+			moveSAN        sql.NullString
+			playedMoveUCI  string
+			engineBestMove sql.NullString
+			evalBeforeCP   sql.NullInt64
+			evalAfterCP    sql.NullInt64
+			cpChange       sql.NullInt64
+			isSuboptimal   bool
+			isInaccuracy   bool
+			isMistake      bool
+			isBlunder      bool
+			motifs         []string
+		)
+
+		if err := rows.Scan(
+			&user,
+			&url,
+			&eco,
+			&whenUnix,
+			&gameColor,
+			&opponent,
+			&opponentElo,
+			&resultStr,
+			&timeClass,
+			&timeControl,
+			&gameID,
+			&ply,
+			&moveNumber,
+			&moveColor,
+			&normalized,
+			&fenBefore,
+			&moveSAN,
+			&playedMoveUCI,
+			&engineBestMove,
+			&evalBeforeCP,
+			&evalAfterCP,
+			&cpChange,
+			&isSuboptimal,
+			&isInaccuracy,
+			&isMistake,
+			&isBlunder,
+			pq.Array(&motifs),
+		); err != nil {
+			return nil, err
+		}
+
+		// quiet unused context fields that are not mapped onto the Move struct
+		_ = whenUnix
+		_ = gameColor
+		_ = opponentElo
+		_ = resultStr
+		_ = timeClass
+		_ = timeControl
+		_ = gameID
+		_ = evalAfterCP
+
+		mv := models.Move{
+			MoveUCI:    playedMoveUCI,
+			MoveSAN:    moveSAN.String,
+			PlayedBy:   user,
+			MoveNumber: moveNumber,
+			Ply:        ply,
+			Color:      moveColor,
+			FenBefore: models.FENEval{
+				MoveNumber: moveNumber,
+				SideToMove: moveColor,
+				FEN:        fenBefore,
+				Score: models.UCIScore{
+					CP:   nullableIntToPtr(evalBeforeCP),
+					Best: engineBestMove.String,
+				},
+			},
+			Analysis: models.MoveAnalysis{
+				CPChange:      int(cpChange.Int64),
+				Is_Suboptimal: isSuboptimal,
+				Is_Innacuracy: isInaccuracy,
+				Is_Mistake:    isMistake,
+				Is_Blunder:    isBlunder,
+				Motifs:        motifs,
+			},
+			URL:      url,
+			ECO:      eco,
+			Opponent: opponent,
+		}
+
+		result[normalized] = append(result[normalized], mv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// unchanged helper
+func nullableIntToPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func (s *sqlStore) CreateJob(ctx context.Context, username string, startedByUserID uuid.UUID, totalGames, batchSize, totalBatches int) (string, error) {
+	const q = `
+        INSERT INTO jobs (id, username, started_by_user_id, total_games, batch_size, total_batches)
+        VALUES ($1, $2, $3, $4, $5, $6);
+    `
+	jobID := uuid.NewString()
+	if _, err := s.db.ExecContext(ctx, q, jobID, username, startedByUserID, totalGames, batchSize, totalBatches); err != nil {
+		return "", err
+	}
+	logging.FromContext(ctx).Info("job created", "job_id", jobID, "user", username, "started_by", startedByUserID, "total_games", totalGames, "total_batches", totalBatches)
+	return jobID, nil
+}
+
+// UpdateJobProgress increments completed_batches for a job and sets
+// status to 'running' or 'completed' accordingly.
+func (s *sqlStore) UpdateJobProgress(ctx context.Context, jobID string) error {
+	const q = `
+        UPDATE jobs
+        SET
+            completed_batches = completed_batches + 1,
+            status = CASE
+                WHEN completed_batches + 1 >= total_batches THEN 'completed'
+                ELSE 'running'
+            END,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1;
+    `
+
+	res, err := s.db.ExecContext(ctx, q, jobID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err == nil && rows == 0 {
+		logging.FromContext(ctx).Warn("UpdateJobProgress: no job row found", "job_id", jobID)
+	}
+
+	return nil
+}
+
+// FindJobStatus fetches status and batch counts for a job id.
+func (s *sqlStore) FindJobStatus(ctx context.Context, jobID string) (models.JobStatus, error) {
+	var js models.JobStatus
+
+	const q = `
+        SELECT id, status, completed_batches, total_batches
+        FROM jobs
+        WHERE id = $1;
+    `
+
+	row := s.db.QueryRowContext(ctx, q, jobID)
+	if err := row.Scan(&js.ID, &js.Status, &js.CompletedBatches, &js.TotalBatches); err != nil {
+		if err == sql.ErrNoRows {
+			return models.JobStatus{}, err
+		}
+		return models.JobStatus{}, err
+	}
+
+	return js, nil
+}
+
+func (s *sqlStore) UpsertUser(ctx context.Context, auth0Sub, email, name string) error {
+	const q = `
+		INSERT INTO users (id, auth0_sub, email, name, last_login, plan, analyses_used, usage_period_start)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, $5, $6, $7)
+		ON CONFLICT (auth0_sub) DO UPDATE
+		SET
+			last_login = CURRENT_TIMESTAMP,
+			plan = COALESCE(users.plan, EXCLUDED.plan);
+	`
+
+	_, err := s.db.ExecContext(
+		ctx,
+		q,
+		uuid.New(),
+		auth0Sub,
+		nullIfEmpty(email),
+		nullIfEmpty(name),
+		models.PlanFree,
+		0,
+		weekStartUTC(time.Now()),
+	)
+	return err
+}
+
+func (s *sqlStore) GetUser(ctx context.Context, auth0Sub string) (models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `
+		SELECT id, plan, analyses_used, usage_period_start, stripe_customer_id
+		FROM users
+		WHERE auth0_sub = $1;
+	`, auth0Sub), auth0Sub)
+}
+
+func scanUser(row rowScanner, auth0Sub string) (models.User, error) {
+	var (
+		user     models.User
+		stripeID sql.NullString
+	)
+	err := row.Scan(&user.ID, &user.Plan, &user.AnalysesUsed, &user.UsagePeriodStart, &stripeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user.Auth0Sub = auth0Sub
+	if stripeID.Valid && stripeID.String != "" {
+		user.StripeCustomerID = &stripeID.String
+	}
+	return user, nil
+}
+
+func (s *sqlStore) UpdateUsage(ctx context.Context, auth0Sub string, fn func(*models.User) error) (models.User, error) {
+	tx, err := s.db.BeginTx(ctx, s.txOpts)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	selectUser := `
+		SELECT id, plan, analyses_used, usage_period_start, stripe_customer_id
+		FROM users
+		WHERE auth0_sub = $1` + s.lockRow + `;
+	`
+	user, err := scanUser(tx.QueryRowContext(ctx, selectUser, auth0Sub), auth0Sub)
+	if errors.Is(err, ErrUserNotFound) {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, auth0_sub, plan, analyses_used, usage_period_start)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (auth0_sub) DO NOTHING;
+		`, uuid.New(), auth0Sub, models.PlanFree, 0, weekStartUTC(time.Now())); err != nil {
+			return models.User{}, err
+		}
+		user, err = scanUser(tx.QueryRowContext(ctx, selectUser, auth0Sub), auth0Sub)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := fn(&user); err != nil {
+		return user, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET analyses_used = $1, usage_period_start = $2
+		WHERE auth0_sub = $3;
+	`, user.AnalysesUsed, user.UsagePeriodStart, auth0Sub); err != nil {
+		return models.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (s *sqlStore) SetStripeCustomerID(ctx context.Context, auth0Sub, customerID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET stripe_customer_id = $1
+		WHERE auth0_sub = $2;
+	`, customerID, auth0Sub)
+	return err
+}
+
+func (s *sqlStore) SetPlan(ctx context.Context, auth0Sub string, plan models.Plan) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET plan = $1
+		WHERE auth0_sub = $2;
+	`, plan, auth0Sub)
+	return err
+}
+
+func (s *sqlStore) SetPlanByStripeCustomer(ctx context.Context, customerID string, plan models.Plan) error {
+	if customerID == "" {
+		return errors.New("missing stripe customer id")
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET plan = $1
+		WHERE stripe_customer_id = $2;
+	`, plan, customerID)
+	return err
+}
@@ -0,0 +1,250 @@
+// Package app implements the stores on SQLite for local, single-file use.
+package app
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"net/url"
+
+	"example/my-go-api/app/migrations"
+	"example/my-go-api/app/models"
+
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// SQLiteStore keeps everything in one file, for self-hosting and offline use.
+// SQLite has no row locks or COPY: write transactions take the database lock
+// up front (_txlock=immediate) and bulk writes are prepared inserts.
+type SQLiteStore struct {
+	sqlStore
+}
+
+// OpenSQLiteStore opens (creating if needed) the database at path and applies
+// the schema to a new one. ":memory:" gives a private in-memory database. A
+// file whose schema is older than this build's is refused, as SQLite has no
+// migrations to bring it up to date.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+		"_txlock": {"immediate"},
+	}.Encode()
+	d, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	if path == ":memory:" {
+		// Every connection would otherwise get its own empty database.
+		d.SetMaxOpenConns(1)
+	}
+	if err := applySQLiteSchema(context.Background(), d); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("sqlite database %s: %w", path, err)
+	}
+	return &SQLiteStore{sqlStore{
+		db: d,
+		statsBucketSQL: map[string]string{
+			// Weeks start on Monday, as with Postgres' date_trunc.
+			StatsBucketWeek:  `CAST(strftime('%s', g.when_unix, 'unixepoch', 'start of day', 'weekday 0', '-6 days') AS INTEGER)`,
+			StatsBucketMonth: `CAST(strftime('%s', g.when_unix, 'unixepoch', 'start of month') AS INTEGER)`,
+		},
+	}}, nil
+}
+
+// Close releases the database file.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// CheckSchema compares the file's schema version with this build's, as the
+// migrations check does for Postgres.
+func (s *SQLiteStore) CheckSchema(ctx context.Context) error {
+	_, err := checkSQLiteSchema(ctx, s.db)
+	return err
+}
+
+// applySQLiteSchema creates the schema in an empty database, which records its
+// version in PRAGMA user_version, then checks the version. A database with
+// tables but no version predates versioning and is treated as behind.
+func applySQLiteSchema(ctx context.Context, db *sql.DB) error {
+	version, err := sqliteSchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		var tables int
+		if err := db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'`,
+		).Scan(&tables); err != nil {
+			return err
+		}
+		if tables > 0 {
+			return fmt.Errorf("%w: the file has no schema version, so an older build created it", migrations.ErrSchemaBehind)
+		}
+		if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+			return fmt.Errorf("apply sqlite schema: %w", err)
+		}
+	}
+	_, err = checkSQLiteSchema(ctx, db)
+	return err
+}
+
+// checkSQLiteSchema returns migrations.ErrSchemaBehind when the database's
+// version is below the latest migration's, which sqlite_schema.sql mirrors.
+func checkSQLiteSchema(ctx context.Context, db *sql.DB) (int, error) {
+	version, err := sqliteSchemaVersion(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if latest := migrations.Latest(); version < latest {
+		return version, fmt.Errorf("%w: at version %d, need %d", migrations.ErrSchemaBehind, version, latest)
+	}
+	return version, nil
+}
+
+func sqliteSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *SQLiteStore) SaveGames(ctx context.Context, username string, games []models.GameLite) error {
+	if len(games) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO games (
+			username, url, when_unix, color, opponent, opponent_rating,
+			result, rated, time_class, time_control, pgn, eco, variant,
+			start_fen, eco_code, opening_name, opening_family, opening_variation, opening_ply
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		ON CONFLICT (username, url) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, g := range games {
+		if _, err := stmt.ExecContext(ctx,
+			username,
+			g.URL,
+			g.When,
+			g.Color,
+			g.Opponent,
+			g.OppRating,
+			g.Result,
+			g.Rated,
+			g.TimeClass,
+			g.TimeControl,
+			g.PGN,
+			g.ECO,
+			g.Variant,
+			nullIfEmpty(g.StartFEN),
+			nullIfEmpty(g.ECOCode),
+			nullIfEmpty(g.OpeningName),
+			nullIfEmpty(g.OpeningFamily),
+			nullIfEmpty(g.OpeningVariation),
+			g.OpeningPly,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) SaveMoves(ctx context.Context, games []models.GameLite, settings models.EngineSettings) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO moves (
+			game_id, ply, move_number, fen_before,
+			fen_after, move_uci, move_san, color,
+			eval_depth, eval_time, eval_before_cp,
+			eval_after_cp, eval_before_mate, eval_after_mate, centipawn_change, best_move_uci, is_inaccuracy, is_mistake, is_blunder,
+			is_suboptimal, normalized_fen_before, played_by, motifs, is_missed_win, missed_win_cp
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
+		ON CONFLICT (game_id, ply) DO UPDATE
+		SET
+			eval_depth = excluded.eval_depth,
+			eval_time = excluded.eval_time,
+			eval_before_cp = excluded.eval_before_cp,
+			eval_after_cp = excluded.eval_after_cp,
+			eval_before_mate = excluded.eval_before_mate,
+			eval_after_mate = excluded.eval_after_mate,
+			centipawn_change = excluded.centipawn_change,
+			best_move_uci = excluded.best_move_uci,
+			is_inaccuracy = excluded.is_inaccuracy,
+			is_mistake = excluded.is_mistake,
+			is_blunder = excluded.is_blunder,
+			is_suboptimal = excluded.is_suboptimal,
+			motifs = excluded.motifs,
+			is_missed_win = excluded.is_missed_win,
+			missed_win_cp = excluded.missed_win_cp;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, g := range games {
+		for _, e := range g.Moves {
+			motifs := e.Analysis.Motifs
+			if motifs == nil {
+				motifs = []string{}
+			}
+			if _, err := stmt.ExecContext(ctx,
+				g.GameId,
+				e.Ply,
+				e.MoveNumber,
+				e.FenBefore.FEN,
+				e.FenAfter.FEN,
+				e.MoveUCI,
+				e.MoveSAN,
+				e.Color,
+				settings.Depth,
+				settings.MoveTimeMS,
+				e.FenBefore.Score.CP,
+				e.FenAfter.Score.CP,
+				e.FenBefore.Score.Mate,
+				e.FenAfter.Score.Mate,
+				e.Analysis.CPChange,
+				e.FenBefore.Score.Best,
+				e.Analysis.Is_Innacuracy,
+				e.Analysis.Is_Mistake,
+				e.Analysis.Is_Blunder,
+				e.Analysis.Is_Suboptimal,
+				NormalizeFEN(e.FenBefore.FEN),
+				e.PlayedBy,
+				pq.Array(motifs),
+				e.Analysis.Is_Missed_Win,
+				e.Analysis.MissedWinCP,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
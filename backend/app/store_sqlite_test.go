@@ -0,0 +1,559 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example/my-go-api/app/migrations"
+	"example/my-go-api/app/models"
+
+	"github.com/google/uuid"
+	"github.com/notnil/chess"
+)
+
+// newTestSQLiteStore opens a private in-memory store closed with the test.
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := OpenSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestOpenSQLiteStoreSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chessgaps.db")
+	s, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore new file: %v", err)
+	}
+	if version, err := sqliteSchemaVersion(ctx, s.db); err != nil || version != migrations.Latest() {
+		t.Fatalf("schema version = %d, %v; want %d, the latest migration", version, err, migrations.Latest())
+	}
+	if err := s.CheckSchema(ctx); err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	s.Close()
+
+	s, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	// An older build's file, which lacks the newer columns.
+	if _, err := s.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", migrations.Latest()-1)); err != nil {
+		t.Fatalf("set version: %v", err)
+	}
+	if err := s.CheckSchema(ctx); !errors.Is(err, migrations.ErrSchemaBehind) {
+		t.Fatalf("CheckSchema of an older file = %v, want ErrSchemaBehind", err)
+	}
+	s.Close()
+	if _, err := OpenSQLiteStore(path); !errors.Is(err, migrations.ErrSchemaBehind) {
+		t.Fatalf("OpenSQLiteStore older file = %v, want ErrSchemaBehind", err)
+	}
+
+	// Files from before the version was recorded have tables but version 0.
+	unversioned := filepath.Join(t.TempDir(), "old.db")
+	d, err := sql.Open("sqlite", "file:"+unversioned)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := d.Exec(`CREATE TABLE games (id INTEGER PRIMARY KEY, username TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	d.Close()
+	if _, err := OpenSQLiteStore(unversioned); !errors.Is(err, migrations.ErrSchemaBehind) {
+		t.Fatalf("OpenSQLiteStore unversioned file = %v, want ErrSchemaBehind", err)
+	}
+}
+
+func TestSQLiteStoreGames(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	games := []models.GameLite{
+		{URL: "u1", When: 100, Color: "white", Opponent: "bob", Result: "win", Rated: true, TimeClass: "blitz", PGN: "1. e4 e5"},
+		{URL: "u2", When: 200, Color: "black", Opponent: "carol", Result: "resigned", TimeClass: "rapid", PGN: "1. d4 d5",
+			OpeningInfo: models.OpeningInfo{ECOCode: "D00", OpeningName: "Queen's Pawn Game"}},
+	}
+	if err := s.SaveGames(ctx, "alice", games); err != nil {
+		t.Fatalf("SaveGames: %v", err)
+	}
+	// Saving again must skip the URLs already stored.
+	if err := s.SaveGames(ctx, "alice", games[:1]); err != nil {
+		t.Fatalf("SaveGames duplicate: %v", err)
+	}
+
+	n, err := s.CountGames(ctx, "alice")
+	if err != nil || n != 2 {
+		t.Fatalf("CountGames = %d, %v; want 2", n, err)
+	}
+
+	loaded, err := s.LoadGames(ctx, "alice", 10, 0)
+	if err != nil {
+		t.Fatalf("LoadGames: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].URL != "u2" || loaded[0].ECOCode != "D00" || loaded[1].Opponent != "bob" {
+		t.Fatalf("LoadGames should return newest first with metadata, got %+v", loaded)
+	}
+
+	missing, err := s.LoadGamesMissingOpening(ctx, 0, 10)
+	if err != nil || len(missing) != 1 || missing[0].URL != "u1" {
+		t.Fatalf("LoadGamesMissingOpening = %+v, %v", missing, err)
+	}
+	missing[0].OpeningInfo = models.OpeningInfo{ECOCode: "C20", OpeningName: "King's Pawn Game"}
+	if err := s.UpdateGameOpenings(ctx, missing); err != nil {
+		t.Fatalf("UpdateGameOpenings: %v", err)
+	}
+	if missing, _ := s.LoadGamesMissingOpening(ctx, 0, 10); len(missing) != 0 {
+		t.Fatalf("backfilled game still missing an opening: %+v", missing)
+	}
+}
+
+func TestSQLiteStoreErrorPositions(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	const fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+	var games []models.GameLite
+	for i, url := range []string{"g1", "g2", "g3"} {
+		games = append(games, models.GameLite{URL: url, When: int64(100 + i), Color: "black", PGN: "1. e4"})
+	}
+	if err := s.SaveGames(ctx, "alice", games); err != nil {
+		t.Fatalf("SaveGames: %v", err)
+	}
+	games, err := s.LoadGames(ctx, "alice", 10, 0)
+	if err != nil {
+		t.Fatalf("LoadGames: %v", err)
+	}
+
+	// Two of the three visits to the position are blunders.
+	for i := range games {
+		blunder := i < 2
+		games[i].Moves = []models.Move{{
+			MoveUCI:    "f7f6",
+			MoveSAN:    "f6",
+			PlayedBy:   "alice",
+			MoveNumber: 1,
+			Ply:        2,
+			Color:      "b",
+			FenBefore:  models.FENEval{FEN: fen, Score: models.UCIScore{CP: intPtr(-30), Best: "e7e5"}},
+			FenAfter:   models.FENEval{FEN: fen, Score: models.UCIScore{CP: intPtr(300)}},
+			Analysis: models.MoveAnalysis{
+				CPChange:      330,
+				Is_Suboptimal: true,
+				Is_Blunder:    blunder,
+				Motifs:        []string{"hanging_piece"},
+			},
+		}}
+	}
+	settings := models.EngineSettings{Depth: 12}
+	if err := s.SaveMoves(ctx, games, settings); err != nil {
+		t.Fatalf("SaveMoves: %v", err)
+	}
+	// Re-analysis upserts instead of failing on (game_id, ply).
+	if err := s.SaveMoves(ctx, games, settings); err != nil {
+		t.Fatalf("SaveMoves again: %v", err)
+	}
+
+	q := DefaultErrorPositionQuery()
+	q.MinSeverity = SeverityBlunder
+	reports, next, err := s.FindErrorPositions(ctx, "alice", q)
+	if err != nil {
+		t.Fatalf("FindErrorPositions: %v", err)
+	}
+	if len(reports) != 1 || next != "" {
+		t.Fatalf("want one position and no next page, got %d, %q", len(reports), next)
+	}
+	bad := reports[0].BadFen
+	if bad.TimesSeen != 3 || bad.ErrorCount != 2 || bad.BlunderCount != 2 || bad.TotalCPLost != 660 {
+		t.Fatalf("unexpected counts %+v", bad)
+	}
+	if len(reports[0].Moves) != 2 {
+		t.Fatalf("want the two blunders as example moves, got %d", len(reports[0].Moves))
+	}
+	if m := reports[0].Moves[0]; len(m.Analysis.Motifs) != 1 || m.Analysis.Motifs[0] != "hanging_piece" {
+		t.Fatalf("motifs did not round-trip: %+v", m.Analysis.Motifs)
+	}
+}
+
+func TestSQLiteStoreJobs(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	if err := s.UpsertUser(ctx, "sub", "a@example.com", "Alice"); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	user, err := s.GetUser(ctx, "sub")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+
+	jobID, err := s.CreateJob(ctx, "alice", user.ID, 150, 100, 2)
+	if err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	status, err := s.FindJobStatus(ctx, jobID)
+	if err != nil || status.Status != "queued" || status.TotalBatches != 2 {
+		t.Fatalf("FindJobStatus = %+v, %v", status, err)
+	}
+	for want, state := range []string{"running", "completed"} {
+		if err := s.UpdateJobProgress(ctx, jobID); err != nil {
+			t.Fatalf("UpdateJobProgress: %v", err)
+		}
+		status, _ = s.FindJobStatus(ctx, jobID)
+		if status.Status != state || status.CompletedBatches != want+1 {
+			t.Fatalf("after %d batches got %+v", want+1, status)
+		}
+	}
+	if _, err := s.FindJobStatus(ctx, uuid.NewString()); err == nil {
+		t.Fatalf("unknown job should error")
+	}
+}
+
+func TestSQLiteStoreUsers(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	if _, err := s.GetUser(ctx, "nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUser unknown = %v, want ErrUserNotFound", err)
+	}
+
+	// UpdateUsage creates a missing user on the free plan.
+	user, err := enforceWeeklyQuota(ctx, s, "sub", 60)
+	if err != nil || user.Plan != models.PlanFree || user.AnalysesUsed != 60 {
+		t.Fatalf("first quota charge = %+v, %v", user, err)
+	}
+	_, err = enforceWeeklyQuota(ctx, s, "sub", 50)
+	var qe quotaError
+	if !errors.As(err, &qe) || qe.Used != 60 {
+		t.Fatalf("over-quota charge = %v, want quotaError with 60 used", err)
+	}
+	if user, _ := s.GetUser(ctx, "sub"); user.AnalysesUsed != 60 {
+		t.Fatalf("rejected charge was stored: %+v", user)
+	}
+
+	// A period from a past week is reset before charging.
+	if _, err := s.UpdateUsage(ctx, "sub", func(u *models.User) error {
+		u.UsagePeriodStart = weekStartUTC(time.Now()).AddDate(0, 0, -7)
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUsage: %v", err)
+	}
+	if user, err := enforceWeeklyQuota(ctx, s, "sub", 50); err != nil || user.AnalysesUsed != 50 {
+		t.Fatalf("charge in a new week = %+v, %v", user, err)
+	}
+
+	if err := s.SetStripeCustomerID(ctx, "sub", "cus_1"); err != nil {
+		t.Fatalf("SetStripeCustomerID: %v", err)
+	}
+	if err := s.SetPlanByStripeCustomer(ctx, "cus_1", models.PlanPro); err != nil {
+		t.Fatalf("SetPlanByStripeCustomer: %v", err)
+	}
+	user, err = s.GetUser(ctx, "sub")
+	if err != nil || user.Plan != models.PlanPro || user.StripeCustomerID == nil || *user.StripeCustomerID != "cus_1" {
+		t.Fatalf("GetUser after upgrade = %+v, %v", user, err)
+	}
+	if user, err := enforceWeeklyQuota(ctx, s, "sub", 1000); err != nil || user.AnalysesUsed != 50 {
+		t.Fatalf("paid plan should not be charged, got %+v, %v", user, err)
+	}
+
+	if err := s.SetPlan(ctx, "sub", models.PlanFree); err != nil {
+		t.Fatalf("SetPlan: %v", err)
+	}
+	if user, _ := s.GetUser(ctx, "sub"); user.Plan != models.PlanFree {
+		t.Fatalf("SetPlan did not downgrade: %+v", user)
+	}
+}
+
+// analysedGame stores g for username and returns it with its id and the moves
+// replayed from sans, each scored 20cp with the played move as the best one.
+// The caller adjusts the analysis before saving the moves.
+func analysedGame(t *testing.T, s *SQLiteStore, username string, g models.GameLite, sans ...string) models.GameLite {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.SaveGames(ctx, username, []models.GameLite{g}); err != nil {
+		t.Fatalf("SaveGames: %v", err)
+	}
+	stored, err := s.LoadGames(ctx, username, 100, 0)
+	if err != nil {
+		t.Fatalf("LoadGames: %v", err)
+	}
+	for _, sg := range stored {
+		if sg.URL == g.URL {
+			g.GameId = sg.GameId
+		}
+	}
+
+	pos := chess.StartingPosition()
+	for i, san := range sans {
+		m, err := chess.AlgebraicNotation{}.Decode(pos, san)
+		if err != nil {
+			t.Fatalf("decode %s: %v", san, err)
+		}
+		uci := chess.UCINotation{}.Encode(pos, m)
+		after := pos.Update(m)
+		color, playedBy := "w", username
+		if pos.Turn() == chess.Black {
+			color = "b"
+		}
+		if color != g.Color[:1] {
+			playedBy = g.Opponent
+		}
+		g.Moves = append(g.Moves, models.Move{
+			MoveUCI:    uci,
+			MoveSAN:    san,
+			PlayedBy:   playedBy,
+			MoveNumber: i/2 + 1,
+			Ply:        i + 1,
+			Color:      color,
+			FenBefore:  models.FENEval{FEN: pos.String(), Score: models.UCIScore{CP: intPtr(20), Best: uci}},
+			FenAfter:   models.FENEval{FEN: after.String(), Score: models.UCIScore{CP: intPtr(-20)}},
+		})
+		pos = after
+	}
+	return g
+}
+
+// reportGames stores three analysed games of alice's as white: two drawn-out
+// Open Games (a win and a draw) and a lost Sicilian where 2. Nf3 is a blunder.
+func reportGames(t *testing.T, s *SQLiteStore) []models.GameLite {
+	t.Helper()
+	const when = 1700000000 // Tuesday 2023-11-14 UTC
+	open := models.OpeningInfo{ECOCode: "C40", OpeningName: "King's Knight Opening"}
+	sicilian := models.OpeningInfo{ECOCode: "B50", OpeningName: "Sicilian Defense"}
+	games := []models.GameLite{
+		analysedGame(t, s, "alice", models.GameLite{URL: "g1", When: when, Color: "white", Opponent: "bob", Result: "win", OpeningInfo: open},
+			"e4", "e5", "Nf3", "Nc6"),
+		analysedGame(t, s, "alice", models.GameLite{URL: "g2", When: when + 60, Color: "white", Opponent: "bob", Result: "agreed", OpeningInfo: open},
+			"e4", "e5", "Nf3", "Nc6"),
+		analysedGame(t, s, "alice", models.GameLite{URL: "g3", When: when + 120, Color: "white", Opponent: "carol", Result: "resigned", OpeningInfo: sicilian},
+			"e4", "c5", "Nf3", "d6"),
+	}
+	blunder := &games[2].Moves[2]
+	blunder.FenBefore.Score.Best = "d2d4"
+	blunder.Analysis = models.MoveAnalysis{
+		CPChange: 300, Is_Suboptimal: true, Is_Blunder: true, Motifs: []string{"hanging_piece"},
+	}
+	missed := &games[0].Moves[2]
+	// Stored with an error flag too, as older builds did; errorSQL must still skip it.
+	missed.Analysis = models.MoveAnalysis{Is_Missed_Win: true, MissedWinCP: 250, CPChange: 150, Is_Mistake: true}
+
+	if err := s.SaveMoves(context.Background(), games, models.EngineSettings{Depth: 12}); err != nil {
+		t.Fatalf("SaveMoves: %v", err)
+	}
+	return games
+}
+
+func TestSQLiteStoreReports(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+	reportGames(t, s)
+
+	all := DefaultErrorPositionQuery()
+	all.MoveMin, all.MoveMax = 0, 0
+	all.IncludeCustomStart = true
+
+	pos, err := s.FindExplorerPosition(ctx, "alice", chess.StartingPosition().String(), all)
+	if err != nil {
+		t.Fatalf("FindExplorerPosition: %v", err)
+	}
+	if len(pos.Moves) != 1 || pos.BestMoveUCI != "e2e4" {
+		t.Fatalf("unexpected explorer position %+v", pos)
+	}
+	if mv := pos.Moves[0]; mv.Count != 3 || mv.Wins != 1 || mv.Draws != 1 || mv.Losses != 1 || mv.AvgEvalAfterCP == nil || *mv.AvgEvalAfterCP != 20 {
+		t.Fatalf("unexpected explorer move %+v", mv)
+	}
+
+	motifs, err := s.FindMotifStats(ctx, "alice", all)
+	if err != nil {
+		t.Fatalf("FindMotifStats: %v", err)
+	}
+	if motifs.Errors != 1 || motifs.Blunders != 1 || len(motifs.Motifs) != 1 || motifs.Motifs[0].Motif != "hanging_piece" || motifs.Motifs[0].BlunderCount != 1 {
+		t.Fatalf("unexpected motif report %+v", motifs)
+	}
+
+	for opening, want := range map[string]int{"sicilian": 1, "%": 0, "_": 0} {
+		q := all
+		q.Opening = opening
+		if m, err := s.FindMotifStats(ctx, "alice", q); err != nil || m.Errors != want {
+			t.Fatalf("opening %q: errors = %+v, %v; want %d", opening, m, err, want)
+		}
+	}
+
+	missed, err := s.FindMissedWins(ctx, "alice", all, 10)
+	if err != nil {
+		t.Fatalf("FindMissedWins: %v", err)
+	}
+	if missed.Total != 1 || missed.MissedWins[0].OpponentMoveSAN != "e5" || missed.MissedWins[0].PlayedSAN != "Nf3" || missed.MissedWins[0].SwingCP != 250 {
+		t.Fatalf("unexpected missed wins %+v", missed)
+	}
+
+	openings, err := s.FindOpeningStats(ctx, "alice")
+	if err != nil {
+		t.Fatalf("FindOpeningStats: %v", err)
+	}
+	if len(openings) != 2 {
+		t.Fatalf("want two openings, got %+v", openings)
+	}
+	if o := openings[0]; o.ECOCode != "C40" || o.Games != 2 || o.Wins != 1 || o.Draws != 1 || o.Score != 0.75 ||
+		len(o.ExampleURLs) != 2 || o.ExampleURLs[0] != "g2" {
+		t.Fatalf("unexpected most played opening %+v", o)
+	}
+	if o := openings[1]; o.ECOCode != "B50" || o.Losses != 1 || len(o.ExampleURLs) != 1 {
+		t.Fatalf("unexpected second opening %+v", o)
+	}
+
+	edges, err := s.FindRepertoireEdges(ctx, "alice", "white", all)
+	if err != nil {
+		t.Fatalf("FindRepertoireEdges: %v", err)
+	}
+	byMove := map[string]repertoireEdge{}
+	for _, e := range edges {
+		byMove[e.MoveSAN] = e
+	}
+	if e := byMove["e4"]; e.Count != 3 || !e.PlayedByUser || e.BestMoveUCI != "e2e4" {
+		t.Fatalf("unexpected e4 edge %+v", e)
+	}
+	if e := byMove["e5"]; e.Count != 2 || e.PlayedByUser {
+		t.Fatalf("unexpected e5 edge %+v", e)
+	}
+}
+
+func TestSQLiteStoreStats(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	reportGames(t, s)
+
+	for bucket, start := range map[string]int64{
+		StatsBucketWeek:  1699833600, // Monday 2023-11-13
+		StatsBucketMonth: 1698796800, // 2023-11-01
+	} {
+		rows, err := s.FindStats(context.Background(), "alice", StatsQuery{Bucket: bucket})
+		if err != nil {
+			t.Fatalf("FindStats %s: %v", bucket, err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: want one bucket, got %+v", bucket, rows)
+		}
+		r := rows[0]
+		if r.Bucket != start || r.Games != 3 || r.Wins != 1 || r.Draws != 1 || r.Losses != 1 {
+			t.Fatalf("%s: unexpected games %+v", bucket, r)
+		}
+		// 2. Nf3 after 1... c5 is the only move not seen in an earlier game.
+		if r.Moves != 6 || r.Blunders != 1 || r.Repeated != 3 || r.RepeatedErrors != 0 {
+			t.Fatalf("%s: unexpected moves %+v", bucket, r)
+		}
+	}
+}
+
+func TestSQLiteStoreDrills(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+	reportGames(t, s)
+
+	q := DefaultErrorPositionQuery()
+	q.MinTimesSeen, q.MinErrors = 1, 1
+	res, err := SyncDrillCards(ctx, s, "alice", q, time.Unix(1700001000, 0))
+	if err != nil {
+		t.Fatalf("SyncDrillCards: %v", err)
+	}
+	if res.Created != 1 || res.Total != 1 {
+		t.Fatalf("unexpected sync %+v", res)
+	}
+
+	due, err := s.ListDueDrillCards(ctx, "alice", time.Unix(1700002000, 0), 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ListDueDrillCards = %+v, %v", due, err)
+	}
+	card := due[0]
+	if len(card.Answers) != 1 || card.Answers[0] != "d2d4" || card.LastErrorAt != 1700000120 {
+		t.Fatalf("unexpected card %+v", card)
+	}
+
+	card = scheduleDrill(card, drillDefaultQuality, time.Unix(1700002000, 0))
+	if err := s.UpdateDrillSchedule(ctx, card); err != nil {
+		t.Fatalf("UpdateDrillSchedule: %v", err)
+	}
+	got, err := s.GetDrillCard(ctx, "alice", card.ID)
+	if err != nil || got.Reviews != 1 || got.DueAt != card.DueAt {
+		t.Fatalf("GetDrillCard = %+v, %v", got, err)
+	}
+	if _, err := s.GetDrillCard(ctx, "alice", card.ID+1); !errors.Is(err, ErrDrillNotFound) {
+		t.Fatalf("GetDrillCard unknown = %v, want ErrDrillNotFound", err)
+	}
+	if _, err := s.GetDrillCard(ctx, "bob", card.ID); !errors.Is(err, ErrDrillNotFound) {
+		t.Fatalf("GetDrillCard of another user = %v, want ErrDrillNotFound", err)
+	}
+}
+
+func TestSQLiteStorePuzzles(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+	games := reportGames(t, s)
+
+	cands, err := s.FindPuzzleCandidates(ctx, "alice", 10)
+	if err != nil || len(cands) != 1 {
+		t.Fatalf("FindPuzzleCandidates = %+v, %v", cands, err)
+	}
+	if c := cands[0]; c.GameID != int64(games[2].GameId) || c.Ply != 3 || !c.ByUser || c.URL != "g3" {
+		t.Fatalf("unexpected candidate %+v", c)
+	}
+
+	p := models.Puzzle{
+		Username: "alice", SourcePly: 3, BlunderBy: "user", FEN: cands[0].FEN, SolverColor: "b",
+		Solution: []string{"d8a5"}, SolutionSAN: []string{"Qa5+"}, Theme: PuzzleMaterial, EvalCP: 300,
+	}
+	if err := s.SavePuzzle(ctx, cands[0].GameID, p, false); err != nil {
+		t.Fatalf("SavePuzzle: %v", err)
+	}
+	if cands, _ := s.FindPuzzleCandidates(ctx, "alice", 10); len(cands) != 0 {
+		t.Fatalf("examined blunder is still a candidate: %+v", cands)
+	}
+
+	puzzles, err := s.ListPuzzles(ctx, "alice", PuzzleMaterial, "user", 10)
+	if err != nil || len(puzzles) != 1 || puzzles[0].GameURL != "g3" || len(puzzles[0].Solution) != 1 {
+		t.Fatalf("ListPuzzles = %+v, %v", puzzles, err)
+	}
+	if puzzles, _ := s.ListPuzzles(ctx, "alice", PuzzleMate, "", 10); len(puzzles) != 0 {
+		t.Fatalf("theme filter ignored: %+v", puzzles)
+	}
+}
+
+func TestSQLiteStoreRepertoire(t *testing.T) {
+	s := newTestSQLiteStore(t)
+	ctx := context.Background()
+	reportGames(t, s)
+
+	moves, err := ParseRepertoire(testRepertoirePGN)
+	if err != nil {
+		t.Fatalf("ParseRepertoire: %v", err)
+	}
+	// Saving twice replaces rather than duplicates.
+	for range 2 {
+		if err := s.SaveRepertoire(ctx, "alice", "white", moves); err != nil {
+			t.Fatalf("SaveRepertoire: %v", err)
+		}
+	}
+	loaded, err := s.LoadRepertoire(ctx, "alice", "white")
+	if err != nil || len(loaded) != len(moves) {
+		t.Fatalf("LoadRepertoire = %d moves, %v; want %d", len(loaded), err, len(moves))
+	}
+
+	games, err := s.LoadRepertoireGames(ctx, "alice", "white", 2, 10)
+	if err != nil {
+		t.Fatalf("LoadRepertoireGames: %v", err)
+	}
+	if len(games) != 3 || games[0].URL != "g3" || len(games[0].Moves) != 2 {
+		t.Fatalf("unexpected games %+v", games)
+	}
+	report := buildRepertoireReport("alice", "white", newRepertoireBook(loaded), games)
+	if report.InBook != 3 {
+		t.Fatalf("every game follows the book to ply 2, got %+v", report)
+	}
+}
@@ -2,52 +2,55 @@ package app
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"log"
-
-	"example/my-go-api/app/config"
 
 	"github.com/stripe/stripe-go/v79"
-	"github.com/stripe/stripe-go/v79/customer"
+	"github.com/stripe/stripe-go/v79/client"
 )
 
-// InitStripe wires the Stripe API key from the environment.
-func InitStripe() {
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("failed to load config for stripe: %v", err)
-	}
-	stripe.Key = cfg.Stripe.SecretKey
+// BillingClient is the part of the Stripe API the billing handlers use.
+type BillingClient interface {
+	NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error)
+	NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error)
+}
+
+// stripeClient calls Stripe with its own key instead of the global stripe.Key.
+type stripeClient struct {
+	api *client.API
+}
+
+// NewStripeClient returns a BillingClient for the given secret key.
+func NewStripeClient(secretKey string) BillingClient {
+	return stripeClient{api: client.New(secretKey, nil)}
+}
+
+func (s stripeClient) NewCustomer(params *stripe.CustomerParams) (*stripe.Customer, error) {
+	return s.api.Customers.New(params)
+}
+
+func (s stripeClient) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return s.api.CheckoutSessions.New(params)
+}
+
+func (s stripeClient) NewPortalSession(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	return s.api.BillingPortalSessions.New(params)
 }
 
 // ensureStripeCustomer finds or creates a Stripe Customer for the given user.
-// It uses users.stripe_customer_id when present, otherwise creates a new customer
-// with metadata auth0_sub = <auth0Sub>, then stores that in the users table.
-func ensureStripeCustomer(ctx context.Context, auth0Sub string) (string, error) {
-	if db == nil {
-		return "", errors.New("db not initialized")
-	}
+// It uses the stored stripe customer id when present, otherwise creates a new
+// customer with metadata auth0_sub = <auth0Sub>, then stores that on the user.
+func (a *App) ensureStripeCustomer(ctx context.Context, auth0Sub string) (string, error) {
 	if auth0Sub == "" {
 		return "", errors.New("missing auth0 sub")
 	}
 
-	var stripeID sql.NullString
-	err := db.QueryRowContext(
-		ctx,
-		`
-			SELECT stripe_customer_id
-			FROM users
-			WHERE auth0_sub = $1;
-		`,
-		auth0Sub,
-	).Scan(&stripeID)
+	user, err := a.Stores.Users.GetUser(ctx, auth0Sub)
 	if err != nil {
 		return "", err
 	}
-
-	if stripeID.Valid && stripeID.String != "" {
-		return stripeID.String, nil
+	if user.StripeCustomerID != nil {
+		return *user.StripeCustomerID, nil
 	}
 
 	params := &stripe.CustomerParams{
@@ -55,22 +58,12 @@ func ensureStripeCustomer(ctx context.Context, auth0Sub string) (string, error)
 			"auth0_sub": auth0Sub,
 		},
 	}
-	cust, err := customer.New(params)
+	cust, err := a.Billing.NewCustomer(params)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = db.ExecContext(
-		ctx,
-		`
-			UPDATE users
-			SET stripe_customer_id = $1
-			WHERE auth0_sub = $2;
-		`,
-		cust.ID,
-		auth0Sub,
-	)
-	if err != nil {
+	if err := a.Stores.Users.SetStripeCustomerID(ctx, auth0Sub, cust.ID); err != nil {
 		return "", err
 	}
 
@@ -1,52 +1,40 @@
 package app
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 
-	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
 	"example/my-go-api/app/models"
 	"example/my-go-api/auth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v79"
-	portal "github.com/stripe/stripe-go/v79/billingportal/session"
-	"github.com/stripe/stripe-go/v79/checkout/session"
 	"github.com/stripe/stripe-go/v79/webhook"
 )
 
 // CreateCheckoutSession starts a Stripe Checkout Session for the authenticated user.
-func CreateCheckoutSession(c *gin.Context) {
+func (a *App) CreateCheckoutSession(c *gin.Context) {
 	claims, ok := auth.ClaimsFromContext(c.Request.Context())
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
 		return
 	}
 
-	stripeCustomerID, err := ensureStripeCustomer(c.Request.Context(), claims.Subject)
+	stripeCustomerID, err := a.ensureStripeCustomer(c.Request.Context(), claims.Subject)
 	if err != nil {
-		log.Printf("ensureStripeCustomer failed for sub=%s: %v", claims.Subject, err)
+		logging.FromContext(c.Request.Context()).Error("ensureStripeCustomer failed", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to prepare billing"})
 		return
 	}
 
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Printf("stripe checkout config load failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "billing not configured"})
-		return
-	}
-
+	cfg := a.Config
 	priceID := cfg.Stripe.PriceIDProMonthly
 	frontendURL := strings.TrimRight(cfg.Stripe.FrontendURL, "/")
 	if priceID == "" || frontendURL == "" {
-		log.Printf("missing Stripe config: price_id=%t frontend_url=%t", priceID != "", frontendURL != "")
+		logging.FromContext(c.Request.Context()).Error("missing Stripe config", "price_id", priceID != "", "frontend_url", frontendURL != "")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "billing not configured"})
 		return
 	}
@@ -64,9 +52,9 @@ func CreateCheckoutSession(c *gin.Context) {
 		CancelURL:  stripe.String(frontendURL + "/billing/cancel"),
 	}
 
-	sess, err := session.New(params)
+	sess, err := a.Billing.NewCheckoutSession(params)
 	if err != nil {
-		log.Printf("stripe checkout session failed: %v", err)
+		logging.FromContext(c.Request.Context()).Error("stripe checkout session failed", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create checkout session"})
 		return
 	}
@@ -75,26 +63,20 @@ func CreateCheckoutSession(c *gin.Context) {
 }
 
 // StripeWebhook handles Stripe subscription events and updates user plans.
-func StripeWebhook(c *gin.Context) {
+func (a *App) StripeWebhook(c *gin.Context) {
 	const maxBodyBytes = int64(65536)
 	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodyBytes))
 	if err != nil {
-		log.Printf("stripe webhook read failed: %v", err)
+		logging.FromContext(c.Request.Context()).Warn("stripe webhook read failed", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
 
 	sigHeader := c.GetHeader("Stripe-Signature")
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Printf("stripe webhook config load failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "webhook not configured"})
-		return
-	}
-
+	cfg := a.Config
 	endpointSecret := cfg.Stripe.WebhookSecret
 	if endpointSecret == "" {
-		log.Printf("stripe webhook secret missing")
+		logging.FromContext(c.Request.Context()).Error("stripe webhook secret missing")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "webhook not configured"})
 		return
 	}
@@ -108,7 +90,7 @@ func StripeWebhook(c *gin.Context) {
 		},
 	)
 	if err != nil {
-		log.Printf("stripe webhook signature failed: %v", err)
+		logging.FromContext(c.Request.Context()).Warn("stripe webhook signature failed", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "signature verification failed"})
 		return
 	}
@@ -117,7 +99,7 @@ func StripeWebhook(c *gin.Context) {
 	case "checkout.session.completed":
 		var sess stripe.CheckoutSession
 		if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
-			log.Printf("stripe session unmarshal failed: %v", err)
+			logging.FromContext(c.Request.Context()).Warn("stripe session unmarshal failed", "err", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session payload"})
 			return
 		}
@@ -126,20 +108,20 @@ func StripeWebhook(c *gin.Context) {
 			customerID = sess.Customer.ID
 		}
 		if customerID == "" {
-			log.Printf("stripe session missing customer id")
+			logging.FromContext(c.Request.Context()).Warn("stripe session missing customer id")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing customer id"})
 			return
 		}
 
-		if err := updateUserPlanByStripeCustomer(c.Request.Context(), customerID, models.PlanPro); err != nil {
-			log.Printf("stripe plan upgrade failed customer=%s err=%v", customerID, err)
+		if err := a.Stores.Users.SetPlanByStripeCustomer(c.Request.Context(), customerID, models.PlanPro); err != nil {
+			logging.FromContext(c.Request.Context()).Error("stripe plan upgrade failed", "customer", customerID, "err", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 			return
 		}
 	case "customer.subscription.deleted":
 		var sub stripe.Subscription
 		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-			log.Printf("stripe subscription unmarshal failed: %v", err)
+			logging.FromContext(c.Request.Context()).Warn("stripe subscription unmarshal failed", "err", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription payload"})
 			return
 		}
@@ -148,13 +130,13 @@ func StripeWebhook(c *gin.Context) {
 			customerID = sub.Customer.ID
 		}
 		if customerID == "" {
-			log.Printf("stripe subscription missing customer id")
+			logging.FromContext(c.Request.Context()).Warn("stripe subscription missing customer id")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing customer id"})
 			return
 		}
 
-		if err := updateUserPlanByStripeCustomer(c.Request.Context(), customerID, models.PlanFree); err != nil {
-			log.Printf("stripe plan downgrade failed customer=%s err=%v", customerID, err)
+		if err := a.Stores.Users.SetPlanByStripeCustomer(c.Request.Context(), customerID, models.PlanFree); err != nil {
+			logging.FromContext(c.Request.Context()).Error("stripe plan downgrade failed", "customer", customerID, "err", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 			return
 		}
@@ -166,7 +148,7 @@ func StripeWebhook(c *gin.Context) {
 }
 
 // CreatePortalSession creates a Stripe Customer Portal session for the authenticated user.
-func CreatePortalSession(c *gin.Context) {
+func (a *App) CreatePortalSession(c *gin.Context) {
 	claims, ok := auth.ClaimsFromContext(c.Request.Context())
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
@@ -176,53 +158,33 @@ func CreatePortalSession(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing auth0 sub"})
 		return
 	}
-	if db == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db not initialized"})
-		return
-	}
-
-	var stripeCustomerID sql.NullString
-	err := db.QueryRowContext(
-		c.Request.Context(),
-		`
-			SELECT stripe_customer_id
-			FROM users
-			WHERE auth0_sub = $1;
-		`,
-		claims.Subject,
-	).Scan(&stripeCustomerID)
+	user, err := a.Stores.Users.GetUser(c.Request.Context(), claims.Subject)
 	if err != nil {
-		log.Printf("portal lookup failed sub=%s err=%v", claims.Subject, err)
+		logging.FromContext(c.Request.Context()).Error("portal lookup failed", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load customer"})
 		return
 	}
-	if !stripeCustomerID.Valid || stripeCustomerID.String == "" {
+	if user.StripeCustomerID == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "stripe customer missing for user"})
 		return
 	}
 
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Printf("portal config load failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "billing not configured"})
-		return
-	}
-
+	cfg := a.Config
 	frontendURL := strings.TrimRight(cfg.Stripe.FrontendURL, "/")
 	if frontendURL == "" {
-		log.Printf("missing Stripe config: frontend_url=false")
+		logging.FromContext(c.Request.Context()).Error("missing Stripe config", "frontend_url", false)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "billing not configured"})
 		return
 	}
 
 	params := &stripe.BillingPortalSessionParams{
-		Customer:  stripe.String(stripeCustomerID.String),
+		Customer:  stripe.String(*user.StripeCustomerID),
 		ReturnURL: stripe.String(frontendURL + "/settings/billing"),
 	}
 
-	sess, err := portal.New(params)
+	sess, err := a.Billing.NewPortalSession(params)
 	if err != nil {
-		log.Printf("stripe portal session failed: %v", err)
+		logging.FromContext(c.Request.Context()).Error("stripe portal session failed", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create portal session"})
 		return
 	}
@@ -235,7 +197,7 @@ type updatePlanRequest struct {
 }
 
 // UpdateUserPlan sets the authenticated user's plan to the requested value.
-func UpdateUserPlan(c *gin.Context) {
+func (a *App) UpdateUserPlan(c *gin.Context) {
 	claims, ok := auth.ClaimsFromContext(c.Request.Context())
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth context"})
@@ -254,46 +216,12 @@ func UpdateUserPlan(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid plan"})
 		return
 	}
-	if db == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db not initialized"})
-		return
-	}
-
-	_, err := db.ExecContext(
-		c.Request.Context(),
-		`
-			UPDATE users
-			SET plan = $1
-			WHERE auth0_sub = $2;
-		`,
-		req.Plan,
-		claims.Subject,
-	)
+	err := a.Stores.Users.SetPlan(c.Request.Context(), claims.Subject, req.Plan)
 	if err != nil {
-		log.Printf("update plan failed sub=%s err=%v", claims.Subject, err)
+		logging.FromContext(c.Request.Context()).Error("update plan failed", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update plan"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
-
-func updateUserPlanByStripeCustomer(ctx context.Context, stripeCustomerID string, plan models.Plan) error {
-	if db == nil {
-		return errors.New("db not initialized")
-	}
-	if stripeCustomerID == "" {
-		return errors.New("missing stripe customer id")
-	}
-	_, err := db.ExecContext(
-		ctx,
-		`
-			UPDATE users
-			SET plan = $1
-			WHERE stripe_customer_id = $2;
-		`,
-		plan,
-		stripeCustomerID,
-	)
-	return err
-}
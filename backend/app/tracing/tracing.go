@@ -0,0 +1,122 @@
+// Package tracing sets up OpenTelemetry tracing and carries trace context
+// across HTTP requests and queued jobs.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "example/my-go-api"
+
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup installs an OTLP/HTTP exporter for cfg.Endpoint as the global tracer
+// provider, naming the service cfg.ServiceName or service. Without an endpoint
+// spans are dropped. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg config.TracingConfig, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	if cfg.ServiceName != "" {
+		service = cfg.ServiceName
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Flush exports buffered spans now. Lambda handlers call it before returning,
+// since the container may be frozen before the batcher's next tick.
+func Flush(ctx context.Context) error {
+	if tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		return tp.ForceFlush(ctx)
+	}
+	return nil
+}
+
+// Start starts a span from the global tracer provider.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, opts...)
+}
+
+// End marks span failed when err is set, then ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject returns the trace context of ctx as string pairs for a queue message.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns ctx carrying the trace context Inject produced.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Middleware starts a server span per request, continuing any trace in the
+// incoming headers, and adds trace_id to the request logger.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				attribute.String("request_id", logging.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.With(ctx, "trace_id", sc.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	recordSpans(t)
+	ctx, span := Start(context.Background(), "enqueue")
+	defer span.End()
+
+	carrier := Inject(ctx)
+	if carrier["traceparent"] == "" {
+		t.Fatalf("want a traceparent, got %v", carrier)
+	}
+	got := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	if got.TraceID() != span.SpanContext().TraceID() || got.SpanID() != span.SpanContext().SpanID() || !got.IsRemote() {
+		t.Fatalf("extracted %+v, want remote copy of %+v", got, span.SpanContext())
+	}
+}
+
+func TestInjectWithoutSpan(t *testing.T) {
+	if carrier := Inject(context.Background()); carrier != nil {
+		t.Fatalf("want nil carrier without a span, got %v", carrier)
+	}
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	rec := recordSpans(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/games/:username", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/games/alice", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	if s := spans[0]; s.Name() != "GET /games/:username" || s.SpanContext().TraceID().String() != traceID || s.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("unexpected span %q trace %s kind %v", s.Name(), s.SpanContext().TraceID(), s.SpanKind())
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
 	"example/my-go-api/app/models"
 	"fmt"
+	"log/slog"
 	"os/exec"
 	"strings"
 	"sync"
@@ -20,9 +23,32 @@ type UCIEngine struct {
 	out   *bufio.Scanner
 	mu    sync.Mutex
 	ready bool
+	log   *slog.Logger
 }
 
-func NewUCIEngine(path string) (*UCIEngine, error) {
+// NewUCIEngine starts the engine at path. The engine logs through the logger
+// in ctx, so its lines carry the caller's job and worker attributes; ctx also
+// bounds the handshake.
+func NewUCIEngine(ctx context.Context, path string) (*UCIEngine, error) {
+	return startUCIEngine(ctx, path)
+}
+
+// CheckEngine starts the engine at path, waits for it to answer "uciok" and
+// "readyok", and quits it. ctx bounds the whole check.
+func CheckEngine(ctx context.Context, path string) error {
+	e, err := startUCIEngine(ctx, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("engine handshake: %w", ctx.Err())
+		}
+		return err
+	}
+	return e.Close()
+}
+
+// startUCIEngine starts the process and runs the UCI handshake. If ctx ends
+// first the process is killed and its output closed, unblocking the read.
+func startUCIEngine(ctx context.Context, path string) (*UCIEngine, error) {
 	cmd := exec.Command(path)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -41,33 +67,71 @@ func NewUCIEngine(path string) (*UCIEngine, error) {
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
+	e.log = logging.FromContext(ctx).With("engine_path", path, "engine_pid", cmd.Process.Pid)
+	stop := context.AfterFunc(ctx, func() {
+		_ = cmd.Process.Kill()
+		_ = stdout.Close()
+	})
 	// Handshake: "uci" -> wait for "uciok"; also "isready" -> "readyok"
-	if err := e.send("uci"); err != nil {
-		return nil, err
-	}
-	for e.out.Scan() {
-		line := e.out.Text()
-		if line == "uciok" {
-			break
+	for _, step := range [][2]string{{"uci", "uciok"}, {"isready", "readyok"}} {
+		if err := e.handshake(step[0], step[1]); err != nil {
+			e.logger().Warn("engine handshake failed", "step", step[0], "err", err)
+			stop()
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return nil, err
 		}
 	}
-	if err := e.send("isready"); err != nil {
-		return nil, err
+	if !stop() {
+		// ctx ended just as the handshake finished; the process is being killed.
+		_ = cmd.Wait()
+		return nil, ctx.Err()
+	}
+	e.ready = true
+	e.logger().Info("engine started")
+	return e, nil
+}
+
+// logger returns the engine's logger, or the default one for engines built
+// without startUCIEngine.
+func (e *UCIEngine) logger() *slog.Logger {
+	if e.log != nil {
+		return e.log
+	}
+	return slog.Default()
+}
+
+// handshake sends cmd and reads until the engine answers want.
+func (e *UCIEngine) handshake(cmd, want string) error {
+	if err := e.send(cmd); err != nil {
+		return err
 	}
 	for e.out.Scan() {
-		if e.out.Text() == "readyok" {
-			break
+		if e.out.Text() == want {
+			return nil
 		}
 	}
-	e.ready = true
-	return e, nil
+	if err := e.out.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("engine exited before answering %q with %q", cmd, want)
+}
+
+// Alive reports whether the engine process is still answering. It turns false
+// once a command fails to send or the process closes its output mid-search.
+func (e *UCIEngine) Alive() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ready
 }
 
 func (e *UCIEngine) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	_ = e.send("quit")
-	return e.cmd.Wait()
+	err := e.cmd.Wait()
+	e.logger().Info("engine stopped", "err", err)
+	return err
 }
 
 func (e *UCIEngine) NewGame() error {
@@ -90,29 +154,169 @@ func (e *UCIEngine) NewGame() error {
 	return nil
 }
 
+// SetOption sends a UCI "setoption" command and waits for the engine to acknowledge it.
+func (e *UCIEngine) SetOption(name, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setOption(name, value)
+}
+
+// setOption is SetOption for callers already holding e.mu.
+func (e *UCIEngine) setOption(name, value string) error {
+	if !e.ready {
+		return errors.New("engine not ready")
+	}
+	if err := e.send(fmt.Sprintf("setoption name %s value %s", name, value)); err != nil {
+		return err
+	}
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	for e.out.Scan() {
+		if e.out.Text() == "readyok" {
+			break
+		}
+	}
+	return nil
+}
+
+// SetChess960 toggles UCI_Chess960 so castling rights in Chess960 FENs are understood.
+func (e *UCIEngine) SetChess960(enabled bool) error {
+	return e.SetOption("UCI_Chess960", fmt.Sprintf("%t", enabled))
+}
+
 // EvalFEN evaluates one position. Use either a fixed depth or movetime.
 // For beginners, movetime is simple and predictable across hardware.
 func (e *UCIEngine) EvalFEN(ctx context.Context, fen string, settings models.EngineSettings) (models.UCIScore, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	var lastScoreCP *int
+	var lastScoreMate *int
+	var lastPV []string
+
+	// Examples we parse:
+	// info depth 18 ... score cp 23 ... pv e2e4 e7e5
+	// info depth 20 ... score mate 3 ...
+	best, err := e.search(ctx, fen, settings, func(line string) {
+		lastScoreCP, lastScoreMate = parseInfoScore(line, lastScoreCP, lastScoreMate)
+		if pv := parseInfoPV(line); len(pv) > 0 {
+			lastPV = pv
+		}
+	})
+	if err != nil {
+		return models.UCIScore{}, err
+	}
+	// A PV from an earlier depth may start with a different move.
+	if len(lastPV) > 0 && lastPV[0] != best {
+		lastPV = nil
+	}
+
+	return models.UCIScore{CP: lastScoreCP, Mate: lastScoreMate, Best: best, PV: lastPV}, nil
+}
+
+// EvalMultiPV evaluates the n best lines from a position, best first. Each
+// line's score is from the side to move and its Best is the line's first move.
+func (e *UCIEngine) EvalMultiPV(ctx context.Context, fen string, settings models.EngineSettings, n int) ([]models.PVLine, error) {
+	if n < 1 {
+		n = 1
+	}
+	// One hold across option, search and reset, so no other search runs with
+	// MultiPV set.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.setOption("MultiPV", fmt.Sprintf("%d", n)); err != nil {
+		return nil, err
+	}
+	defer func() { _ = e.setOption("MultiPV", "1") }()
+
+	lines := make([]models.PVLine, n)
+	_, err := e.search(ctx, fen, settings, func(line string) {
+		fields := strings.Fields(line)
+		k := 1
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "multipv" {
+				_, _ = fmt.Sscanf(fields[i+1], "%d", &k)
+				break
+			}
+		}
+		pv := parseInfoPV(line)
+		if k < 1 || k > n || len(pv) == 0 {
+			return
+		}
+		l := &lines[k-1]
+		l.MultiPV = k
+		l.Score.CP, l.Score.Mate = parseInfoScore(line, l.Score.CP, l.Score.Mate)
+		l.Score.Best = pv[0]
+		l.PV = pv
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := lines[:0]
+	for _, l := range lines {
+		if l.MultiPV > 0 {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// parseInfoScore returns the score on an "info" line, or the previous score
+// when the line has none.
+func parseInfoScore(line string, cp, mate *int) (*int, *int) {
+	i := strings.Index(line, " score ")
+	if i == -1 {
+		return cp, mate
+	}
+	// score cp N  OR score mate N
+	scorePart := line[i+1:]
+	if strings.Contains(scorePart, "score cp ") {
+		var v int
+		_, _ = fmt.Sscanf(scorePart, "score cp %d", &v)
+		return &v, nil
+	} else if strings.Contains(scorePart, "score mate ") {
+		var v int
+		_, _ = fmt.Sscanf(scorePart, "score mate %d", &v)
+		return nil, &v
+	}
+	return cp, mate
+}
+
+// parseInfoPV returns the moves after "pv" on an "info" line, or nil.
+func parseInfoPV(line string) []string {
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if f == "pv" {
+			return append([]string(nil), fields[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// search runs one "go" on fen, passing every "info" line to onInfo, and returns
+// the engine's best move. The caller must hold e.mu.
+func (e *UCIEngine) search(ctx context.Context, fen string, settings models.EngineSettings, onInfo func(line string)) (string, error) {
 	if !e.ready {
-		return models.UCIScore{}, errors.New("engine not ready")
+		return "", errors.New("engine not ready")
 	}
 
 	// Load position
 	if err := e.send(fmt.Sprintf("position fen %s", fen)); err != nil {
-		return models.UCIScore{}, err
+		return "", err
 	}
 
+	mode := "movetime"
 	if settings.UseDepth {
 		// Analyze using depth
 		depth := settings.Depth
 		if depth <= 0 {
 			depth = 12
 		}
+		mode = "depth"
 		if err := e.send(fmt.Sprintf("go depth %d", depth)); err != nil {
-			return models.UCIScore{}, err
+			return "", err
 		}
 	} else {
 		//analyze using movetime
@@ -121,12 +325,11 @@ func (e *UCIEngine) EvalFEN(ctx context.Context, fen string, settings models.Eng
 			moveTime = 75
 		}
 		if err := e.send(fmt.Sprintf("go movetime %d", moveTime)); err != nil {
-			return models.UCIScore{}, err
+			return "", err
 		}
 	}
+	start := time.Now()
 
-	var lastScoreCP *int
-	var lastScoreMate *int
 	var best string
 
 	// Read until "bestmove ..." or context cancels
@@ -134,27 +337,10 @@ func (e *UCIEngine) EvalFEN(ctx context.Context, fen string, settings models.Eng
 	go func() {
 		for e.out.Scan() {
 			line := e.out.Text()
-			// Examples we parse:
-			// info depth 18 ... score cp 23 ...
-			// info depth 20 ... score mate 3 ...
-			// bestmove e2e4
 			if strings.HasPrefix(line, "info ") {
-				if i := strings.Index(line, " score "); i != -1 {
-					// score cp N  OR score mate N
-					scorePart := line[i+1:]
-					if strings.Contains(scorePart, "score cp ") {
-						var cp int
-						_, _ = fmt.Sscanf(scorePart, "score cp %d", &cp)
-						lastScoreCP = &cp
-						lastScoreMate = nil
-					} else if strings.Contains(scorePart, "score mate ") {
-						var m int
-						_, _ = fmt.Sscanf(scorePart, "score mate %d", &m)
-						lastScoreMate = &m
-						lastScoreCP = nil
-					}
-				}
+				onInfo(line)
 			} else if strings.HasPrefix(line, "bestmove ") {
+				// bestmove e2e4
 				fields := strings.Fields(line)
 				if len(fields) >= 2 {
 					best = fields[1]
@@ -168,6 +354,7 @@ func (e *UCIEngine) EvalFEN(ctx context.Context, fen string, settings models.Eng
 	var err error
 	select {
 	case <-ctx.Done():
+		e.logger().Debug("search cancelled", "fen", fen, "err", ctx.Err())
 		_ = e.send("stop")
 		select {
 		case err = <-readDone:
@@ -175,18 +362,30 @@ func (e *UCIEngine) EvalFEN(ctx context.Context, fen string, settings models.Eng
 			err = ctx.Err()
 		}
 	case err = <-readDone:
+		if err == nil && best == "" {
+			// stdout closed before "bestmove": the process has gone.
+			e.ready = false
+			err = errors.New("engine exited during search")
+			e.logger().Error("engine exited during search", "fen", fen)
+		}
 	}
 	if err != nil && err != bufio.ErrBufferFull {
-		return models.UCIScore{}, err
+		return "", err
 	}
-
-	return models.UCIScore{CP: lastScoreCP, Mate: lastScoreMate, Best: best}, nil
+	metrics.ObserveEval(mode, time.Since(start))
+	return best, nil
 }
 
 func (e *UCIEngine) send(cmd string) error {
 	_, err := fmt.Fprintln(e.in, cmd)
+	if err == nil {
+		err = e.in.Flush()
+	}
 	if err != nil {
-		return err
+		if e.ready {
+			e.logger().Error("engine stopped accepting commands", "cmd", cmd, "err", err)
+		}
+		e.ready = false
 	}
-	return e.in.Flush()
+	return err
 }
@@ -2,12 +2,15 @@ package app
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"testing"
 
+	"example/my-go-api/app/logging"
 	"example/my-go-api/app/models"
 )
 
@@ -42,6 +45,9 @@ func TestEvalFENUsesMovetimeAndParsesScore(t *testing.T) {
 	if score.CP == nil || *score.CP != 23 || score.Best != "e2e4" {
 		t.Fatalf("EvalFEN unexpected score: %+v", score)
 	}
+	if len(score.PV) != 2 || score.PV[1] != "e7e5" {
+		t.Fatalf("EvalFEN should keep the principal variation, got %v", score.PV)
+	}
 
 	sent := sb.String()
 	if !strings.Contains(sent, "position fen test-fen") {
@@ -86,3 +92,73 @@ func TestNewGameSendsCommands(t *testing.T) {
 		t.Fatalf("NewGame did not send expected commands: %q", sent)
 	}
 }
+
+func TestEvalMultiPVParsesLines(t *testing.T) {
+	eng, sb := newTestEngine([]string{
+		"readyok",
+		"info depth 1 multipv 1 score cp 10 pv d2d4",
+		"info depth 12 multipv 1 score cp 35 pv e2e4 e7e5",
+		"info depth 12 multipv 2 score cp 20 pv d2d4 d7d5",
+		"info depth 12 multipv 3 score mate -4 pv f2f3 e7e5",
+		"bestmove e2e4",
+		"readyok",
+	})
+
+	lines, err := eng.EvalMultiPV(context.Background(), "fen-multi", models.EngineSettings{UseDepth: true, Depth: 12}, 3)
+	if err != nil {
+		t.Fatalf("EvalMultiPV error: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("EvalMultiPV returned %d lines, want 3", len(lines))
+	}
+	if lines[0].Score.Best != "e2e4" || *lines[0].Score.CP != 35 || len(lines[0].PV) != 2 {
+		t.Fatalf("line 1 = %+v", lines[0])
+	}
+	if lines[2].Score.Mate == nil || *lines[2].Score.Mate != -4 || lines[2].Score.CP != nil {
+		t.Fatalf("line 3 = %+v", lines[2])
+	}
+
+	sent := sb.String()
+	if !strings.Contains(sent, "setoption name MultiPV value 3") || !strings.Contains(sent, "setoption name MultiPV value 1") {
+		t.Fatalf("EvalMultiPV should set and reset MultiPV, got %q", sent)
+	}
+}
+
+func TestUCIEngineLogsWithCallerAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.WithContext(context.Background(), slog.New(slog.NewTextHandler(&buf, nil)))
+	ctx = logging.With(ctx, "job_id", "job-1", "worker", 2)
+
+	eng, err := NewUCIEngine(ctx, writeEngine(t, `while read cmd; do
+  case "$cmd" in
+    uci) echo uciok ;;
+    isready) echo readyok ;;
+    go*) exit 1 ;;
+    quit) exit 0 ;;
+  esac
+done
+`))
+	if err != nil {
+		t.Fatalf("start engine: %v", err)
+	}
+	if _, err := eng.EvalFEN(context.Background(), "8/8/8/8/8/8/8/K6k w - - 0 1", models.EngineSettings{MoveTimeMS: 10}); err == nil {
+		t.Fatal("want an error from an engine that exits mid-search")
+	}
+	_ = eng.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, msg := range []string{"engine started", "engine exited during search", "engine stopped"} {
+		found := false
+		for _, l := range lines {
+			if strings.Contains(l, `msg="`+msg+`"`) {
+				found = true
+				if !strings.Contains(l, "job_id=job-1") || !strings.Contains(l, "worker=2") || !strings.Contains(l, "engine_pid=") {
+					t.Fatalf("%q line lacks the caller's attrs: %s", msg, l)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("no %q line in:\n%s", msg, buf.String())
+		}
+	}
+}
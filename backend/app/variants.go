@@ -0,0 +1,80 @@
+// Package app maps provider rule sets onto the variants we can analyse.
+package app
+
+import (
+	"regexp"
+	"strings"
+
+	"example/my-go-api/app/models"
+)
+
+const (
+	VariantStandard = "standard"
+	VariantChess960 = "chess960"
+)
+
+// chessDotComVariant maps a Chess.com "rules" value (chess, chess960, bughouse, ...)
+// onto our variant names. Unknown rule sets are passed through lower-cased.
+func chessDotComVariant(rules string) string {
+	rules = strings.ToLower(strings.TrimSpace(rules))
+	switch rules {
+	case "", "chess":
+		return VariantStandard
+	case "chess960":
+		return VariantChess960
+	}
+	return rules
+}
+
+// lichessVariant maps a Lichess "variant" key (standard, chess960, crazyhouse, ...)
+// onto our variant names. "fromPosition" games use standard rules.
+func lichessVariant(variant string) string {
+	variant = strings.ToLower(strings.TrimSpace(variant))
+	switch variant {
+	case "", "standard", "fromposition":
+		return VariantStandard
+	case "chess960":
+		return VariantChess960
+	}
+	return variant
+}
+
+// IsSupportedVariant reports whether games of this variant can be analysed.
+func IsSupportedVariant(variant string) bool {
+	return variant == VariantStandard || variant == VariantChess960
+}
+
+// reCastling matches castling in movetext, written with letters or zeros.
+var reCastling = regexp.MustCompile(`(?:^|[\s.])[O0]-[O0](?:-[O0])?(?:[^-\w]|$)`)
+
+// castles reports whether a game's movetext castles. notnil/chess only knows
+// the standard castling squares, so a Chess960 game that castles cannot be
+// replayed; Chess960 games that never castle are analysed as usual.
+func castles(pgn string) bool {
+	movetext := reComments.ReplaceAllString(reTags.ReplaceAllString(pgn, ""), " ")
+	return reCastling.MatchString(movetext)
+}
+
+// canAnalyse reports whether g's variant is supported and, for Chess960,
+// whether the game can be replayed.
+func canAnalyse(g models.GameLite) bool {
+	if !IsSupportedVariant(g.Variant) {
+		return false
+	}
+	return g.Variant != VariantChess960 || !castles(g.PGN)
+}
+
+// filterSupportedVariants drops games we cannot analyse, unsupported variants
+// and Chess960 games that castle, and reports how many were skipped.
+func filterSupportedVariants(games []models.GameLite) ([]models.GameLite, int) {
+	out := games[:0]
+	skipped := 0
+	for _, g := range games {
+		if !canAnalyse(g) {
+			skipped++
+			continue
+		}
+		out = append(out, g)
+	}
+	return out, skipped
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"testing"
+
+	"example/my-go-api/app/models"
+)
+
+func TestVariantMapping(t *testing.T) {
+	cases := []struct {
+		got, want string
+	}{
+		{chessDotComVariant("chess"), VariantStandard},
+		{chessDotComVariant("chess960"), VariantChess960},
+		{chessDotComVariant("crazyhouse"), "crazyhouse"},
+		{lichessVariant("standard"), VariantStandard},
+		{lichessVariant("fromPosition"), VariantStandard},
+		{lichessVariant("chess960"), VariantChess960},
+		{lichessVariant("atomic"), "atomic"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Fatalf("variant mapping = %q, want %q", tc.got, tc.want)
+		}
+	}
+}
+
+func TestFilterSupportedVariants(t *testing.T) {
+	games := []models.GameLite{
+		{URL: "a", Variant: VariantStandard},
+		{URL: "b", Variant: "bughouse"},
+		{URL: "c", Variant: VariantChess960, PGN: "[FEN \"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1\"]\n\n1. e4 e5 0-1"},
+		{URL: "d", Variant: "kingofthehill"},
+		{URL: "e", Variant: VariantChess960, PGN: "1. e4 e5 2. Nf3 Nc6 3. 0-0 {O-O?} Nf6 *"},
+		{URL: "f", Variant: VariantChess960, PGN: "1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. O-O+ *"},
+	}
+	out, skipped := filterSupportedVariants(games)
+	if skipped != 4 || len(out) != 2 || out[0].URL != "a" || out[1].URL != "c" {
+		t.Fatalf("filterSupportedVariants = %+v skipped=%d", out, skipped)
+	}
+}
@@ -2,10 +2,12 @@
 package auth
 
 import (
-	"log"
+	"context"
 	"net/http"
 	"strings"
 
+	"example/my-go-api/app/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,8 +28,7 @@ func Middleware(verifier *Verifier, cfg MiddlewareConfig) gin.HandlerFunc {
 				Issuer:  "local",
 				Raw:     map[string]any{"sub": "local-dev"},
 			}
-			ctx := WithClaims(c.Request.Context(), claims)
-			c.Request = c.Request.WithContext(ctx)
+			c.Request = c.Request.WithContext(withSubject(c, claims))
 			c.Next()
 			return
 		}
@@ -44,42 +45,48 @@ func Middleware(verifier *Verifier, cfg MiddlewareConfig) gin.HandlerFunc {
 
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			log.Printf("auth failure: missing Authorization header path=%s", c.Request.URL.Path)
+			logging.FromContext(c.Request.Context()).Warn("auth failure", "reason", "missing Authorization header", "path", c.Request.URL.Path)
 			respondUnauthorized(c, "missing authorization header")
 			return
 		}
 
 		token, ok := extractBearerToken(authHeader)
 		if !ok {
-			log.Printf("auth failure: malformed Authorization header path=%s", c.Request.URL.Path)
+			logging.FromContext(c.Request.Context()).Warn("auth failure", "reason", "malformed Authorization header", "path", c.Request.URL.Path)
 			respondUnauthorized(c, "invalid authorization header")
 			return
 		}
 
 		claims, err := verifier.Verify(token)
 		if err != nil {
-			log.Printf("auth failure: token invalid path=%s err=%v", c.Request.URL.Path, err)
+			logging.FromContext(c.Request.Context()).Warn("auth failure", "reason", "token invalid", "path", c.Request.URL.Path, "err", err)
 			respondUnauthorized(c, "invalid token")
 			return
 		}
 
 		if len(cfg.RequireScopes) > 0 && !hasScopes(claims.Scope, cfg.RequireScopes) {
-			log.Printf("auth failure: missing scopes path=%s", c.Request.URL.Path)
+			logging.FromContext(c.Request.Context()).Warn("auth failure", "reason", "missing scopes", "path", c.Request.URL.Path)
 			respondUnauthorized(c, "insufficient scope")
 			return
 		}
 
-		ctx := WithClaims(c.Request.Context(), claims)
-		c.Request = c.Request.WithContext(ctx)
+		c.Request = c.Request.WithContext(withSubject(c, claims))
 		if cfg.OnAuthenticated != nil {
 			if err := cfg.OnAuthenticated(c, claims); err != nil {
-				log.Printf("auth post-hook failure: path=%s err=%v", c.Request.URL.Path, err)
+				logging.FromContext(c.Request.Context()).Error("auth post-hook failure", "path", c.Request.URL.Path, "err", err)
 			}
 		}
 		c.Next()
 	}
 }
 
+// withSubject stores claims in the request context and tags its logger with
+// the subject.
+func withSubject(c *gin.Context, claims *Claims) context.Context {
+	ctx := WithClaims(c.Request.Context(), claims)
+	return logging.With(ctx, "subject", claims.Subject)
+}
+
 func extractBearerToken(header string) (string, bool) {
 	parts := strings.SplitN(header, " ", 2)
 	if len(parts) != 2 {
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
@@ -154,7 +154,7 @@ func readExpiry(raw any) time.Time {
 func AuthDisabled() bool {
 	if strings.EqualFold(os.Getenv("AUTH_DISABLED"), "true") {
 		if strings.EqualFold(os.Getenv("ENV"), "local") || os.Getenv("AWS_LAMBDA_FUNCTION_NAME") == "" {
-			log.Print("auth disabled via AUTH_DISABLED for local development")
+			slog.Debug("auth disabled via AUTH_DISABLED for local development")
 			return true
 		}
 	}
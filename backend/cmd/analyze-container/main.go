@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"example/my-go-api/app"
 	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
 	"example/my-go-api/app/models"
+	"example/my-go-api/app/tracing"
 	"log"
+	"log/slog"
+	"net/http"
 	"time"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -18,12 +23,19 @@ func main() {
 	// Global-ish init
 	baseCtx := context.Background()
 
-	cfg, err := config.LoadConfig()
+	cfg, err := config.Load(config.SectionLogs, config.SectionEngine, config.SectionQueue, config.SectionMetrics, config.SectionTracing)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	logging.Setup(cfg.Logs)
+	if _, err := tracing.Setup(baseCtx, cfg.Tracing, "chessgaps-worker"); err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
 
-	app.MustInitDB()
+	a, err := app.NewApp(baseCtx, cfg, app.MustOpenStores())
+	if err != nil {
+		log.Fatalf("failed to initialize app: %v", err)
+	}
 
 	// AWS config & SQS client
 	awsCfg, err := awsconfig.LoadDefaultConfig(baseCtx)
@@ -32,14 +44,27 @@ func main() {
 	}
 	sqsClient := sqs.NewFromConfig(awsCfg)
 
-	log.Println("Worker started")
+	// /ready is always served; /metrics only when METRICS_ADDR is set, sharing
+	// the listener when both use the same address.
+	readyMux := http.NewServeMux()
+	readyMux.Handle("/ready", a.WorkerReadyHandler())
+	if cfg.Metrics.Addr == cfg.Metrics.ReadyAddr {
+		readyMux.Handle("/metrics", metrics.Handler())
+	} else if cfg.Metrics.Addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		go serve("metrics", cfg.Metrics.Addr, metricsMux)
+	}
+	go serve("readiness", cfg.Metrics.ReadyAddr, readyMux)
+
+	slog.Info("worker started", "queue", cfg.Queue.URL)
 
 	for {
-		log.Printf("Listening on SQS queue: %s", cfg.QueueURL)
+		slog.Debug("polling SQS queue", "queue", cfg.Queue.URL)
 		// Long-poll SQS
 		recvCtx, cancel := context.WithTimeout(baseCtx, 30*time.Second)
 		resp, err := sqsClient.ReceiveMessage(recvCtx, &sqs.ReceiveMessageInput{
-			QueueUrl:            &cfg.QueueURL,
+			QueueUrl:            &cfg.Queue.URL,
 			MaxNumberOfMessages: 5,   // up to 10; tune as you like
 			WaitTimeSeconds:     20,  // enable long polling
 			VisibilityTimeout:   180, // seconds; must be > max batch processing time
@@ -47,7 +72,8 @@ func main() {
 		cancel()
 
 		if err != nil {
-			log.Printf("ReceiveMessage error: %v", err)
+			metrics.QueueReceiveErrors.Inc()
+			slog.Error("ReceiveMessage error", "err", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -59,31 +85,34 @@ func main() {
 		}
 
 		for _, m := range resp.Messages {
+			metrics.QueueMessages.WithLabelValues("received").Inc()
 			if m.Body == nil {
-				log.Printf("received message with empty body, skipping: %#v", m)
+				slog.Warn("received message with empty body, skipping", "message_id", m.MessageId)
 				continue
 			}
 
 			var job models.JobMessage
 			if err := json.Unmarshal([]byte(*m.Body), &job); err != nil {
-				log.Printf("failed to unmarshal job message: %v, body=%s", err, *m.Body)
+				metrics.QueueMessages.WithLabelValues("invalid").Inc()
+				slog.Error("failed to unmarshal job message", "err", err, "body", *m.Body)
 				// Option: send to DLQ or delete to avoid poison pill
 				// Here we delete to avoid infinite retries:
-				deleteMessage(sqsClient, cfg.QueueURL, m)
+				deleteMessage(baseCtx, sqsClient, cfg.Queue.URL, m)
 				continue
 			}
 
-			log.Printf("Received job: user=%s batch_index=%d num_games=%d job_id=%s",
-				job.User, job.BatchIndex, job.NumGames, job.JobID)
+			ctx := app.WithJobLogger(baseCtx, job)
+			logger := logging.FromContext(ctx)
+			logger.Info("received job", "num_games", job.NumGames)
 
 			// Per-job timeout (you can tune this)
-			jobCtx, jobCancel := context.WithTimeout(baseCtx, 2*time.Minute)
-			err := app.ProcessBatch(jobCtx, cfg, job)
+			jobCtx, jobCancel := context.WithTimeout(ctx, 2*time.Minute)
+			_, err := a.ProcessBatch(jobCtx, job)
 			jobCancel()
 
 			if err != nil {
-				log.Printf("error processing job job_id=%s user=%s batch_index=%d: %v",
-					job.JobID, job.User, job.BatchIndex, err)
+				metrics.QueueMessages.WithLabelValues("failed").Inc()
+				logger.Error("error processing job", "err", err)
 
 				// IMPORTANT: decide retry strategy
 				// - If you want SQS to retry: DO NOT delete the message
@@ -95,19 +124,19 @@ func main() {
 			}
 
 			if job.JobID != "" {
-				if err := app.UpdateJobProgress(baseCtx, job.JobID); err != nil {
-					log.Printf("failed to update job progress for job_id=%s: %v", job.JobID, err)
+				if err := a.Stores.Jobs.UpdateJobProgress(ctx, job.JobID); err != nil {
+					logger.Error("failed to update job progress", "err", err)
 					// we still delete the message so we don't re-run the batch
 				}
 			}
 
 			// Success: delete message from queue
-			deleteMessage(sqsClient, cfg.QueueURL, m)
+			deleteMessage(ctx, sqsClient, cfg.Queue.URL, m)
 		}
 	}
 }
 
-func deleteMessage(sqsClient *sqs.Client, queueURL string, m sqstypes.Message) {
+func deleteMessage(ctx context.Context, sqsClient *sqs.Client, queueURL string, m sqstypes.Message) {
 	if m.ReceiptHandle == nil {
 		return
 	}
@@ -116,6 +145,16 @@ func deleteMessage(sqsClient *sqs.Client, queueURL string, m sqstypes.Message) {
 		ReceiptHandle: m.ReceiptHandle,
 	})
 	if err != nil {
-		log.Printf("failed to delete SQS message: %v", err)
+		logging.FromContext(ctx).Error("failed to delete SQS message", "err", err)
+		return
+	}
+	metrics.QueueMessages.WithLabelValues("acked").Inc()
+}
+
+// serve runs one of the worker's side listeners until it fails.
+func serve(name, addr string, h http.Handler) {
+	slog.Info("listener started", "listener", name, "addr", addr)
+	if err := http.ListenAndServe(addr, h); err != nil {
+		slog.Error("listener stopped", "listener", name, "addr", addr, "err", err)
 	}
 }
@@ -4,29 +4,39 @@ import (
 	"context"
 	"example/my-go-api/app"
 	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
 	"example/my-go-api/app/models"
+	"example/my-go-api/app/tracing"
 	"log"
+	"log/slog"
 	"time"
 )
 
 func main() {
 	start := time.Now()
-	cfg, err := config.LoadConfig()
+	cfg, err := config.Load(config.SectionLogs, config.SectionEngine, config.SectionTracing)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	logging.Setup(cfg.Logs)
+	shutdown, err := tracing.Setup(context.Background(), cfg.Tracing, "chessgaps-analyze-local")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdown(context.Background())
 	settings := models.EngineSettings{Depth: 12, MoveTimeMS: 75, UseDepth: false}
 
-	app.MustInitDB()
+	a := &app.App{Config: cfg, Stores: app.MustOpenStores()}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
-	app.ProcessBatch(ctx, cfg, models.JobMessage{
+	job := models.JobMessage{
 		User:           "xpertwizard",
 		BatchIndex:     0,
 		NumGames:       100,
 		EngineDepth:    settings.Depth,
 		EngineMoveTime: settings.MoveTimeMS,
 		EngineUseDepth: settings.UseDepth,
-	})
-	log.Printf("Took %s", time.Since(start))
+	}
+	a.ProcessBatch(app.WithJobLogger(ctx, job), job)
+	slog.Info("done", "took", time.Since(start))
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Fills eco_code/opening_* for games imported before those columns existed,
+// using the ECO/Opening/ECOUrl tags in the stored PGN and falling back to the
+// built-in opening book when the tags are missing.
+func main() {
+	batchSize := flag.Int("batch", 500, "games to update per transaction")
+	flag.Parse()
+
+	start := time.Now()
+	cfg, err := config.Load(config.SectionLogs)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+	stores := app.MustOpenStores()
+	ctx := context.Background()
+
+	lastID, scanned, updated := 0, 0, 0
+	for {
+		games, err := stores.Games.LoadGamesMissingOpening(ctx, lastID, *batchSize)
+		if err != nil {
+			slog.Error("failed to load games", "after_id", lastID, "err", err)
+			os.Exit(1)
+		}
+		if len(games) == 0 {
+			break
+		}
+
+		for i := range games {
+			games[i].OpeningInfo = app.OpeningFromPGNTags(games[i].PGN)
+			if games[i].ECOCode == "" && games[i].OpeningName == "" && app.StartFENFromPGN(games[i].PGN) == "" {
+				if info, ok, err := app.ClassifyOpening(games[i].PGN); err != nil {
+					slog.Warn("failed to classify game", "game_id", games[i].GameId, "err", err)
+				} else if ok {
+					games[i].OpeningInfo = info
+				}
+			}
+			if games[i].ECOCode != "" || games[i].OpeningName != "" {
+				updated++
+			}
+		}
+		if err := stores.Games.UpdateGameOpenings(ctx, games); err != nil {
+			slog.Error("failed to update games", "after_id", lastID, "err", err)
+			os.Exit(1)
+		}
+
+		scanned += len(games)
+		lastID = games[len(games)-1].GameId
+		slog.Info("backfilled openings", "scanned", scanned, "updated", updated, "last_id", lastID)
+	}
+
+	slog.Info("backfill complete", "scanned", scanned, "updated", updated, "took", time.Since(start))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/models"
+)
+
+// Analyses a PGN file on this machine and writes the repeated-error report,
+// with nothing but a UCI engine installed:
+//
+//	chessgaps analyze games.pgn --player NAME [--depth 16 | --movetime 75] [--out report.json|report.html|-]
+//
+// Games are kept in an in-memory SQLite database unless --db names a file. The
+// report covers the games in FILE.pgn alone either way.
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "analyze" {
+		fmt.Fprintln(os.Stderr, "usage: chessgaps analyze FILE.pgn --player NAME [flags]")
+		fmt.Fprintln(os.Stderr, "run 'chessgaps analyze -h' for the flags")
+		os.Exit(2)
+	}
+
+	q := app.DefaultErrorPositionQuery()
+
+	fs := flag.NewFlagSet("chessgaps analyze", flag.ExitOnError)
+	player := fs.String("player", "", "username whose games and mistakes to analyse (required)")
+	depth := fs.Int("depth", 0, "search depth per position; overrides -movetime")
+	movetime := fs.Int("movetime", 75, "milliseconds per position")
+	fs.Int("moves", 40, "plies (half-moves) analysed per game; overrides ENGINE_NUMBER_OF_MOVES")
+	fs.String("engine", "stockfish", "UCI engine binary; overrides ENGINE_PATH")
+	workers := fs.Int("workers", 0, "engines run in parallel (default one per CPU)")
+	dbPath := fs.String("db", ":memory:", "SQLite file to keep games and moves in")
+	out := fs.String("out", "report.json", "report file; .html writes a page, - writes JSON to stdout")
+	fs.IntVar(&q.MinTimesSeen, "min-seen", q.MinTimesSeen, "times a position must come up")
+	fs.IntVar(&q.MinErrors, "min-errors", q.MinErrors, "times it must have been misplayed")
+	fs.IntVar(&q.MoveMin, "move-min", q.MoveMin, "first move number reported")
+	fs.IntVar(&q.MoveMax, "move-max", q.MoveMax, "last move number reported (0 for no limit)")
+	fs.StringVar(&q.Color, "color", "", "only positions where player had white or black")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chessgaps analyze FILE.pgn --player NAME [flags]")
+		fs.PrintDefaults()
+	}
+
+	// Flags may come before or after the file name.
+	var files []string
+	args := os.Args[2:]
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) != 1 || *player == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if q.Color != "" && q.Color != "white" && q.Color != "black" {
+		log.Fatalf("-color must be white or black")
+	}
+	if q.MinTimesSeen < 1 {
+		q.MinTimesSeen = 1
+	}
+	settings := models.EngineSettings{Depth: *depth, MoveTimeMS: *movetime, UseDepth: *depth > 0}
+	if !settings.UseDepth && settings.MoveTimeMS <= 0 {
+		log.Fatalf("-movetime must be positive")
+	}
+
+	// The engine flags beat the engine config section; their defaults apply
+	// only where the config leaves a setting unset.
+	engineFlags := map[string]string{"engine": "ENGINE_PATH", "moves": "ENGINE_NUMBER_OF_MOVES"}
+	flags, defaults := map[string]string{}, map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if env, ok := engineFlags[f.Name]; ok {
+			defaults[env] = f.DefValue
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		if env, ok := engineFlags[f.Name]; ok {
+			flags[env] = f.Value.String()
+		}
+	})
+	cfg, err := config.LoadWith(flags, defaults, config.SectionLogs, config.SectionEngine)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	err = app.CheckEngine(checkCtx, cfg.Engine.Path)
+	cancel()
+	if err != nil {
+		log.Fatalf("engine %s: %v", cfg.Engine.Path, err)
+	}
+
+	pgn, err := os.ReadFile(files[0])
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	store, err := app.OpenSQLiteStore(*dbPath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer store.Close()
+
+	a := &app.App{Config: cfg, Stores: app.StoresFrom(store), Workers: *workers}
+	start := time.Now()
+	report, err := a.AnalyzePGNFile(ctx, string(pgn), *player, filepath.Base(files[0]), settings, q)
+	if err != nil {
+		log.Fatalf("analyze %s: %v", files[0], err)
+	}
+
+	if err := writeReport(*out, report); err != nil {
+		log.Fatalf("write report: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "analysed %d of %d games in %s; %d repeated error positions",
+		report.GamesAnalyzed, report.GamesInFile, time.Since(start).Round(time.Second), len(report.Positions))
+	if *out != "-" {
+		fmt.Fprintf(os.Stderr, " written to %s", *out)
+	}
+	if report.GamesFailed > 0 {
+		fmt.Fprintf(os.Stderr, "; %d games failed", report.GamesFailed)
+	}
+	if report.Unscored > 0 {
+		fmt.Fprintf(os.Stderr, "; %d positions unscored", report.Unscored)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func writeReport(path string, r app.OfflineReport) error {
+	if path == "-" {
+		return writeJSON(os.Stdout, r)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	write := writeJSON
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".html" || ext == ".htm" {
+		write = app.WriteOfflineReportHTML
+	}
+	if err := write(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(w io.Writer, r app.OfflineReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"example/my-go-api/app/config"
+)
+
+// Prints and validates the effective configuration:
+//
+//	config check [-file app.yaml] [-sections engine,queue]
+//
+// Values come from the environment, then the file (default $CONFIG_FILE), then
+// defaults; secrets are redacted. It exits 1 when validation fails.
+func main() {
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	file := fs.String("file", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	only := fs.String("sections", "", "comma-separated sections to check (default all): "+sectionNames())
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: config check [-file path] [-sections a,b]")
+		fs.PrintDefaults()
+	}
+	if len(os.Args) < 2 || os.Args[1] != "check" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(os.Args[2:])
+
+	var sections []config.Section
+	for _, name := range strings.Split(*only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			sections = append(sections, config.Section(name))
+		}
+	}
+	for _, s := range sections {
+		if !knownSection(s) {
+			fmt.Fprintf(os.Stderr, "unknown section %q; want %s\n", s, sectionNames())
+			os.Exit(2)
+		}
+	}
+
+	settings, err := config.Effective(*file, sections...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var current config.Section
+	for _, s := range settings {
+		if s.Section != current {
+			current = s.Section
+			fmt.Printf("%s:\n", current)
+		}
+		source := s.Source
+		if source == "" {
+			source = "unset"
+		}
+		fmt.Printf("  %s: %q  # %s, %s\n", s.Key, s.Value, s.Env, source)
+	}
+
+	if _, err := config.LoadFrom(*file, sections...); err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			fmt.Fprintf(os.Stderr, "\n%d problems:\n", len(verr.Fields))
+			for _, f := range verr.Fields {
+				fmt.Fprintf(os.Stderr, "  %s\n", f.Error())
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "\n%v\n", err)
+		}
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "\nconfig OK")
+}
+
+func knownSection(s config.Section) bool {
+	for _, known := range config.Sections {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+func sectionNames() string {
+	names := make([]string, len(config.Sections))
+	for i, s := range config.Sections {
+		names[i] = string(s)
+	}
+	return strings.Join(names, ", ")
+}
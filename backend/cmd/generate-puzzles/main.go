@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/models"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Turns a user's stored blunders into puzzles. Every blunder is examined once;
+// positions without a unique winning line are recorded as rejected.
+func main() {
+	username := flag.String("user", "", "username whose blunders to turn into puzzles")
+	limit := flag.Int("limit", 100, "blunders to examine")
+	depth := flag.Int("depth", 18, "engine depth per position")
+	flag.Parse()
+
+	if *username == "" {
+		log.Fatalf("-user is required")
+	}
+
+	start := time.Now()
+	cfg, err := config.Load(config.SectionLogs, config.SectionEngine)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+	stores := app.MustOpenStores()
+	user := strings.ToLower(*username)
+	ctx := logging.With(context.Background(), "user", user)
+	logger := logging.FromContext(ctx)
+
+	eng, err := app.NewUCIEngine(ctx, cfg.Engine.Path)
+	if err != nil {
+		logger.Error("failed to start engine", "err", err)
+		os.Exit(1)
+	}
+	defer eng.Close()
+
+	settings := models.EngineSettings{Depth: *depth, UseDepth: true}
+	found, rejected, err := app.GeneratePuzzles(ctx, stores.Puzzles, eng, user, settings, app.DefaultPuzzleOptions(), *limit)
+	if err != nil {
+		logger.Error("puzzle generation failed", "found", found, "rejected", rejected, "err", err)
+		eng.Close()
+		os.Exit(1)
+	}
+	logger.Info("puzzle generation complete", "found", found, "rejected", rejected, "took", time.Since(start))
+}
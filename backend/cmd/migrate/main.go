@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/migrations"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Applies, rolls back or lists the embedded schema migrations:
+//
+//	migrate up              apply every pending migration
+//	migrate down [-steps N] roll back the last N migrations (default 1)
+//	migrate status          show which migrations are applied
+func main() {
+	steps := flag.Int("steps", 1, "migrations to roll back with down")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: migrate [-steps N] up|down|status")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(config.SectionLogs)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+
+	db, err := app.OpenDB()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := migrations.Up(ctx, db)
+		for _, m := range applied {
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(applied) == 0 {
+			slog.Info("schema is up to date", "version", migrations.Latest())
+		}
+	case "down":
+		if *steps < 1 {
+			log.Fatalf("-steps must be at least 1")
+		}
+		reverted, err := migrations.Down(ctx, db, *steps)
+		for _, m := range reverted {
+			slog.Info("reverted migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+	case "status":
+		statuses, err := migrations.Statuses(ctx, db)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-20s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"log"
 
 	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/tracing"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -17,12 +20,23 @@ var ginLambdaV2 *ginadapter.GinLambdaV2
 
 // init runs once per Lambda container (cold start)
 func init() {
-	// Initialize DB connection pool
-	app.MustInitDB()
-	app.InitStripe()
+	cfg, err := config.Load(config.SectionLogs, config.SectionQueue, config.SectionStripe, config.SectionTracing)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+	if _, err := tracing.Setup(context.Background(), cfg.Tracing, "chessgaps-api"); err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	// Initialize DB connection pool and clients
+	a, err := app.NewApp(context.Background(), cfg, app.MustOpenStores())
+	if err != nil {
+		log.Fatalf("failed to initialize app: %v", err)
+	}
 
 	// Set up Gin router
-	router, err := app.NewRouter()
+	router, err := app.NewRouter(a)
 	if err != nil {
 		log.Fatalf("failed to initialize router: %v", err)
 	}
@@ -34,6 +48,9 @@ func init() {
 
 // Handler is the Lambda entrypoint for API Gateway REST/HTTP API (proxy integration)
 func Handler(ctx context.Context, payload json.RawMessage) (any, error) {
+	// Lambda may freeze the container once we return; send this request's spans first.
+	defer tracing.Flush(ctx)
+
 	if isV2Event(payload) {
 		var req events.APIGatewayV2HTTPRequest
 		if err := json.Unmarshal(payload, &req); err != nil {
@@ -1,16 +1,46 @@
 package main
 
 import (
+	"context"
 	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/metrics"
+	"example/my-go-api/app/tracing"
 	"log"
+	"log/slog"
+	"net/http"
 )
 
 func main() {
-	app.MustInitDB()
-	app.InitStripe()
-	router, err := app.NewRouter()
+	cfg, err := config.Load(config.SectionLogs, config.SectionQueue, config.SectionStripe, config.SectionMetrics, config.SectionTracing)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+	shutdown, err := tracing.Setup(context.Background(), cfg.Tracing, "chessgaps-api")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdown(context.Background())
+	a, err := app.NewApp(context.Background(), cfg, app.MustOpenStores())
+	if err != nil {
+		log.Fatalf("failed to initialize app: %v", err)
+	}
+	router, err := app.NewRouter(a)
 	if err != nil {
 		log.Fatalf("failed to initialize router: %v", err)
 	}
+	if cfg.Metrics.Addr != "" {
+		// Kept off the public router; expose METRICS_ADDR to the scraper only.
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			slog.Info("serving metrics", "addr", cfg.Metrics.Addr)
+			if err := http.ListenAndServe(cfg.Metrics.Addr, mux); err != nil {
+				slog.Error("metrics listener stopped", "err", err)
+			}
+		}()
+	}
 	router.Run("0.0.0.0:8080")
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"example/my-go-api/app"
+	"example/my-go-api/app/config"
+	"example/my-go-api/app/logging"
+	"example/my-go-api/app/models"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Creates or refreshes a user's drill cards from their error positions. With
+// -multipv > 1 it also runs the engine on every active card and accepts each
+// move within -tolerance centipawns of the best one as a correct answer.
+func main() {
+	username := flag.String("user", "", "username whose drills to sync")
+	multiPV := flag.Int("multipv", 1, "engine lines to consider as alternative answers")
+	tolerance := flag.Int("tolerance", 30, "centipawns an alternative may trail the best move by")
+	depth := flag.Int("depth", 16, "engine depth for the MultiPV pass")
+	flag.Parse()
+
+	if *username == "" {
+		log.Fatalf("-user is required")
+	}
+
+	start := time.Now()
+	cfg, err := config.Load(config.SectionLogs)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	logging.Setup(cfg.Logs)
+	stores := app.MustOpenStores()
+	user := strings.ToLower(*username)
+	ctx := logging.With(context.Background(), "user", user)
+	logger := logging.FromContext(ctx)
+
+	res, err := app.SyncDrillCards(ctx, stores.Drills, user, app.DefaultErrorPositionQuery(), time.Now())
+	if err != nil {
+		logger.Error("failed to sync drills", "err", err)
+		os.Exit(1)
+	}
+	logger.Info("synced drills",
+		"created", res.Created, "updated", res.Updated, "reactivated", res.Reactivated, "total", res.Total)
+
+	if *multiPV > 1 {
+		cfg, err := config.Load(config.SectionEngine)
+		if err != nil {
+			logger.Error("failed to load config", "err", err)
+			os.Exit(1)
+		}
+		eng, err := app.NewUCIEngine(ctx, cfg.Engine.Path)
+		if err != nil {
+			logger.Error("failed to start engine", "err", err)
+			os.Exit(1)
+		}
+		defer eng.Close()
+
+		settings := models.EngineSettings{Depth: *depth, UseDepth: true}
+		n, err := app.ExpandDrillAnswers(ctx, stores.Drills, eng, user, settings, *multiPV, *tolerance)
+		if err != nil {
+			logger.Error("failed to expand drill answers", "err", err)
+			eng.Close()
+			os.Exit(1)
+		}
+		logger.Info("expanded drill answers", "cards", n)
+	}
+
+	logger.Info("drill sync complete", "took", time.Since(start))
+}
@@ -17,6 +17,8 @@ export type ErrorPosition = {
     BlunderCount: number
     ErrorCount: number
     ErrorRate: number
+    TotalCPLost: number
+    LastSeen: number
     SideToMove: string
   }
   Moves: {
@@ -36,6 +38,7 @@ export type ErrorsResponse = {
   username: string
   count: number
   positions: ErrorPosition[]
+  next_cursor: string
 }
 
 export type Plan = 'FREE' | 'PRO'